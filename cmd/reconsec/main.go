@@ -2,18 +2,25 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
 	"strings"
 	"time"
 
 	"github.com/ghostn3xus/reconsec/pkg/active"
+	"github.com/ghostn3xus/reconsec/pkg/approval"
 	"github.com/ghostn3xus/reconsec/pkg/dast"
 	"github.com/ghostn3xus/reconsec/pkg/discovery"
+	"github.com/ghostn3xus/reconsec/pkg/oob"
 	"github.com/ghostn3xus/reconsec/pkg/poc"
 	"github.com/ghostn3xus/reconsec/pkg/recon"
+	"github.com/ghostn3xus/reconsec/pkg/utils"
 	"github.com/spf13/cobra"
 )
 
@@ -34,13 +41,46 @@ func init() {
 	rootCmd.AddCommand(reconCmd)
 
 	// dirscan
+	addSessionFlags(dirscanCmd)
 	rootCmd.AddCommand(dirscanCmd)
 
 	// activescan
 	activescanCmd.Flags().String("url", "", "Target URL for the active scan")
 	activescanCmd.Flags().String("payloads", "payloads/", "Path to the directory containing payload files")
-	activescanCmd.Flags().Bool("sandbox", false, "Must be true to enable the sandbox and run the scan")
-	activescanCmd.MarkFlagRequired("url")
+	activescanCmd.Flags().Bool("sandbox", false, "Send payloads through the docker sandbox (same as --sandbox-backend docker)")
+	activescanCmd.Flags().String("sandbox-backend", "", "Send payloads with curl inside a sandbox: "+strings.Join(active.SandboxBackends, ", "))
+	activescanCmd.Flags().String("sandbox-network", "", "Sandbox network policy: none, bridge or host (default: bridge for containers, host otherwise)")
+	activescanCmd.Flags().Float64("sandbox-cpus", 1, "CPU limit for each sandboxed request (0 = unlimited)")
+	activescanCmd.Flags().Int("sandbox-memory", 256, "Memory limit in MB for each sandboxed request (0 = unlimited)")
+	activescanCmd.Flags().Int("sandbox-timeout", 30, "Time limit in seconds for each sandboxed request")
+	activescanCmd.Flags().String("sandbox-image", "curlimages/curl:8.2.1", "Container image used by the docker and podman backends")
+	activescanCmd.Flags().Int64("sandbox-max-output", 1<<20, "Maximum bytes captured from each sandboxed request")
+	activescanCmd.Flags().Bool("skip-waf", false, "Skip WAF/CDN detection before sending payloads")
+	activescanCmd.Flags().Bool("strict", false, "Refuse to scan if any payload template is invalid")
+	activescanCmd.Flags().String("keyring", "payloads/keyring", "Trusted approver public keys (.pub file or directory)")
+	activescanCmd.Flags().Bool("allow-unsigned", false, "Load unsigned or tampered payload files anyway (recorded in the audit log)")
+	activescanCmd.Flags().String("audit-log", "payload-audit.log", "Append-only log of every payload file load")
+	activescanCmd.Flags().String("engagement", "", "Engagement identifier recorded in the audit log")
+	activescanCmd.Flags().String("request", "", "Raw HTTP/1.1 request file used as the base request (inject only at §marker§ positions if present)")
+	activescanCmd.Flags().String("scheme", "https", "Scheme for a raw request whose request line has only a path")
+	activescanCmd.Flags().String("har", "", "HAR file whose requests are used as base requests (every injection point is tested)")
+	activescanCmd.Flags().String("targets", "", "File with additional target URLs, one per line")
+	activescanCmd.Flags().Int("concurrency", 4, "Number of concurrent workers sending payloads")
+	activescanCmd.Flags().Int("rate", 4, "Maximum requests per second per host")
+	activescanCmd.Flags().Int("global-rate", 20, "Maximum requests per second across all hosts (0 = unlimited)")
+	activescanCmd.Flags().Int("max-requests", 0, "Total payload request budget for the run (0 = unlimited)")
+	activescanCmd.Flags().Bool("progress", false, "Print scan progress to stderr")
+	activescanCmd.Flags().Float64Slice("time-delays", []float64{1, 2, 4}, "Delays in seconds requested by time-based ({{DELAY}}) payloads")
+	activescanCmd.Flags().Int("time-trials", 2, "Rounds of every delay a time-based hit must survive")
+	activescanCmd.Flags().Int("diff-trials", 3, "True/false pairs a differential (boolean) hit must survive")
+	activescanCmd.Flags().String("oob", "", "URL of a 'reconsec oob' server used for {{OOB}} payloads")
+	activescanCmd.Flags().String("oob-token", "", "Bearer token of the out-of-band server poll API")
+	activescanCmd.Flags().Int("oob-wait", 5, "Seconds to wait for late out-of-band interactions before polling")
+	activescanCmd.Flags().String("policy", "", "Scan policy file (YAML/JSON) selecting categories, intensity and the maximum safety class")
+	activescanCmd.Flags().String("max-safety", "", "Hard maximum safety class for the engagement: "+strings.Join(active.SafetyClasses, ", "))
+	activescanCmd.Flags().Bool("csrf", false, "Fetch the source page before every request and refresh anti-CSRF tokens")
+	activescanCmd.Flags().String("csrf-config", "", "YAML/JSON file with per-target CSRF token rules (implies --csrf)")
+	addSessionFlags(activescanCmd)
 	rootCmd.AddCommand(activescanCmd)
 
 	// proxy
@@ -49,7 +89,21 @@ func init() {
 	rootCmd.AddCommand(proxyCmd)
 
 	// test
-	testCmd.Flags().String("param", "reconsec_probe", "The parameter name to use for the probe")
+	testCmd.Flags().String("param", "reconsec_probe", "Extra query parameter probed besides the existing ones")
+	testCmd.Flags().String("request", "", "Raw HTTP/1.1 request file to probe (only §marker§ positions are probed if present)")
+	testCmd.Flags().String("scheme", "https", "Scheme for a raw request whose request line has only a path")
+	testCmd.Flags().Bool("reflection", false, "Probe input reflection, context and character survival (default when no probe is chosen)")
+	testCmd.Flags().Bool("redirect", false, "Probe redirect-like parameters for open redirects")
+	testCmd.Flags().Bool("crlf", false, "Probe parameters for CRLF / response header injection")
+	testCmd.Flags().Bool("host-header", false, "Probe Host and forwarding headers for host header injection")
+	testCmd.Flags().Bool("cors", false, "Probe CORS with crafted Origin values, including preflight requests")
+	testCmd.Flags().Bool("ssti", false, "Probe reflected inputs with arithmetic template expressions for each common engine")
+	testCmd.Flags().Bool("traversal", false, "Probe parameters for path traversal to well-known inert system files")
+	testCmd.Flags().String("list", "", "File with one target URL per line (- for stdin); results are streamed as JSON Lines")
+	testCmd.Flags().Int("concurrency", 10, "Number of URLs probed concurrently with --list or stdin")
+	testCmd.Flags().Float64("rate", 4, "Max requests per second per host with --list or stdin (0 = unlimited)")
+	testCmd.Flags().Float64("global-rate", 20, "Max requests per second across all hosts with --list or stdin (0 = unlimited)")
+	addSessionFlags(testCmd)
 	rootCmd.AddCommand(testCmd)
 }
 
@@ -92,7 +146,11 @@ var dirscanCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		baseURL := args[0]
 
-		output, err := discovery.RunDirScan(baseURL)
+		headers, err := sessionFromFlags(cmd).Headers(context.Background(), baseURL)
+		if err != nil {
+			log.Fatalf("could not establish the session: %v", err)
+		}
+		output, err := discovery.RunDirScan(baseURL, headers)
 		if err != nil {
 			// Se o erro for a dependência faltando, encerra com uma mensagem clara.
 			if strings.Contains(err.Error(), "dependência 'dirsearch' não encontrada") {
@@ -113,18 +171,119 @@ var activescanCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		url, _ := cmd.Flags().GetString("url")
 		payloads, _ := cmd.Flags().GetString("payloads")
-		sandbox, _ := cmd.Flags().GetBool("sandbox")
+		skipWAF, _ := cmd.Flags().GetBool("skip-waf")
+		harPath, _ := cmd.Flags().GetString("har")
+		requestPath, _ := cmd.Flags().GetString("request")
+		strict, _ := cmd.Flags().GetBool("strict")
+		targetsPath, _ := cmd.Flags().GetString("targets")
+		concurrency, _ := cmd.Flags().GetInt("concurrency")
+		rate, _ := cmd.Flags().GetInt("rate")
+		globalRate, _ := cmd.Flags().GetInt("global-rate")
+		maxRequests, _ := cmd.Flags().GetInt("max-requests")
+		showProgress, _ := cmd.Flags().GetBool("progress")
+		timeDelays, _ := cmd.Flags().GetFloat64Slice("time-delays")
+		timeTrials, _ := cmd.Flags().GetInt("time-trials")
+		diffTrials, _ := cmd.Flags().GetInt("diff-trials")
+		oobURL, _ := cmd.Flags().GetString("oob")
+		oobToken, _ := cmd.Flags().GetString("oob-token")
+		oobWait, _ := cmd.Flags().GetInt("oob-wait")
+		csrf, _ := cmd.Flags().GetBool("csrf")
+		csrfConfig, _ := cmd.Flags().GetString("csrf-config")
+		policyPath, _ := cmd.Flags().GetString("policy")
+		maxSafety, _ := cmd.Flags().GetString("max-safety")
+
+		var targets []string
+		if targetsPath != "" {
+			for _, t := range loadWordlist(targetsPath, nil) {
+				if t = strings.TrimSpace(t); t != "" && !strings.HasPrefix(t, "#") {
+					targets = append(targets, t)
+				}
+			}
+		}
+
+		policy, closeAudit := payloadPolicy(cmd)
+		defer closeAudit()
+
+		var requests []active.HTTPRequest
+		switch {
+		case harPath != "" && requestPath != "":
+			log.Fatal("--har and --request cannot be used together")
+		case harPath != "":
+			reqs, err := active.LoadHAR(harPath)
+			if err != nil {
+				log.Fatal(err)
+			}
+			requests = reqs
+		case requestPath != "":
+			requests = []active.HTTPRequest{rawRequestFromFlags(cmd)}
+		case url == "" && len(targets) == 0:
+			log.Fatal("either --url, --targets, --har or --request is required")
+		}
 
 		opts := active.ActiveOptions{
-			URL:            url,
-			PayloadsPath:   payloads,
-			SandboxEnabled: sandbox,
-			TimeoutSec:     20,
-			Rate:           4,
+			URL:              url,
+			PayloadsPath:     payloads,
+			Sandbox:          sandboxFromFlags(cmd),
+			Session:          sessionFromFlags(cmd),
+			TimeoutSec:       20,
+			Rate:             rate,
+			GlobalRate:       globalRate,
+			Concurrency:      concurrency,
+			MaxRequests:      maxRequests,
+			SkipWAFDetection: skipWAF,
+			Requests:         requests,
+			PathAsIs:         requestPath != "",
+			Targets:          targets,
+			StrictPayloads:   strict,
+			PayloadApproval:  policy,
+			Timing:           active.TimingOptions{Delays: timeDelays, Trials: timeTrials},
+			Differential:     active.DifferentialOptions{Trials: diffTrials},
+			OOBWaitSec:       oobWait,
+		}
+		if oobURL != "" {
+			client, err := oob.NewClient(context.Background(), oobURL, oobToken)
+			if err != nil {
+				log.Fatalf("could not reach the out-of-band server: %v", err)
+			}
+			opts.OOB = client
+		}
+		if policyPath != "" || maxSafety != "" {
+			var scanPolicy *active.ScanPolicy
+			if policyPath != "" {
+				p, err := active.LoadScanPolicy(policyPath)
+				if err != nil {
+					log.Fatal(err)
+				}
+				scanPolicy = p
+			}
+			restricted, err := scanPolicy.Restrict(maxSafety)
+			if err != nil {
+				log.Fatal(err)
+			}
+			opts.Policy = restricted
+		}
+		if csrfConfig != "" {
+			rules, err := active.LoadCSRFOptions(csrfConfig)
+			if err != nil {
+				log.Fatal(err)
+			}
+			opts.CSRF = rules
+		} else if csrf {
+			opts.CSRF = &active.CSRFOptions{}
+		}
+		if showProgress {
+			opts.Progress = func(p active.Progress) {
+				fmt.Fprintf(os.Stderr, "[%d/%d] %s %s at %s -> %d (findings: %d, host rate %.2f req/s)\n",
+					p.Done, p.Total, p.Payload, p.URL, p.Point, p.Status, p.Findings, p.HostRate)
+			}
 		}
 
-		res, err := active.RunActiveScan(opts)
-		if err != nil {
+		// Ctrl+C interrompe a varredura e imprime o resultado parcial.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		res, err := active.RunActiveScanContext(ctx, opts)
+		if err != nil && !errors.Is(err, context.Canceled) {
 			log.Fatal(err)
 		}
 		printJSON(res)
@@ -151,12 +310,35 @@ var proxyCmd = &cobra.Command{
 }
 
 var testCmd = &cobra.Command{
-	Use:   "test [url]",
-	Short: "Run a safe proof-of-concept probe for parameter reflection",
-	Args:  cobra.ExactArgs(1),
+	Use:   "test [url | --list file]",
+	Short: "Run safe proof-of-concept probes (reflection, open redirect, CRLF, host header, CORS, SSTI, path traversal)",
+	Args:  cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		url := args[0]
 		param, _ := cmd.Flags().GetString("param")
+		requestPath, _ := cmd.Flags().GetString("request")
+		listPath, _ := cmd.Flags().GetString("list")
+		var url string
+		if len(args) == 1 {
+			url = args[0]
+		}
+		if listPath != "" && (url != "" || requestPath != "") {
+			log.Fatal("--list cannot be combined with a URL or --request")
+		}
+		if listPath == "" && url == "" && requestPath == "" && stdinPiped() {
+			listPath = "-"
+		}
+
+		var request *active.HTTPRequest
+		switch {
+		case listPath != "":
+		case requestPath != "" && url != "":
+			log.Fatal("pass either a URL or --request, not both")
+		case requestPath != "":
+			req := rawRequestFromFlags(cmd)
+			request = &req
+		case url == "":
+			log.Fatal("a URL, --request or --list is required")
+		}
 
 		opts := poc.PoCOptions{
 			URL:      url,
@@ -164,16 +346,116 @@ var testCmd = &cobra.Command{
 			Token:    "__RECONSEC_TEST__",
 			Timeout:  10,
 			MaxReads: 200000,
+			Session:  sessionFromFlags(cmd),
+			Request:  request,
 		}
 
-		f, err := poc.SafeProbe(opts)
+		if listPath != "" {
+			runTestBatch(cmd, listPath, opts)
+			return
+		}
+		findings, err := poc.Run(opts, selectedProbes(cmd)...)
 		if err != nil {
 			log.Fatal(err)
 		}
-		printJSON(f)
+		printJSON(findings)
 	},
 }
 
+// runTestBatch sonda os alvos de --list (ou da entrada padrão) e imprime um
+// resultado JSON por linha assim que cada URL termina.
+func runTestBatch(cmd *cobra.Command, listPath string, opts poc.PoCOptions) {
+	concurrency, _ := cmd.Flags().GetInt("concurrency")
+	rate, _ := cmd.Flags().GetFloat64("rate")
+	globalRate, _ := cmd.Flags().GetFloat64("global-rate")
+
+	in := io.Reader(os.Stdin)
+	if listPath != "-" {
+		f, err := os.Open(listPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	// Ctrl+C para de iniciar novas URLs; as que estão em andamento terminam.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	stats, err := poc.Batch(ctx, poc.BatchOptions{
+		Options:     opts,
+		Probes:      selectedProbes(cmd),
+		Concurrency: concurrency,
+		Rate:        rate,
+		GlobalRate:  globalRate,
+	}, in, func(res poc.BatchResult) {
+		if err := enc.Encode(res); err != nil {
+			log.Fatal(err)
+		}
+	})
+	log.Printf("probed %d URLs (%d duplicates skipped, %d invalid, %d errors)",
+		stats.Probed, stats.Duplicates, stats.Invalid, stats.Errors)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatal(err)
+	}
+}
+
+// stdinPiped informa se a entrada padrão vem de um pipe ou arquivo, e não do terminal.
+func stdinPiped() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice == 0
+}
+
+// selectedProbes devolve as sondas escolhidas por flag; sem nenhuma, só a de reflexão.
+func selectedProbes(cmd *cobra.Command) []string {
+	var names []string
+	for _, name := range poc.ProbeNames {
+		if on, _ := cmd.Flags().GetBool(name); on {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		names = []string{"reflection"}
+	}
+	return names
+}
+
+// rawRequestFromFlags lê a requisição bruta de --request.
+func rawRequestFromFlags(cmd *cobra.Command) active.HTTPRequest {
+	path, _ := cmd.Flags().GetString("request")
+	scheme, _ := cmd.Flags().GetString("scheme")
+	req, err := active.LoadRawRequest(path, scheme)
+	if err != nil {
+		log.Fatalf("could not read raw request %s: %v", path, err)
+	}
+	return req
+}
+
+// payloadPolicy monta a política de aprovação de payloads a partir das flags.
+func payloadPolicy(cmd *cobra.Command) (*approval.Policy, func()) {
+	keyringPath, _ := cmd.Flags().GetString("keyring")
+	allowUnsigned, _ := cmd.Flags().GetBool("allow-unsigned")
+	auditPath, _ := cmd.Flags().GetString("audit-log")
+	engagement, _ := cmd.Flags().GetString("engagement")
+
+	policy := &approval.Policy{AllowUnsigned: allowUnsigned, Engagement: engagement}
+	kr, err := approval.LoadKeyring(keyringPath)
+	if err != nil && !allowUnsigned {
+		log.Fatalf("%v (sign payloads with 'reconsec payloads sign' or pass --allow-unsigned)", err)
+	}
+	policy.Keyring = kr
+
+	audit, err := approval.OpenAuditLog(auditPath)
+	if err != nil {
+		log.Fatalf("could not open audit log: %v", err)
+	}
+	policy.Audit = audit
+	return policy, func() { audit.Close() }
+}
+
 func loadWordlist(path string, defaultFunc func() []string) []string {
 	if path == "" {
 		return defaultFunc()
@@ -209,3 +491,53 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// sandboxFromFlags monta o backend de sandbox pedido, ou nil sem --sandbox-backend/--sandbox.
+func sandboxFromFlags(cmd *cobra.Command) active.Sandbox {
+	backend, _ := cmd.Flags().GetString("sandbox-backend")
+	if legacy, _ := cmd.Flags().GetBool("sandbox"); legacy && backend == "" {
+		backend = "docker"
+	}
+	if backend == "" {
+		return nil
+	}
+	network, _ := cmd.Flags().GetString("sandbox-network")
+	cpus, _ := cmd.Flags().GetFloat64("sandbox-cpus")
+	memory, _ := cmd.Flags().GetInt("sandbox-memory")
+	timeout, _ := cmd.Flags().GetInt("sandbox-timeout")
+	image, _ := cmd.Flags().GetString("sandbox-image")
+	maxOutput, _ := cmd.Flags().GetInt64("sandbox-max-output")
+
+	sb, err := active.NewSandbox(backend, active.SandboxConfig{
+		Network:   active.NetworkPolicy(network),
+		CPUs:      cpus,
+		MemoryMB:  memory,
+		Timeout:   time.Duration(timeout) * time.Second,
+		MaxOutput: maxOutput,
+		Image:     image,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	return sb
+}
+
+// addSessionFlags registra as flags de perfil de sessão em cmd.
+func addSessionFlags(cmd *cobra.Command) {
+	cmd.Flags().String("session", "", "Session profile file (YAML or JSON) used to scan behind a login")
+	cmd.Flags().String("profile", "", "Profile to use from the session file (optional if it has only one)")
+}
+
+// sessionFromFlags carrega o perfil de sessão pedido, ou nil sem --session.
+func sessionFromFlags(cmd *cobra.Command) *utils.Session {
+	path, _ := cmd.Flags().GetString("session")
+	if path == "" {
+		return nil
+	}
+	profile, _ := cmd.Flags().GetString("profile")
+	s, err := utils.LoadSession(path, profile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return s
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/ghostn3xus/reconsec/pkg/oob"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	oobCmd.Flags().String("listen", "127.0.0.1", "Interface the DNS and HTTP listeners bind to")
+	oobCmd.Flags().Int("http-port", 8080, "HTTP listener port (callbacks and poll API)")
+	oobCmd.Flags().Int("dns-port", 5353, "DNS listener port (UDP); -1 disables DNS")
+	oobCmd.Flags().String("domain", "oob.local", "Zone answered by the DNS listener; payloads use <id>.<domain>")
+	oobCmd.Flags().String("public-host", "", "Address announced in callback URLs and DNS answers (default: the listen address)")
+	oobCmd.Flags().String("token", "", "Bearer token required by the poll API")
+	rootCmd.AddCommand(oobCmd)
+}
+
+var oobCmd = &cobra.Command{
+	Use:   "oob",
+	Short: "Run a local out-of-band interaction server (DNS + HTTP) for blind payloads",
+	Run: func(cmd *cobra.Command, args []string) {
+		listen, _ := cmd.Flags().GetString("listen")
+		httpPort, _ := cmd.Flags().GetInt("http-port")
+		dnsPort, _ := cmd.Flags().GetInt("dns-port")
+		domain, _ := cmd.Flags().GetString("domain")
+		publicHost, _ := cmd.Flags().GetString("public-host")
+		token, _ := cmd.Flags().GetString("token")
+
+		enc := json.NewEncoder(os.Stdout)
+		srv := oob.NewServer(oob.Config{
+			ListenHost:    listen,
+			HTTPPort:      httpPort,
+			DNSPort:       dnsPort,
+			Domain:        domain,
+			PublicHost:    publicHost,
+			Token:         token,
+			OnInteraction: func(in oob.Interaction) { enc.Encode(in) },
+		})
+		if err := srv.Start(); err != nil {
+			log.Fatal(err)
+		}
+		defer srv.Close()
+
+		info := srv.Info()
+		fmt.Fprintf(os.Stderr, "oob server ready: http %s, dns %s, zone %s\n", info.HTTPURL, info.DNSAddr, info.Domain)
+		fmt.Fprintf(os.Stderr, "scan with: reconsec activescan --oob %s\n", info.HTTPURL)
+
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt)
+		<-stop
+	},
+}
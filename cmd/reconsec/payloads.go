@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghostn3xus/reconsec/pkg/active"
+	"github.com/ghostn3xus/reconsec/pkg/approval"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	payloadsKeygenCmd.Flags().String("name", "", "Approver name stored with the key")
+	payloadsKeygenCmd.Flags().String("out", "", "Output prefix; writes <out>.key and <out>.pub (default: the approver name)")
+	payloadsKeygenCmd.MarkFlagRequired("name")
+
+	payloadsSignCmd.Flags().String("key", "", "Path to the approver private key (.key)")
+	payloadsSignCmd.MarkFlagRequired("key")
+
+	payloadsVerifyCmd.Flags().String("keyring", "payloads/keyring", "Trusted public key file or directory of .pub files")
+
+	payloadsCmd.AddCommand(payloadsValidateCmd, payloadsKeygenCmd, payloadsSignCmd, payloadsVerifyCmd)
+	rootCmd.AddCommand(payloadsCmd)
+}
+
+var payloadsCmd = &cobra.Command{
+	Use:   "payloads",
+	Short: "Manage payload template files",
+}
+
+var payloadsValidateCmd = &cobra.Command{
+	Use:   "validate [path]",
+	Short: "Validate JSON/YAML payload templates and report every error with file, line and field",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := "payloads/"
+		if len(args) == 1 {
+			path = args[0]
+		}
+
+		problems, err := active.ValidatePayloads(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(problems) == 0 {
+			fmt.Printf("%s: all payload templates are valid (schema version %d)\n", path, active.PayloadSchemaVersion)
+			return
+		}
+
+		for _, p := range problems {
+			fmt.Println(p.Error())
+		}
+		fmt.Fprintf(os.Stderr, "%d problem(s) found\n", len(problems))
+		os.Exit(1)
+	},
+}
+
+var payloadsKeygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Generate an ed25519 key pair for a payload approver",
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("name")
+		out, _ := cmd.Flags().GetString("out")
+		if out == "" {
+			out = name
+		}
+
+		priv, pub, err := approval.GenerateKey(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := approval.WriteKeyPair(out, priv, pub); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("key %s for %s written to %s.key and %s.pub\n", pub.ID, name, out, out)
+		fmt.Println("add the .pub file to the keyring directory; keep the .key file private")
+	},
+}
+
+var payloadsSignCmd = &cobra.Command{
+	Use:   "sign [file|dir]...",
+	Short: "Approve payload files by signing them with an approver key",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		keyPath, _ := cmd.Flags().GetString("key")
+		key, priv, err := approval.LoadPrivateKey(keyPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, file := range payloadFileArgs(args) {
+			sig, err := approval.SignFile(file, key, priv)
+			if err != nil {
+				log.Fatalf("could not sign %s: %v", file, err)
+			}
+			fmt.Printf("signed %s (sha256 %s) as %s [%s]\n", file, sig.SHA256, sig.Signer, sig.KeyID)
+		}
+	},
+}
+
+var payloadsVerifyCmd = &cobra.Command{
+	Use:   "verify [file|dir]...",
+	Short: "Check payload file signatures against the trusted keyring",
+	Run: func(cmd *cobra.Command, args []string) {
+		keyringPath, _ := cmd.Flags().GetString("keyring")
+		if len(args) == 0 {
+			args = []string{"payloads/"}
+		}
+
+		kr, err := approval.LoadKeyring(keyringPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		failed := false
+		for _, file := range payloadFileArgs(args) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				log.Fatal(err)
+			}
+			res := kr.Verify(file, data)
+			line := fmt.Sprintf("%s: %s", file, res.Status)
+			if res.Signer != "" {
+				line += fmt.Sprintf(" (%s [%s])", res.Signer, res.KeyID)
+			}
+			if res.Detail != "" {
+				line += ": " + res.Detail
+			}
+			fmt.Println(line)
+			failed = failed || res.Status != approval.StatusTrusted
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// payloadFileArgs expande diretórios nos arquivos de payload que contêm.
+func payloadFileArgs(args []string) []string {
+	var files []string
+	for _, a := range args {
+		info, err := os.Stat(a)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !info.IsDir() {
+			files = append(files, a)
+			continue
+		}
+		entries, err := os.ReadDir(a)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, e := range entries {
+			switch strings.ToLower(filepath.Ext(e.Name())) {
+			case ".json", ".yaml", ".yml":
+				files = append(files, filepath.Join(a, e.Name()))
+			}
+		}
+	}
+	return files
+}
@@ -2,177 +2,673 @@ package active
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
-	"os"
-	"os/exec"
-	"path/filepath"
+	"net/url"
 	"strings"
 	"time"
 
+	"github.com/ghostn3xus/reconsec/pkg/approval"
+	"github.com/ghostn3xus/reconsec/pkg/oob"
 	"github.com/ghostn3xus/reconsec/pkg/report"
+	"github.com/ghostn3xus/reconsec/pkg/utils"
 )
 
-const successIndicator = "VULNERABLE"
-
 type ActiveOptions struct {
-	URL            string
-	PayloadsPath   string
-	SandboxEnabled bool
-	TimeoutSec     int
-	Rate           int
+	URL              string
+	PayloadsPath     string
+	TimeoutSec       int
+	Rate             int
+	SkipWAFDetection bool
+	StrictPayloads   bool
+	PayloadApproval  *approval.Policy
+
+	// Requests são as requisições base (de um arquivo bruto, HAR ou URL). Se
+	// vazio, uma requisição GET é criada a partir de URL.
+	Requests []HTTPRequest
+
+	// PathAsIs faz o envio nativo mandar caminho e query exatamente como estão
+	// nas requisições base (ex.: de um arquivo bruto), sem normalizar.
+	PathAsIs bool
+
+	// Sender substitui o envio padrão (cliente nativo, ou curl no Sandbox).
+	Sender Sender
+
+	// Sandbox, se definido, isola o envio dos payloads (curl dentro do backend).
+	Sandbox Sandbox
+
+	// Session, se definida, autentica todas as requisições da varredura.
+	Session *utils.Session
+
+	// Targets são URLs adicionais varridas na mesma execução.
+	Targets []string
+
+	// Rate é o limite de req/s por host; GlobalRate limita a soma de todos os
+	// hosts (0 = sem limite global).
+	GlobalRate int
+
+	// Concurrency é o número de workers enviando payloads (padrão 1).
+	Concurrency int
+
+	// MaxRequests é o orçamento total de requisições de payload (0 = sem limite).
+	MaxRequests int
+
+	// Timing configura a detecção por tempo dos templates com {{DELAY}}.
+	Timing TimingOptions
+
+	// Differential configura a análise verdadeiro/falso dos templates com false_template.
+	Differential DifferentialOptions
+
+	// Policy, se definida, filtra os templates por categoria e classe de
+	// segurança e limita codificações e pontos de injeção.
+	Policy *ScanPolicy
+
+	// CSRF, se definido, renova os tokens anti-CSRF antes de cada requisição.
+	CSRF *CSRFOptions
+
+	// OOB, se definido, fornece os endereços de {{OOB}}/{{OOB_URL}} e é
+	// consultado ao fim da varredura; cada interação vira um achado.
+	OOB *oob.Client
+
+	// OOBWaitSec é quanto esperar por interações atrasadas antes do polling (padrão 5).
+	OOBWaitSec int
+
+	// Progress, se definido, é chamado após cada tentativa enviada. As chamadas
+	// nunca são simultâneas.
+	Progress func(Progress)
+}
+
+// ScanResult é o relatório de uma varredura ativa.
+type ScanResult struct {
+	Target    string                `json:"target"`
+	Targets   []string              `json:"targets,omitempty"`
+	WAF       *WAFResult            `json:"waf,omitempty"`
+	WAFByHost map[string]*WAFResult `json:"waf_by_host,omitempty"`
+	Warnings  []string              `json:"warnings,omitempty"`
+	Findings  []report.Finding      `json:"findings"`
+	Stats     ScanStats             `json:"stats"`
+}
+
+// maxErrorSamples limita as mensagens de erro distintas guardadas nas estatísticas.
+const maxErrorSamples = 10
+
+// ScanStats resume o que foi enviado. Tentativas sem efeito e falhas de envio
+// só aparecem aqui, não como achados.
+type ScanStats struct {
+	Requests     int                      `json:"requests"`
+	Baselines    int                      `json:"baselines"`
+	Attempts     int                      `json:"attempts"`
+	Findings     int                      `json:"findings"`
+	Suppressed   int                      `json:"suppressed"`
+	Errors       int                      `json:"errors"`
+	NotSent      int                      `json:"not_sent,omitempty"`
+	TokenFetches int                      `json:"token_fetches,omitempty"`
+	ErrorSamples []string                 `json:"error_samples,omitempty"`
+	ByPayload    map[string]*PayloadStats `json:"by_payload,omitempty"`
+}
+
+// PayloadStats são as estatísticas de um template.
+type PayloadStats struct {
+	Attempts   int `json:"attempts"`
+	Findings   int `json:"findings"`
+	Suppressed int `json:"suppressed"`
+	Errors     int `json:"errors"`
 }
 
 type PayloadTemplate struct {
-	Name     string `json:"name"`
-	Category string `json:"category"`
-	Template string `json:"template"`
-	Notes    string `json:"notes,omitempty"`
+	Name     string `json:"name" yaml:"name"`
+	Category string `json:"category" yaml:"category"`
+	Template string `json:"template" yaml:"template"`
+	Notes    string `json:"notes,omitempty" yaml:"notes,omitempty"`
+
+	Request           *RequestDef `json:"request,omitempty" yaml:"request,omitempty"`
+	Matchers          []Matcher   `json:"matchers,omitempty" yaml:"matchers,omitempty"`
+	MatchersCondition string      `json:"matchers-condition,omitempty" yaml:"matchers-condition,omitempty"`
+	Extractors        []Extractor `json:"extractors,omitempty" yaml:"extractors,omitempty"`
+
+	// FalseTemplate, se definido, torna o template diferencial: Template é a
+	// condição verdadeira e FalseTemplate a falsa (ex.: "{{original}}' AND '1'='2").
+	FalseTemplate string `json:"false_template,omitempty" yaml:"false_template,omitempty"`
+
+	// Steps, se definido, transforma o template em uma sequência de requisições
+	// (ex.: adicionar ao carrinho e depois fechar o pedido); só a etapa marcada
+	// com inject recebe o payload. Exclui Request.
+	Steps []Step `json:"steps,omitempty" yaml:"steps,omitempty"`
+
+	// Encodings lista variantes extras do payload (url, double_url, html_entity,
+	// unicode, json_string, case); cada uma é enviada além da forma original.
+	Encodings []string `json:"encodings,omitempty" yaml:"encodings,omitempty"`
+
+	// Safety é a classe de segurança do template (passive, safe, intrusive ou
+	// destructive); sem ela, o template é tratado como intrusive.
+	Safety string `json:"safety,omitempty" yaml:"safety,omitempty"`
 }
 
-// LoadPayloads carrega templates de payload de um arquivo ou diretório.
-func LoadPayloads(path string) ([]PayloadTemplate, error) {
-	if strings.TrimSpace(path) == "" {
-		return nil, fmt.Errorf("payload path required")
-	}
+// LoadOptions controla a carga dos templates de payload.
+type LoadOptions struct {
+	// Strict recusa a carga se qualquer template for inválido. Fora do modo
+	// estrito, os templates inválidos são descartados e reportados.
+	Strict bool
 
-	var allPayloads []PayloadTemplate
+	// Approval exige que cada arquivo esteja assinado por um aprovador
+	// confiável e registra cada carga no log de auditoria. Sem política não há
+	// chaveiro e todo arquivo é recusado; só AllowUnsigned dispensa a assinatura.
+	Approval *approval.Policy
+}
+
+// LoadPayloads carrega templates de payload de um arquivo ou diretório,
+// verificando as assinaturas com a política de aprovação.
+func LoadPayloads(path string, policy *approval.Policy) ([]PayloadTemplate, error) {
+	payloads, _, err := LoadPayloadsWithOptions(path, LoadOptions{Approval: policy})
+	return payloads, err
+}
 
-	info, err := os.Stat(path)
+// LoadPayloadsWithOptions carrega e valida templates JSON e YAML, devolvendo
+// também os problemas dos templates descartados.
+func LoadPayloadsWithOptions(path string, opts LoadOptions) ([]PayloadTemplate, []ValidationError, error) {
+	files, err := payloadFiles(path)
 	if err != nil {
-		return nil, fmt.Errorf("could not access path %s: %w", path, err)
+		return nil, nil, err
 	}
 
-	if info.IsDir() {
-		// Se for um diretório, carrega todos os arquivos .json
-		files, err := os.ReadDir(path)
-		if err != nil {
-			return nil, fmt.Errorf("could not read directory %s: %w", path, err)
+	policy := opts.Approval
+	if policy == nil {
+		policy = &approval.Policy{}
+	}
+	loaded, problems, err := loadTemplates(files, policy)
+	if err != nil {
+		return nil, nil, err
+	}
+	if opts.Strict && len(problems) > 0 {
+		return nil, problems, fmt.Errorf("%d payload validation error(s) in %s; refusing to scan in strict mode (first: %v)", len(problems), path, problems[0])
+	}
+
+	var allPayloads []PayloadTemplate
+	for _, lt := range loaded {
+		if len(lt.errs) == 0 {
+			allPayloads = append(allPayloads, lt.PayloadTemplate)
 		}
+	}
 
-		for _, file := range files {
-			if !file.IsDir() && strings.HasSuffix(strings.ToLower(file.Name()), ".json") {
-				filePath := filepath.Join(path, file.Name())
-				payloads, err := loadPayloadsFromFile(filePath)
-				if err != nil {
-					// Loga o erro, mas continua com os outros arquivos
-					fmt.Fprintf(os.Stderr, "warning: could not load payload file %s: %v\n", filePath, err)
-					continue
-				}
-				allPayloads = append(allPayloads, payloads...)
-			}
+	if len(allPayloads) == 0 {
+		if len(problems) > 0 {
+			return nil, problems, fmt.Errorf("no valid payload templates found in %s (first error: %v)", path, problems[0])
 		}
-	} else {
-		// Se for um arquivo, carrega-o diretamente
-		payloads, err := loadPayloadsFromFile(path)
+		return nil, problems, fmt.Errorf("no payload templates found in %s", path)
+	}
+
+	return allPayloads, problems, nil
+}
+
+// RunActiveScan executa a varredura ativa sem prazo de cancelamento.
+func RunActiveScan(opts ActiveOptions) (ScanResult, error) {
+	return RunActiveScanContext(context.Background(), opts)
+}
+
+// RunActiveScanContext executa a varredura ativa. Se ctx for cancelado, o
+// resultado parcial é devolvido junto com o erro do contexto.
+func RunActiveScanContext(ctx context.Context, opts ActiveOptions) (ScanResult, error) {
+	res := ScanResult{Target: opts.URL}
+
+	requests := append([]HTTPRequest(nil), opts.Requests...)
+	urls := opts.Targets
+	if len(opts.Requests) == 0 && strings.TrimSpace(opts.URL) != "" {
+		urls = append([]string{opts.URL}, urls...)
+	}
+	for _, u := range urls {
+		base, err := RequestFromURL(u)
 		if err != nil {
-			return nil, err
+			return res, fmt.Errorf("invalid target URL %q: %w", u, err)
 		}
-		allPayloads = append(allPayloads, payloads...)
+		requests = append(requests, base)
+	}
+	if len(requests) == 0 {
+		return res, fmt.Errorf("target URL required")
+	}
+	if opts.URL == "" {
+		opts.URL = stripMarkers(requests[0]).URL
+		res.Target = opts.URL
 	}
 
-	if len(allPayloads) == 0 {
-		return nil, fmt.Errorf("no payload templates found in %s", path)
+	if opts.TimeoutSec <= 0 {
+		opts.TimeoutSec = 30
 	}
 
-	return allPayloads, nil
-}
+	if opts.Rate <= 0 {
+		opts.Rate = 1
+	}
+
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
 
-// loadPayloadsFromFile carrega payloads de um único arquivo JSON.
-func loadPayloadsFromFile(filePath string) ([]PayloadTemplate, error) {
-	f, err := os.ReadFile(filePath)
+	payloads, problems, err := LoadPayloadsWithOptions(opts.PayloadsPath, LoadOptions{Strict: opts.StrictPayloads, Approval: opts.PayloadApproval})
 	if err != nil {
-		return nil, err
+		return res, err
+	}
+	for _, p := range problems {
+		res.Warnings = append(res.Warnings, "skipped invalid payload: "+p.Error())
+	}
+	payloads, refused := opts.Policy.filter(payloads)
+	res.Warnings = append(res.Warnings, refused...)
+	if len(payloads) == 0 {
+		return res, fmt.Errorf("no payload templates allowed by the scan policy")
 	}
 
-	var arr []PayloadTemplate
-	if err := json.Unmarshal(f, &arr); err != nil {
-		return nil, err
+	sender := opts.Sender
+	if sender == nil {
+		if opts.Sandbox != nil {
+			sender = &SandboxSender{Sandbox: opts.Sandbox, Session: opts.Session}
+		} else {
+			native := NewNativeSender(opts.Session.Client(opts.TimeoutSec))
+			native.PathAsIs = opts.PathAsIs
+			native.Session = opts.Session
+			sender = native
+		}
+	}
+	sched := newScheduler(opts, sender)
+
+	// Um alvo por host, na ordem em que aparecem.
+	var origins []string
+	seen := map[string]bool{}
+	for _, r := range requests {
+		r = stripMarkers(r)
+		host := requestHost(r.URL)
+		if !seen[host] {
+			seen[host] = true
+			origins = append(origins, r.URL)
+		}
+	}
+	if len(origins) > 1 {
+		res.Targets = origins
 	}
 
-	return arr, nil
-}
+	if !opts.SkipWAFDetection {
+		for _, target := range origins {
+			waf := applyWAFDetection(ctx, &res, &opts, target, sched.host(requestHost(target)))
+			if waf == nil {
+				continue
+			}
+			if len(origins) == 1 {
+				res.WAF = waf
+				continue
+			}
+			if res.WAFByHost == nil {
+				res.WAFByHost = map[string]*WAFResult{}
+			}
+			res.WAFByHost[requestHost(target)] = waf
+		}
+	}
 
+	// Cada posição de results guarda o achado de um erro de montagem ou de um
+	// job, para que a ordem do relatório não dependa da ordem dos workers.
+	var results []*report.Finding
+	var jobs []job
+	timing := opts.Timing.withDefaults()
+	differential := opts.Differential.withDefaults()
+	baselines := sched.baselines
+	vars := map[string]string{cleanVar: randomString(8)}
+	if opts.OOB != nil {
+		vars[oobDomainVar] = opts.OOB.Info.Domain
+		vars[oobURLVar] = opts.OOB.Info.HTTPURL
+	}
+	for _, p := range payloads {
+		if p.usesOOB() && opts.OOB == nil {
+			res.Warnings = append(res.Warnings, fmt.Sprintf("skipped payload %s: it needs an out-of-band server (--oob)", p.Name))
+		}
+	}
+	for _, base := range requests {
+		for _, p := range payloads {
+			if p.usesOOB() && opts.OOB == nil {
+				continue
+			}
+			if p.isMacro() || p.isTimeBased() || p.isDifferential() {
+				var probes []job
+				var err error
+				switch {
+				case p.isMacro():
+					probes, err = planMacroJobs(base, p, vars)
+				case p.isDifferential():
+					probes, err = planDifferentialJobs(base, p, vars, differential, baselines)
+				default:
+					probes, err = planTimingJobs(base, p, vars, timing, baselines)
+				}
+				if err != nil {
+					results = append(results, &report.Finding{
+						Type:       "ActiveExecError",
+						Severity:   report.SeverityLow,
+						Confidence: report.ConfidenceLow,
+						URL:        base.URL,
+						Notes:      fmt.Sprintf("could not build request: %v (%s)", err, p.Name),
+					})
+					continue
+				}
+				for _, j := range probes {
+					if skipPoint(opts, j.attempt.point) {
+						continue
+					}
+					results = append(results, nil)
+					j.slot = len(results) - 1
+					jobs = append(jobs, j)
+				}
+				continue
+			}
 
-func RunActiveScan(opts ActiveOptions) ([]report.Finding, error) {
-	var findings []report.Finding
-	if strings.TrimSpace(opts.URL) == "" {
-		return findings, fmt.Errorf("target URL required")
+			attempts, err := planAttemptsWith(base, p, vars)
+			if err != nil {
+				results = append(results, &report.Finding{
+					Type:       "ActiveExecError",
+					Severity:   report.SeverityLow,
+					Confidence: report.ConfidenceLow,
+					URL:        base.URL,
+					Notes:      fmt.Sprintf("could not build request: %v (%s)", err, p.Name),
+				})
+				continue
+			}
+			for _, a := range attempts {
+				if skipPoint(opts, a.point) {
+					continue
+				}
+				results = append(results, nil)
+				jobs = append(jobs, job{slot: len(results) - 1, host: requestHost(a.req.URL), payload: p, attempt: a})
+			}
+		}
 	}
 
-	if !opts.SandboxEnabled {
-		return findings, fmt.Errorf("sandbox required to run active scans")
+	sched.run(ctx, jobs, results)
+	if opts.OOB != nil && ctx.Err() == nil {
+		if err := collectOOB(ctx, opts, jobs, results, sched.wasSent); err != nil {
+			res.Warnings = append(res.Warnings, fmt.Sprintf("out-of-band polling failed: %v", err))
+		}
 	}
 
-	if opts.TimeoutSec <= 0 {
-		opts.TimeoutSec = 30
+	for _, f := range results {
+		if f != nil {
+			res.Findings = append(res.Findings, *f)
+		}
+	}
+	res.Stats = sched.stats
+	res.Stats.Baselines = baselines.requests()
+	res.Stats.NotSent = sched.skipped
+	for _, j := range jobs {
+		if f := results[j.slot]; f != nil && f.Type == "VulnerabilityFound" {
+			res.Stats.ByPayload[j.payload.Name].Findings++
+		}
+	}
+	res.Stats.Findings = len(res.Findings)
+	res.Warnings = append(res.Warnings, sched.backoffWarnings()...)
+	if sched.skipped > 0 {
+		res.Warnings = append(res.Warnings, fmt.Sprintf("request budget of %d exhausted; %d attempt(s) not sent", opts.MaxRequests, sched.skipped))
+	}
+	if err := ctx.Err(); err != nil {
+		res.Warnings = append(res.Warnings, fmt.Sprintf("scan cancelled after %d of %d attempt(s)", sched.done, len(jobs)))
+		return res, err
 	}
+	return res, nil
+}
 
-	if opts.Rate <= 0 {
-		opts.Rate = 1
+// skipPoint informa se a tentativa no ponto deve ficar de fora: o próprio token
+// anti-CSRF ou um ponto além da intensidade da política.
+func skipPoint(opts ActiveOptions, point string) bool {
+	if opts.CSRF != nil && opts.CSRF.skips(point) {
+		return true
 	}
+	return opts.Policy != nil && opts.Policy.skips(point)
+}
 
-	payloads, err := LoadPayloads(opts.PayloadsPath)
+// evaluateAttempt compara a resposta de uma tentativa com a linha de base do
+// ponto de injeção. Só vira achado o que casou sem casar também na linha de base,
+// ou uma resposta que diverge claramente dela.
+func evaluateAttempt(p PayloadTemplate, a attempt, ex *Exchange, baseline []*Exchange) evaluation {
+	matched, names, err := p.MatchResponse(ex, a.vars)
 	if err != nil {
-		return findings, err
+		return evaluation{outcome: outcomeError, err: err}
+	}
+	base, anomaly := compareBaseline(ex, baseline, a.vars)
+
+	ev := ex.Evidence()
+	ev.Baseline = base
+	ev.Extracted = p.Extract(ex)
+	if matched {
+		if ok, _, _ := p.MatchResponse(baseline[0], a.vars); ok {
+			return evaluation{outcome: outcomeSuppressed}
+		}
+		ev.Matcher = strings.Join(names, ",")
+		ev.Excerpt = p.matchExcerpt(ex, a.vars)
+		return evaluation{outcome: outcomeFinding, finding: &report.Finding{
+			Type:       "VulnerabilityFound",
+			Severity:   report.SeverityHigh,
+			Confidence: report.ConfidenceHigh,
+			URL:        a.req.URL,
+			Notes:      fmt.Sprintf("Payload '%s' at %s matched %s.", p.Name, a.point, ev.Matcher),
+			Evidence:   ev,
+		}}
+	}
+	if anomaly == "" {
+		return evaluation{outcome: outcomeMiss}
 	}
+	ev.Matcher = "baseline-diff"
+	ev.Excerpt = responseHead(ex)
+	return evaluation{outcome: outcomeFinding, finding: &report.Finding{
+		Type:       "ResponseAnomaly",
+		Severity:   report.SeverityMedium,
+		Confidence: report.ConfidenceLow,
+		URL:        a.req.URL,
+		Notes:      fmt.Sprintf("Payload '%s' at %s changed the response: %s.", p.Name, a.point, anomaly),
+		Evidence:   ev,
+	}}
+}
 
-	marker := "__RECONSEC_ACTIVE_MARKER__" + time.Now().Format("150405")
-	sleepInterval := time.Second / time.Duration(opts.Rate)
-	timeout := time.Duration(opts.TimeoutSec) * time.Second
+type attempt struct {
+	point string
+	req   HTTPRequest
+	vars  map[string]string
 
-	for _, p := range payloads {
-		payload := strings.ReplaceAll(p.Template, "{{INJECT}}", marker)
+	// clean é a mesma requisição com um valor benigno no lugar do payload.
+	clean HTTPRequest
 
-		ctx, cancel := context.WithTimeout(context.Background(), timeout)
-		cmd := exec.CommandContext(ctx, "bash", "scripts/run_payload_in_sandbox.sh", opts.URL, payload)
+	// redo e redoClean repetem a injeção do payload e do valor benigno sobre
+	// outra renderização da mesma requisição (etapas de macro).
+	redo, redoClean func(HTTPRequest) (HTTPRequest, error)
+}
+
+// planAttempts monta as requisições de um template sobre a requisição base. Se a
+// definição de requisição do template tiver {{INJECT}}, o payload vai só ali;
+// caso contrário, é aplicado a cada ponto de injeção. Cada requisição leva uma
+// renderização própria do payload e cada variante de codificação é uma tentativa.
+func planAttempts(base HTTPRequest, p PayloadTemplate) ([]attempt, error) {
+	return planAttemptsWith(base, p, nil)
+}
 
-		output, err := cmd.CombinedOutput()
-		cancel()
+// planAttemptsWith é planAttempts com variáveis extras na renderização do payload.
+func planAttemptsWith(base HTTPRequest, p PayloadTemplate, extra map[string]string) ([]attempt, error) {
+	req := base
+	var points []InjectionPoint
+	if def := p.Request; def != nil {
+		built, err := buildTemplateRequest(base, def)
+		if err != nil {
+			return nil, err
+		}
+		req = built
+	}
+	templated := p.Request != nil && p.Request.hasInject()
+	if !templated {
+		points = scanPoints(req)
+	}
 
-		outputStr := string(output)
+	host := ""
+	if u, err := url.Parse(req.URL); err == nil {
+		host = u.Host
+	}
 
+	var out []attempt
+	render := func(point, original string, inject func(r HTTPRequest, v PayloadVariant) (HTTPRequest, error)) error {
+		vars := map[string]string{"original": original}
+		for k, v := range extra {
+			vars[k] = v
+		}
+		clean := vars[cleanVar]
+		if clean == "" {
+			clean = randomString(8)
+		}
+		cleanVariant := PayloadVariant{Encoding: "raw", Value: clean, Vars: vars}
+		cleanReq, err := inject(req, cleanVariant)
 		if err != nil {
-			note := err.Error()
-			if errors.Is(err, context.DeadlineExceeded) {
-				note = "payload execution timed out"
-			}
+			return fmt.Errorf("could not inject at %s: %w", point, err)
+		}
 
-			findings = append(findings, report.Finding{
-				Type:       "ActiveExecError",
-				Severity:   report.SeverityLow,
-				Confidence: report.ConfidenceLow,
-				URL:        opts.URL,
-				Notes:      fmt.Sprintf("%s (%s)", note, p.Name),
+		variants, err := p.RenderPayload(host, vars)
+		if err != nil {
+			return err
+		}
+		for _, v := range variants {
+			v := v
+			r, err := inject(req, v)
+			if err != nil {
+				return fmt.Errorf("could not inject at %s: %w", point, err)
+			}
+			r.tokenSource = &cleanReq
+			label := point
+			if v.Encoding != "raw" {
+				label += " [" + v.Encoding + "]"
+			}
+			out = append(out, attempt{
+				point: label, req: r, vars: v.Vars, clean: cleanReq,
+				redo: func(r HTTPRequest) (HTTPRequest, error) {
+					out, err := inject(r, v)
+					if err != nil {
+						return out, err
+					}
+					clean, err := inject(r, cleanVariant)
+					if err == nil {
+						out.tokenSource = &clean
+					}
+					return out, nil
+				},
+				redoClean: func(r HTTPRequest) (HTTPRequest, error) { return inject(r, cleanVariant) },
 			})
+		}
+		return nil
+	}
+
+	if templated {
+		err := render("template", "", func(r HTTPRequest, v PayloadVariant) (HTTPRequest, error) {
+			return stripMarkers(injectTemplateRequest(r, v)), nil
+		})
+		return out, err
+	}
+	for _, point := range points {
+		point := point
+		if err := render(point.String(), point.Original, func(r HTTPRequest, v PayloadVariant) (HTTPRequest, error) {
+			return point.Apply(r, v.Value)
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
 
-			continue
+// injectTemplateRequest coloca o payload nos {{INJECT}} da requisição do
+// template. Na URL, {{INJECT}} sem funções é codificado para query.
+func injectTemplateRequest(req HTTPRequest, v PayloadVariant) HTTPRequest {
+	out := req.clone()
+	vars := map[string]string{}
+	for k, val := range v.Vars {
+		vars[k] = val
+	}
+	vars["INJECT"] = v.Value
+
+	out.URL = strings.ReplaceAll(out.URL, "{{INJECT}}", "{{INJECT|urlencode}}")
+	out.URL, _ = renderString(out.URL, vars)
+	for k, vv := range out.Header {
+		for i, h := range vv {
+			vv[i], _ = renderString(h, vars)
 		}
+		out.Header[k] = vv
+	}
+	body, _ := renderString(string(out.Body), vars)
+	out.Body = []byte(body)
+	return out
+}
 
-		if strings.Contains(outputStr, successIndicator) {
-			findings = append(findings, report.Finding{
-				Type:       "VulnerabilityFound",
-				Severity:   report.SeverityHigh,
-				Confidence: report.ConfidenceHigh,
-				URL:        opts.URL,
-				Notes:      fmt.Sprintf("Payload '%s' triggered a success indicator.", p.Name),
-				Snippet:    outputStr,
-			})
+func (d *RequestDef) hasInject() bool {
+	if hasInject(d.Path) || hasInject(d.Body) {
+		return true
+	}
+	for k, v := range d.Headers {
+		if hasInject(k) || hasInject(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// buildTemplateRequest aplica método, caminho, cabeçalhos e corpo do template
+// sobre a requisição base. Path aceita {{BaseURL}}, um caminho absoluto ("/x")
+// que substitui o da base ou uma URL completa.
+func buildTemplateRequest(base HTTPRequest, def *RequestDef) (HTTPRequest, error) {
+	out := base.clone()
+	if def.Method != "" {
+		out.Method = strings.ToUpper(def.Method)
+	}
+
+	if def.Path != "" {
+		path := strings.ReplaceAll(def.Path, "{{BaseURL}}", strings.TrimRight(base.URL, "/"))
+		if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+			out.URL = path
 		} else {
-			findings = append(findings, report.Finding{
-				Type:       "ActiveAttempt",
-				Severity:   report.SeverityLow,
-				Confidence: report.ConfidenceLow,
-				URL:        opts.URL,
-				Notes:      "Executed payload in sandbox: " + p.Name,
-			})
+			u, err := url.Parse(base.URL)
+			if err != nil {
+				return out, err
+			}
+			out.URL = u.Scheme + "://" + u.Host + "/" + strings.TrimLeft(path, "/")
 		}
+	}
 
-		if sleepInterval > 0 {
-			time.Sleep(sleepInterval)
+	for k, v := range def.Headers {
+		out.Header.Set(k, v)
+	}
+	if def.Body != "" {
+		out.Body = []byte(def.Body)
+	}
+	return out, nil
+}
+
+// scanPoints enumera os pontos de injeção da requisição base. Sem nenhum
+// parâmetro disponível, injeta no parâmetro de query "p", como o scanner sempre fez.
+func scanPoints(base HTTPRequest) []InjectionPoint {
+	points := EnumerateInjectionPoints(base)
+	for _, p := range points {
+		if p.Kind != InjectPath && p.Kind != InjectHeader {
+			return points
 		}
 	}
+	return append(points, InjectionPoint{Kind: InjectQuery, Name: "p"})
+}
+
+// applyWAFDetection registra o WAF/CDN do alvo e, se houver bloqueio ativo,
+// reduz a taxa do host para não disparar limites e avisa que os resultados
+// podem estar filtrados.
+func applyWAFDetection(ctx context.Context, res *ScanResult, opts *ActiveOptions, target string, h *hostState) *WAFResult {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(opts.TimeoutSec)*time.Second)
+	defer cancel()
 
-	return findings, nil
+	host := requestHost(target)
+	waf, err := DetectWAF(ctx, opts.Session.Client(opts.TimeoutSec), target)
+	if err != nil {
+		res.Warnings = append(res.Warnings, fmt.Sprintf("WAF detection failed for %s: %v", host, err))
+		return nil
+	}
+
+	if !waf.Detected {
+		return waf
+	}
+	if len(waf.WAF) > 0 || waf.Blocking {
+		res.Warnings = append(res.Warnings, fmt.Sprintf("a WAF appears to filter requests to %s; results may be incomplete", host))
+	}
+	if waf.Blocking && opts.Rate > 1 {
+		rate := opts.Rate / 2
+		h.limit(float64(rate))
+		res.Warnings = append(res.Warnings, fmt.Sprintf("rate for %s lowered to %d req/s because malicious-looking requests are blocked", host, rate))
+	}
+	return waf
 }
@@ -0,0 +1,112 @@
+package active
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/ghostn3xus/reconsec/pkg/report"
+)
+
+// cleanVar é a variável com o valor benigno que substitui o payload na linha de
+// base de cada ponto de injeção. É a mesma em toda a varredura, para que
+// templates diferentes compartilhem a linha de base do mesmo ponto.
+const cleanVar = "clean"
+
+const (
+	// baselineSamples é o número de respostas limpas por ponto de injeção.
+	baselineSamples = 2
+	// anomalySimilarity é a semelhança abaixo da qual uma resposta sem matcher
+	// é considerada diferente da linha de base.
+	anomalySimilarity = 0.5
+	// stableBaseline é a semelhança mínima entre as amostras da linha de base
+	// para que a comparação por semelhança seja confiável.
+	stableBaseline = 0.95
+)
+
+// baselineCache envia cada requisição limpa uma única vez por quantidade de
+// amostras e guarda as respostas para todas as tentativas que comparam com ela.
+// Falhas não ficam em cache: a próxima tentativa do ponto completa as amostras
+// que faltam.
+type baselineCache struct {
+	mu      sync.Mutex
+	entries map[baselineKey]*baselineEntry
+	sent    int
+}
+
+type baselineKey struct {
+	request string
+	n       int
+}
+
+type baselineEntry struct {
+	// fill serializa o envio das amostras; é um canal para que quem espera
+	// desista quando o próprio contexto for cancelado.
+	fill    chan struct{}
+	samples []*Exchange
+}
+
+func (c *baselineCache) get(ctx context.Context, req HTTPRequest, n int, send sendFunc) ([]*Exchange, error) {
+	c.mu.Lock()
+	if c.entries == nil {
+		c.entries = map[baselineKey]*baselineEntry{}
+	}
+	k := baselineKey{req.URL + "\x00" + req.Raw(), n}
+	e, ok := c.entries[k]
+	if !ok {
+		e = &baselineEntry{fill: make(chan struct{}, 1)}
+		c.entries[k] = e
+	}
+	c.mu.Unlock()
+
+	select {
+	case e.fill <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-e.fill }()
+
+	for len(e.samples) < n {
+		ex, err := send(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		e.samples = append(e.samples, ex)
+		c.mu.Lock()
+		c.sent++
+		c.mu.Unlock()
+	}
+	return e.samples, nil
+}
+
+// requests devolve quantas requisições de linha de base foram enviadas.
+func (c *baselineCache) requests() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sent
+}
+
+// compareBaseline resume a diferença entre a resposta da tentativa e a linha de
+// base do ponto e informa se ela é uma anomalia: erro de servidor que a linha de
+// base não tem, ou corpo muito diferente de uma linha de base estável.
+func compareBaseline(ex *Exchange, baseline []*Exchange, vars map[string]string) (*report.BaselineEvidence, string) {
+	b := baseline[0]
+	ev := &report.BaselineEvidence{
+		Request:    b.Request.Raw(),
+		Status:     b.Status,
+		Length:     len(b.Body),
+		Stability:  1,
+		Similarity: responseSimilarity(ex, b, vars, nil),
+	}
+	if len(baseline) > 1 {
+		ev.Stability = responseSimilarity(baseline[0], baseline[1], nil, nil)
+	}
+
+	switch {
+	case ex.Status >= 500 && b.Status < 500:
+		return ev, fmt.Sprintf("status %d vs %d on the baseline", ex.Status, b.Status)
+	case ex.Status == b.Status && ev.Stability >= stableBaseline && ev.Similarity < anomalySimilarity:
+		return ev, fmt.Sprintf("body similarity %.2f to a stable baseline", ev.Similarity)
+	}
+	return ev, ""
+}
@@ -0,0 +1,115 @@
+package active
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBaselineEvidenceAndExcerpt(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "<html>%s<p>%s</p></html>", strings.Repeat("x", 200), r.URL.Query().Get("q"))
+	}))
+	defer srv.Close()
+
+	dir := writePayloads(t, `[{"name":"m","category":"marker","template":"<b>{{INJECT}}</b>"}]`)
+	res, err := RunActiveScan(ActiveOptions{URL: srv.URL + "/?q=1", PayloadsPath: dir, PayloadApproval: unsigned, Rate: 1000, SkipWAFDetection: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Findings) != 1 {
+		t.Fatalf("expected one finding, got %+v", res.Findings)
+	}
+	ev := res.Findings[0].Evidence
+	if ev.Matcher != "reflection" || !strings.HasPrefix(ev.Excerpt, "...") || !strings.Contains(ev.Excerpt, "<p><b>__RECONSEC_") || len(ev.Excerpt) > 250 {
+		t.Fatalf("unexpected matcher/excerpt %q %q", ev.Matcher, ev.Excerpt)
+	}
+	if ev.Baseline == nil || ev.Baseline.Status != 200 || ev.Baseline.Stability != 1 || !strings.HasPrefix(ev.Baseline.Request, "GET /?q=") {
+		t.Fatalf("unexpected baseline evidence %+v", ev.Baseline)
+	}
+	if st := res.Stats; st.Requests != 3 || st.Baselines != 2 || st.Attempts != 1 || st.Findings != 1 || st.ByPayload["m"].Findings != 1 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
+
+func TestBaselineSuppressesAndFlagsAnomalies(t *testing.T) {
+	// Erro 500 para qualquer aspa; a página sempre contém "error" no rodapé.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Query().Get("q"), "'") {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		fmt.Fprint(w, "<html>results<footer>error reporting</footer></html>")
+	}))
+	defer srv.Close()
+
+	dir := writePayloads(t, `[
+  {"name":"noisy","category":"sqli","template":"x{{INJECT}}","matchers":[{"name":"word-error","type":"word","words":["error"]}]},
+  {"name":"quote","category":"sqli","template":"'{{INJECT}}","matchers":[{"name":"never","type":"word","words":["ORA-00933"]}]}
+]`)
+	res, err := RunActiveScan(ActiveOptions{URL: srv.URL + "/?q=1", PayloadsPath: dir, PayloadApproval: unsigned, Rate: 1000, SkipWAFDetection: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Findings) != 1 {
+		t.Fatalf("expected only the anomaly, got %+v", res.Findings)
+	}
+	f := res.Findings[0]
+	if f.Type != "ResponseAnomaly" || f.Evidence.Matcher != "baseline-diff" || !strings.Contains(f.Notes, "status 500 vs 200") {
+		t.Fatalf("unexpected anomaly %+v", f)
+	}
+	if st := res.Stats; st.Suppressed != 1 || st.ByPayload["noisy"].Suppressed != 1 || st.Baselines != 2 {
+		t.Fatalf("the matcher that also matches the baseline must be suppressed, got %+v", st)
+	}
+}
+
+func TestBaselineCacheRetriesFailures(t *testing.T) {
+	var c baselineCache
+	req := HTTPRequest{Method: "GET", URL: "http://t/?q=clean"}
+	calls := 0
+	send := func(ctx context.Context, req HTTPRequest) (*Exchange, error) {
+		calls++
+		if calls == 2 {
+			return nil, errors.New("connection reset")
+		}
+		return &Exchange{Request: req, Status: 200}, nil
+	}
+
+	if _, err := c.get(context.Background(), req, 2, send); err == nil {
+		t.Fatal("expected the transient error on the second sample")
+	}
+	samples, err := c.get(context.Background(), req, 2, send)
+	if err != nil || len(samples) != 2 {
+		t.Fatalf("a failed baseline must be retried, got %d sample(s) (%v)", len(samples), err)
+	}
+	if calls != 3 || c.requests() != 2 {
+		t.Fatalf("only the missing sample must be resent, got %d call(s) and %d baseline(s)", calls, c.requests())
+	}
+	if _, err := c.get(context.Background(), req, 2, send); err != nil || calls != 3 {
+		t.Fatalf("a complete baseline must come from the cache, got %d call(s) (%v)", calls, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	other := HTTPRequest{Method: "GET", URL: "http://t/?p=clean"}
+	busy := &baselineEntry{fill: make(chan struct{}, 1)}
+	busy.fill <- struct{}{} // outra tentativa está enviando a linha de base
+	c.entries[baselineKey{other.URL + "\x00" + other.Raw(), 2}] = busy
+	if _, err := c.get(ctx, other, 2, send); !errors.Is(err, context.Canceled) {
+		t.Fatalf("a waiting caller must give up with its own context, got %v", err)
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	data := strings.Repeat("a", 100) + "MATCH" + strings.Repeat("é", 100)
+	got := excerpt(data, 100, 105)
+	if !strings.HasPrefix(got, "...") || !strings.HasSuffix(got, "...") || !strings.Contains(got, "MATCH") || !strings.Contains(got, "é") {
+		t.Fatalf("unexpected excerpt %q", got)
+	}
+	if got := excerpt("short", 0, 5); got != "short" {
+		t.Fatalf("short data must not be cut, got %q", got)
+	}
+}
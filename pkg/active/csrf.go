@@ -0,0 +1,434 @@
+package active
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ghostn3xus/reconsec/pkg/report"
+	"gopkg.in/yaml.v3"
+)
+
+// CSRFOptions ativa a renovação de tokens anti-CSRF: antes de cada requisição a
+// página de origem é buscada e os tokens encontrados substituem os da requisição.
+type CSRFOptions struct {
+	// Rules configuram onde buscar e onde colocar o token de cada alvo. As URLs
+	// sem regra usam a detecção automática.
+	Rules []CSRFRule `json:"rules" yaml:"rules"`
+}
+
+// CSRFRule descreve o token de um alvo.
+type CSRFRule struct {
+	// Target é a URL (ou o host, com porta opcional) a que a regra se aplica.
+	// O host e a porta são comparados exatamente e o caminho, por segmentos.
+	Target string `json:"target" yaml:"target"`
+
+	// Source é a página buscada para obter o token (padrão: a URL da requisição).
+	Source string `json:"source,omitempty" yaml:"source,omitempty"`
+
+	// Token é o nome do token na página: campo oculto, meta tag, cookie ou
+	// cabeçalho de resposta, conforme From.
+	Token string `json:"token,omitempty" yaml:"token,omitempty"`
+
+	// From restringe onde o token é procurado: input, meta, cookie, header ou
+	// regex (vazio = input, meta e cookie, nessa ordem).
+	From string `json:"from,omitempty" yaml:"from,omitempty"`
+
+	// Pattern é a expressão regular com um grupo usada quando From é regex.
+	Pattern string `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+
+	// Param é o campo da requisição (query, formulário ou JSON) que recebe o
+	// token; Header é o cabeçalho. Sem nenhum dos dois, Param é Token.
+	Param  string `json:"param,omitempty" yaml:"param,omitempty"`
+	Header string `json:"header,omitempty" yaml:"header,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// LoadCSRFOptions lê as regras de CSRF de um arquivo YAML ou JSON.
+func LoadCSRFOptions(path string) (*CSRFOptions, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var opts CSRFOptions
+	if err := yaml.Unmarshal(data, &opts); err != nil {
+		return nil, fmt.Errorf("invalid CSRF config %s: %w", filepath.Base(path), err)
+	}
+	if err := opts.compile(); err != nil {
+		return nil, fmt.Errorf("invalid CSRF config %s: %w", filepath.Base(path), err)
+	}
+	return &opts, nil
+}
+
+func (o *CSRFOptions) compile() error {
+	for i := range o.Rules {
+		r := &o.Rules[i]
+		if r.Target == "" {
+			return fmt.Errorf("rule %d: target is required", i+1)
+		}
+		if _, err := parseCSRFTarget(r.Target); err != nil {
+			return fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		switch r.From {
+		case "", "input", "meta", "cookie", "header":
+			if r.Token == "" {
+				return fmt.Errorf("rule %d: token is required", i+1)
+			}
+		case "regex":
+			re, err := regexp.Compile(r.Pattern)
+			if err != nil {
+				return fmt.Errorf("rule %d: %w", i+1, err)
+			}
+			if re.NumSubexp() < 1 {
+				return fmt.Errorf("rule %d: pattern needs a capture group", i+1)
+			}
+			if r.Param == "" && r.Header == "" && r.Token == "" {
+				return fmt.Errorf("rule %d: param or header is required", i+1)
+			}
+			r.re = re
+		default:
+			return fmt.Errorf("rule %d: unknown token source %q", i+1, r.From)
+		}
+	}
+	return nil
+}
+
+// rule devolve a regra de maior prefixo que cobre rawURL.
+func (o *CSRFOptions) rule(rawURL string) *CSRFRule {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	var best *CSRFRule
+	for i := range o.Rules {
+		r := &o.Rules[i]
+		if !r.covers(u) {
+			continue
+		}
+		if best == nil || len(r.Target) > len(best.Target) {
+			best = r
+		}
+	}
+	return best
+}
+
+// parseCSRFTarget lê o alvo de uma regra; um alvo sem esquema é só host[:porta][/caminho].
+func parseCSRFTarget(target string) (*url.URL, error) {
+	raw := target
+	if !strings.Contains(raw, "://") {
+		raw = "//" + raw
+	}
+	t, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target %q: %w", target, err)
+	}
+	if t.Hostname() == "" {
+		return nil, fmt.Errorf("invalid target %q: missing host", target)
+	}
+	return t, nil
+}
+
+// covers informa se u está no alvo da regra: mesmo esquema (se declarado), mesmo
+// host, mesma porta (se declarada) e caminho dentro do caminho do alvo.
+func (r *CSRFRule) covers(u *url.URL) bool {
+	t, err := parseCSRFTarget(r.Target)
+	if err != nil {
+		return false
+	}
+	if t.Scheme != "" && !strings.EqualFold(t.Scheme, u.Scheme) {
+		return false
+	}
+	if !strings.EqualFold(t.Hostname(), u.Hostname()) {
+		return false
+	}
+	if t.Port() != "" && t.Port() != effectivePort(u) {
+		return false
+	}
+	prefix := strings.TrimSuffix(t.Path, "/")
+	return prefix == "" || u.Path == prefix || strings.HasPrefix(u.Path, prefix+"/")
+}
+
+// effectivePort devolve a porta de u, ou a padrão do esquema.
+func effectivePort(u *url.URL) string {
+	if p := u.Port(); p != "" {
+		return p
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	}
+	return ""
+}
+
+// csrfNameRe reconhece os nomes usuais de tokens anti-CSRF (csrf_token,
+// authenticity_token, __RequestVerificationToken, XSRF-TOKEN etc.).
+var csrfNameRe = regexp.MustCompile(`(?i)csrf|xsrf|authenticity_token|requestverificationtoken|anti-?forgery|^_?token$|^nonce$`)
+
+// skips informa se point é o próprio token: injetar nele não faz sentido,
+// pois o valor é substituído antes do envio.
+func (o *CSRFOptions) skips(point string) bool {
+	kind, name, _ := strings.Cut(point, ":")
+	if InjectionKind(kind) == InjectPath {
+		return false
+	}
+	name, _, _ = strings.Cut(name, "#")
+	name = leafName(name)
+	if csrfNameRe.MatchString(name) {
+		return true
+	}
+	for _, r := range o.Rules {
+		if strings.EqualFold(name, r.Param) || strings.EqualFold(name, r.Header) || (r.Param == "" && r.Header == "" && name == r.Token) {
+			return true
+		}
+	}
+	return false
+}
+
+// csrfToken é um token encontrado na página de origem.
+type csrfToken struct {
+	name, from, value string
+}
+
+// refresh busca a página de origem e atualiza os tokens de req. Sem Source na
+// regra, a página é a requisição sem o payload (tokenSource), para que a busca
+// não envie o payload uma segunda vez. fetch envia a busca pelos limites do scanner.
+func (o *CSRFOptions) refresh(ctx context.Context, req HTTPRequest, fetch sendFunc) (HTTPRequest, *report.CSRFEvidence, error) {
+	rule := o.rule(req.URL)
+	from := req
+	if req.tokenSource != nil {
+		from = *req.tokenSource
+	}
+	source := from.URL
+	if rule != nil && rule.Source != "" {
+		source = rule.Source
+	}
+
+	page := HTTPRequest{Method: http.MethodGet, URL: source, Header: from.Header.Clone()}
+	if page.Header == nil {
+		page.Header = http.Header{}
+	}
+	page.Header.Del("Content-Type")
+	ex, err := fetch(ctx, page)
+	if err != nil {
+		return req, nil, fmt.Errorf("csrf: could not fetch token source %s: %w", source, err)
+	}
+
+	out := req.clone()
+	ev := &report.CSRFEvidence{Source: source, Status: ex.Status}
+
+	// Cookies novos da página (sessão e tokens double-submit) acompanham a requisição.
+	fresh := (&http.Response{Header: ex.Header}).Cookies()
+	for _, c := range fresh {
+		out = setCookie(out, c.Name, c.Value)
+	}
+
+	var tokens []csrfToken
+	if rule != nil {
+		if t, ok := rule.find(ex, fresh); ok {
+			tokens = append(tokens, t)
+		}
+	} else {
+		tokens = detectCSRFTokens(ex, fresh, out)
+	}
+
+	for _, t := range tokens {
+		var placed []string
+		if rule != nil {
+			out, placed = rule.place(out, t)
+		} else {
+			out, placed = placeDetected(out, t)
+		}
+		ev.Tokens = append(ev.Tokens, report.CSRFToken{Name: t.name, From: t.from, Value: t.value, Placed: placed})
+	}
+	return out, ev, nil
+}
+
+// find extrai o token configurado na regra.
+func (r *CSRFRule) find(ex *Exchange, cookies []*http.Cookie) (csrfToken, bool) {
+	body := string(ex.Body)
+	switch r.From {
+	case "regex":
+		if m := r.re.FindStringSubmatch(body); m != nil {
+			return csrfToken{name: r.Token, from: "regex", value: m[1]}, true
+		}
+		return csrfToken{}, false
+	case "header":
+		if v := ex.Header.Get(r.Token); v != "" {
+			return csrfToken{name: r.Token, from: "header", value: v}, true
+		}
+		return csrfToken{}, false
+	}
+
+	for _, t := range pageTokens(body, cookies) {
+		if t.name == r.Token && (r.From == "" || r.From == t.from) {
+			return t, true
+		}
+	}
+	return csrfToken{}, false
+}
+
+// place coloca o token nos locais configurados da regra.
+func (r *CSRFRule) place(req HTTPRequest, t csrfToken) (HTTPRequest, []string) {
+	var placed []string
+	if r.Header != "" {
+		req.Header.Set(r.Header, t.value)
+		placed = append(placed, "header:"+r.Header)
+	}
+	param := r.Param
+	if param == "" && r.Header == "" {
+		param = t.name
+	}
+	if param != "" {
+		var where []string
+		req, where = setField(req, param, t.value, true)
+		placed = append(placed, where...)
+	}
+	return req, placed
+}
+
+// detectCSRFTokens devolve os tokens da página com nome de token anti-CSRF, e
+// os cookies desse tipo já presentes na requisição (padrão cookie-para-cabeçalho).
+func detectCSRFTokens(ex *Exchange, cookies []*http.Cookie, req HTTPRequest) []csrfToken {
+	var out []csrfToken
+	seen := map[string]bool{}
+	for _, t := range pageTokens(string(ex.Body), cookies) {
+		if csrfNameRe.MatchString(t.name) && !seen[t.from+t.name] {
+			seen[t.from+t.name] = true
+			out = append(out, t)
+		}
+	}
+	for _, c := range parseCookieHeader(req.Header.Get("Cookie")) {
+		if csrfNameRe.MatchString(c[0]) && !seen["cookie"+c[0]] {
+			seen["cookie"+c[0]] = true
+			out = append(out, csrfToken{name: c[0], from: "cookie", value: c[1]})
+		}
+	}
+	return out
+}
+
+// placeDetected substitui um token detectado nos campos de mesmo nome da
+// requisição. Tokens de cookie e meta tag também renovam os cabeçalhos de token
+// já presentes (ex.: X-XSRF-TOKEN, X-CSRF-Token).
+func placeDetected(req HTTPRequest, t csrfToken) (HTTPRequest, []string) {
+	var placed []string
+	if t.from != "cookie" {
+		req, placed = setField(req, t.name, t.value, false)
+	}
+	if t.from == "input" {
+		return req, placed
+	}
+	for _, k := range sortedHeaderKeys(req.Header) {
+		if skippedHeaders[k] || !csrfNameRe.MatchString(k) {
+			continue
+		}
+		req.Header.Set(k, t.value)
+		placed = append(placed, "header:"+k)
+	}
+	return req, placed
+}
+
+var (
+	inputTagRe = regexp.MustCompile(`(?is)<input\b[^>]*>`)
+	metaTagRe  = regexp.MustCompile(`(?is)<meta\b[^>]*>`)
+	tagAttrRe  = regexp.MustCompile(`(?is)([a-z_:-]+)\s*=\s*("[^"]*"|'[^']*'|[^\s>]+)`)
+)
+
+// pageTokens lista os campos ocultos, as meta tags e os cookies de uma página.
+func pageTokens(body string, cookies []*http.Cookie) []csrfToken {
+	var out []csrfToken
+	for _, tag := range inputTagRe.FindAllString(body, -1) {
+		attrs := tagAttrs(tag)
+		if strings.EqualFold(attrs["type"], "hidden") && attrs["name"] != "" {
+			out = append(out, csrfToken{name: attrs["name"], from: "input", value: attrs["value"]})
+		}
+	}
+	for _, tag := range metaTagRe.FindAllString(body, -1) {
+		attrs := tagAttrs(tag)
+		if attrs["name"] != "" && attrs["content"] != "" {
+			out = append(out, csrfToken{name: attrs["name"], from: "meta", value: attrs["content"]})
+		}
+	}
+	for _, c := range cookies {
+		out = append(out, csrfToken{name: c.Name, from: "cookie", value: c.Value})
+	}
+	return out
+}
+
+func tagAttrs(tag string) map[string]string {
+	attrs := map[string]string{}
+	for _, m := range tagAttrRe.FindAllStringSubmatch(tag, -1) {
+		v := strings.Trim(m[2], `"'`)
+		attrs[strings.ToLower(m[1])] = htmlUnescape(v)
+	}
+	return attrs
+}
+
+var htmlEntities = strings.NewReplacer("&amp;", "&", "&quot;", `"`, "&#39;", "'", "&#x27;", "'", "&lt;", "<", "&gt;", ">", "&#43;", "+", "&#x2B;", "+", "&#x3D;", "=", "&#61;", "=", "&#x2F;", "/", "&#47;", "/")
+
+func htmlUnescape(s string) string {
+	if !strings.Contains(s, "&") {
+		return s
+	}
+	return htmlEntities.Replace(s)
+}
+
+// setField coloca value nos campos name da query, do formulário e do JSON da
+// requisição. Com add, um campo ausente é acrescentado à query ou ao formulário
+// urlencoded.
+func setField(req HTTPRequest, name, value string, add bool) (HTTPRequest, []string) {
+	var placed []string
+	for _, p := range EnumerateInjectionPoints(req) {
+		switch p.Kind {
+		case InjectQuery, InjectForm, InjectMultipart, InjectJSON:
+		default:
+			continue
+		}
+		if p.Name != name && leafName(p.Name) != name {
+			continue
+		}
+		if out, err := p.Apply(req, value); err == nil {
+			req = out
+			placed = append(placed, p.String())
+		}
+	}
+	if len(placed) > 0 || !add {
+		return req, placed
+	}
+
+	p := InjectionPoint{Kind: InjectQuery, Name: name}
+	if len(req.Body) > 0 {
+		if !strings.Contains(req.Header.Get("Content-Type"), "x-www-form-urlencoded") {
+			return req, nil
+		}
+		p.Kind = InjectForm
+	}
+	if out, err := p.Apply(req, value); err == nil {
+		return out, []string{p.String()}
+	}
+	return req, nil
+}
+
+// leafName devolve a última chave de um caminho JSON ("user.csrf" -> "csrf").
+func leafName(path string) string {
+	if i := strings.LastIndexAny(path, ".]"); i >= 0 && i+1 < len(path) {
+		return path[i+1:]
+	}
+	return path
+}
+
+// setCookie troca (ou acrescenta) um cookie no cabeçalho Cookie da requisição.
+func setCookie(req HTTPRequest, name, value string) HTTPRequest {
+	out, err := InjectionPoint{Kind: InjectCookie, Name: name}.Apply(req, value)
+	if err != nil {
+		return req
+	}
+	return out
+}
@@ -0,0 +1,210 @@
+package active
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// csrfServer emite um token de uso único por página, amarrado ao cookie de sessão.
+func csrfServer(t *testing.T) *httptest.Server {
+	var mu sync.Mutex
+	n := 0
+	valid := map[string]string{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == http.MethodGet {
+			n++
+			sid, tok := fmt.Sprint("s", n), fmt.Sprint("t", n)
+			valid[tok] = sid
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: sid})
+			fmt.Fprintf(w, `<html><head><meta name="csrf-token" content="%s"></head><form><input type="hidden" name="csrf_token" value="%s"></form></html>`, tok, tok)
+			return
+		}
+		r.ParseForm()
+		tok := r.PostForm.Get("csrf_token")
+		if h := r.Header.Get("X-CSRF-Token"); h != "" {
+			tok = h
+		}
+		c, err := r.Cookie("sid")
+		if err != nil || valid[tok] != c.Value {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, "invalid csrf token")
+			return
+		}
+		delete(valid, tok)
+		fmt.Fprintf(w, "<p>%s</p>", r.PostForm.Get("q"))
+	}))
+}
+
+func TestCSRFTokenRefresh(t *testing.T) {
+	srv := csrfServer(t)
+	defer srv.Close()
+
+	base := HTTPRequest{
+		Method: http.MethodPost,
+		URL:    srv.URL + "/comment",
+		Header: http.Header{"Content-Type": {"application/x-www-form-urlencoded"}, "Cookie": {"sid=stale"}},
+		Body:   []byte("q=hi&csrf_token=stale"),
+	}
+	dir := writePayloads(t, `[{"name":"m","category":"marker","template":"<b>{{INJECT}}</b>"}]`)
+
+	res, err := RunActiveScan(ActiveOptions{Requests: []HTTPRequest{base}, PayloadsPath: dir, PayloadApproval: unsigned, Rate: 1000, SkipWAFDetection: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Findings) != 0 {
+		t.Fatalf("without CSRF handling every request is rejected, got %+v", res.Findings)
+	}
+
+	res, err = RunActiveScan(ActiveOptions{Requests: []HTTPRequest{base}, PayloadsPath: dir, PayloadApproval: unsigned, Rate: 1000, SkipWAFDetection: true, CSRF: &CSRFOptions{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Findings) != 1 {
+		t.Fatalf("expected the reflection behind the CSRF token, got %+v (stats %+v)", res.Findings, res.Stats)
+	}
+	ev := res.Findings[0].Evidence
+	if ev.CSRF == nil || len(ev.CSRF.Tokens) == 0 || ev.CSRF.Status != 200 {
+		t.Fatalf("expected CSRF evidence, got %+v", ev.CSRF)
+	}
+	tok := ev.CSRF.Tokens[0]
+	if tok.Name != "csrf_token" || tok.From != "input" || len(tok.Placed) != 1 || tok.Placed[0] != "form:csrf_token" {
+		t.Fatalf("unexpected token evidence %+v", ev.CSRF.Tokens)
+	}
+	if !strings.Contains(ev.Request, "csrf_token="+tok.Value) {
+		t.Fatalf("the sent request must carry the fresh token, got %q", ev.Request)
+	}
+	// Cada requisição (linhas de base incluídas) busca um token novo.
+	if st := res.Stats; st.TokenFetches != st.Requests {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
+
+func TestCSRFTokenSourceIsClean(t *testing.T) {
+	var mu sync.Mutex
+	var pages []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			mu.Lock()
+			pages = append(pages, r.URL.RawQuery)
+			mu.Unlock()
+			fmt.Fprint(w, `<input type="hidden" name="csrf_token" value="t1">`)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer srv.Close()
+
+	base := HTTPRequest{
+		Method: http.MethodPost,
+		URL:    srv.URL + "/comment?q=hi",
+		Header: http.Header{"Content-Type": {"application/x-www-form-urlencoded"}},
+		Body:   []byte("csrf_token=stale"),
+	}
+	dir := writePayloads(t, `[{"name":"m","category":"marker","template":"zzinj{{INJECT}}"}]`)
+	res, err := RunActiveScan(ActiveOptions{Requests: []HTTPRequest{base}, PayloadsPath: dir, PayloadApproval: unsigned, Rate: 1000, SkipWAFDetection: true, CSRF: &CSRFOptions{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Stats.TokenFetches == 0 || len(pages) != res.Stats.TokenFetches {
+		t.Fatalf("expected token fetches, got %+v (pages %v)", res.Stats, pages)
+	}
+	for _, q := range pages {
+		if strings.Contains(q, "zzinj") {
+			t.Fatalf("the token page request carried the payload: %q", q)
+		}
+	}
+}
+
+func TestCSRFRuleHeader(t *testing.T) {
+	srv := csrfServer(t)
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "csrf.yaml")
+	rules := fmt.Sprintf("rules:\n  - target: %s/api/\n    source: %s/app\n    token: csrf-token\n    from: meta\n    header: X-CSRF-Token\n", srv.URL, srv.URL)
+	if err := os.WriteFile(path, []byte(rules), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	csrf, err := LoadCSRFOptions(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := HTTPRequest{
+		Method: http.MethodPost,
+		URL:    srv.URL + "/api/comment",
+		Header: http.Header{"Content-Type": {"application/x-www-form-urlencoded"}},
+		Body:   []byte("q=hi"),
+	}
+	dir := writePayloads(t, `[{"name":"m","category":"marker","template":"<b>{{INJECT}}</b>"}]`)
+	res, err := RunActiveScan(ActiveOptions{Requests: []HTTPRequest{base}, PayloadsPath: dir, PayloadApproval: unsigned, Rate: 1000, SkipWAFDetection: true, CSRF: csrf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Findings) != 1 {
+		t.Fatalf("expected one finding, got %+v", res.Findings)
+	}
+	ev := res.Findings[0].Evidence.CSRF
+	if ev == nil || ev.Source != srv.URL+"/app" || len(ev.Tokens) != 1 || ev.Tokens[0].From != "meta" || ev.Tokens[0].Placed[0] != "header:X-CSRF-Token" {
+		t.Fatalf("unexpected CSRF evidence %+v", ev)
+	}
+}
+
+func TestCSRFConfigValidation(t *testing.T) {
+	o := &CSRFOptions{Rules: []CSRFRule{{Target: "https://a.example", From: "regex", Pattern: "token=\\w+", Param: "t"}}}
+	if err := o.compile(); err == nil || !strings.Contains(err.Error(), "capture group") {
+		t.Fatalf("expected a capture group error, got %v", err)
+	}
+	o = &CSRFOptions{Rules: []CSRFRule{{Target: "a.example", Token: "tok", Param: "authz"}}}
+	if err := o.compile(); err != nil {
+		t.Fatal(err)
+	}
+	if o.rule("https://a.example/x") == nil || o.rule("https://b.example/x") != nil {
+		t.Fatal("host targets must match by host")
+	}
+	for point, want := range map[string]bool{"form:csrfmiddlewaretoken": true, "header:X-XSRF-TOKEN": true, "json:data.authz": true, "form:q": false, "path:csrf#1": false} {
+		if got := o.skips(point); got != want {
+			t.Errorf("skips(%q) = %v, want %v", point, got, want)
+		}
+	}
+}
+
+func TestCSRFRuleTargets(t *testing.T) {
+	o := &CSRFOptions{Rules: []CSRFRule{
+		{Target: "example.com", Token: "host"},
+		{Target: "https://example.com/app/", Token: "app"},
+		{Target: "example.com:8443", Token: "port"},
+	}}
+	if err := o.compile(); err != nil {
+		t.Fatal(err)
+	}
+	for rawURL, want := range map[string]string{
+		"https://example.com/":                           "host",
+		"https://EXAMPLE.com/app":                        "app",
+		"https://example.com/app/comment":                "app",
+		"https://example.com/application":                "host",
+		"http://example.com/app/comment":                 "host",
+		"https://example.com:8443/":                      "port",
+		"https://example.com.evil.net/app/x":             "",
+		"https://evil.net/?next=https://example.com/app": "",
+		"https://notexample.com/":                        "",
+	} {
+		got := ""
+		if r := o.rule(rawURL); r != nil {
+			got = r.Token
+		}
+		if got != want {
+			t.Errorf("rule(%q) = %q, want %q", rawURL, got, want)
+		}
+	}
+	if err := (&CSRFOptions{Rules: []CSRFRule{{Target: "https:///x", Token: "t"}}}).compile(); err == nil {
+		t.Fatal("expected a target without host to be rejected")
+	}
+}
@@ -0,0 +1,202 @@
+package active
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/ghostn3xus/reconsec/pkg/report"
+)
+
+// DifferentialOptions configura a análise diferencial (booleana) dos templates
+// com false_template.
+type DifferentialOptions struct {
+	// Trials é o número de pares verdadeiro/falso enviados (padrão 3).
+	Trials int
+
+	// MinSimilarity é a semelhança mínima entre a resposta verdadeira e a linha
+	// de base, e entre duas respostas da linha de base (padrão 0.95).
+	MinSimilarity float64
+
+	// MaxSimilarity é a semelhança máxima entre as respostas verdadeira e falsa
+	// para considerá-las diferentes (padrão 0.9).
+	MaxSimilarity float64
+}
+
+func (o DifferentialOptions) withDefaults() DifferentialOptions {
+	if o.Trials <= 0 {
+		o.Trials = 3
+	}
+	if o.MinSimilarity <= 0 {
+		o.MinSimilarity = 0.95
+	}
+	if o.MaxSimilarity <= 0 {
+		o.MaxSimilarity = 0.9
+	}
+	return o
+}
+
+// isDifferential informa se o template é um par verdadeiro/falso.
+func (p PayloadTemplate) isDifferential() bool {
+	return strings.TrimSpace(p.FalseTemplate) != ""
+}
+
+// planDifferentialJobs monta um job por ponto de injeção (e variante) com o par
+// de requisições verdadeira e falsa. As duas usam as mesmas variáveis aleatórias.
+func planDifferentialJobs(base HTTPRequest, p PayloadTemplate, vars map[string]string, opts DifferentialOptions, cache *baselineCache) ([]job, error) {
+	clean := stripMarkers(base)
+	extra := mergeVars(vars, map[string]string{"randstr": randomString(8), "randint": randomInt()})
+	trueAttempts, err := planAttemptsWith(base, p, extra)
+	if err != nil {
+		return nil, err
+	}
+	falseTemplate := p
+	falseTemplate.Template = p.FalseTemplate
+	falseAttempts, err := planAttemptsWith(base, falseTemplate, extra)
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []job
+	for k := range trueAttempts {
+		t, f := trueAttempts[k], falseAttempts[k]
+		jobs = append(jobs, job{
+			host:    requestHost(t.req.URL),
+			payload: p,
+			attempt: t,
+			probe: func(ctx context.Context, send sendFunc) evaluation {
+				baseline, err := cache.get(ctx, clean, 2, send)
+				if err != nil {
+					return probeError(err)
+				}
+				return runDifferentialProbe(ctx, send, p, t, f, baseline, opts)
+			},
+		})
+	}
+	return jobs, nil
+}
+
+// runDifferentialProbe envia pares verdadeiro/falso e só reporta se, em todas as
+// rodadas, a resposta verdadeira for igual à linha de base e diferente da falsa.
+func runDifferentialProbe(ctx context.Context, send sendFunc, p PayloadTemplate, t, f attempt, baseline []*Exchange, opts DifferentialOptions) evaluation {
+	ev := &report.DifferentialEvidence{FalseRequest: f.req.Raw()}
+	ev.BaselineStability = responseSimilarity(baseline[0], baseline[1], nil, nil)
+
+	var trueEx, falseEx *Exchange
+	consistent := ev.BaselineStability >= opts.MinSimilarity
+	for i := 0; consistent && i < opts.Trials; i++ {
+		var err error
+		if trueEx, err = send(ctx, t.req); err != nil {
+			return probeError(err)
+		}
+		if falseEx, err = send(ctx, f.req); err != nil {
+			return probeError(err)
+		}
+
+		tb := responseSimilarity(trueEx, baseline[0], t.vars, nil)
+		tf := responseSimilarity(trueEx, falseEx, t.vars, f.vars)
+		ev.TrueBaseline = append(ev.TrueBaseline, tb)
+		ev.TrueFalse = append(ev.TrueFalse, tf)
+		ev.Trials++
+
+		// A verdadeira precisa ser igual à linha de base e diferente da falsa.
+		consistent = tb >= opts.MinSimilarity && tf <= opts.MaxSimilarity
+	}
+	if !consistent {
+		return evaluation{outcome: outcomeMiss}
+	}
+
+	ev.FalseStatus = falseEx.Status
+	ev.FalseResponse = falseEx.RawResponse()
+	evidence := trueEx.Evidence()
+	evidence.Differential = ev
+	evidence.Matcher = "differential"
+	evidence.Excerpt = responseHead(trueEx)
+	return evaluation{outcome: outcomeFinding, finding: &report.Finding{
+		Type:       "VulnerabilityFound",
+		Severity:   report.SeverityHigh,
+		Confidence: report.ConfidenceHigh,
+		URL:        t.req.URL,
+		Notes: fmt.Sprintf("Payload '%s' at %s: the true condition matched the baseline and the false condition differed in %d/%d trials.",
+			p.Name, t.point, ev.Trials, ev.Trials),
+		Evidence: evidence,
+	}}
+}
+
+// Padrões de conteúdo dinâmico removidos antes da comparação.
+var dynamicPatterns = []*regexp.Regexp{
+	// Valores de campos e metas de CSRF/nonce.
+	regexp.MustCompile(`(?i)(<(?:input|meta)[^>]*(?:name|id)=["'][^"']*(?:csrf|xsrf|token|nonce|authenticity)[^"']*["'][^>]*(?:value|content)=["'])[^"']*`),
+	regexp.MustCompile(`(?i)(<(?:input|meta)[^>]*(?:value|content)=["'])[^"']*(["'][^>]*(?:name|id)=["'][^"']*(?:csrf|xsrf|token|nonce|authenticity))`),
+	// Datas e horas.
+	regexp.MustCompile(`\d{4}-\d{2}-\d{2}(?:[T ]\d{2}:\d{2}(?::\d{2})?(?:\.\d+)?(?:Z|[+-]\d{2}:?\d{2})?)?`),
+	regexp.MustCompile(`\b\d{1,2}:\d{2}:\d{2}\b`),
+	// UUIDs, hashes, timestamps Unix e tokens longos.
+	regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`),
+	regexp.MustCompile(`(?i)\b[0-9a-f]{16,}\b`),
+	regexp.MustCompile(`\b\d{10,13}\b`),
+	regexp.MustCompile(`[A-Za-z0-9+/_-]{32,}={0,2}`),
+}
+
+var tokenRe = regexp.MustCompile(`</?[A-Za-z][A-Za-z0-9-]*|[\p{L}\p{N}_]+`)
+
+// normalizeBody remove do corpo os payloads refletidos e o conteúdo dinâmico.
+func normalizeBody(body string, vars map[string]string) string {
+	for _, k := range []string{"payload", "encoded", "marker"} {
+		v := vars[k]
+		if v == "" {
+			continue
+		}
+		for _, form := range []string{v, html.EscapeString(v), url.QueryEscape(v)} {
+			body = strings.ReplaceAll(body, form, "")
+		}
+	}
+	for i, re := range dynamicPatterns {
+		if i < 2 {
+			body = re.ReplaceAllString(body, "${1}${2}")
+			continue
+		}
+		body = re.ReplaceAllString(body, "")
+	}
+	return body
+}
+
+// responseSimilarity compara duas respostas depois da normalização: status
+// diferente dá 0; caso contrário, o coeficiente de Dice sobre os tokens (tags e
+// palavras) dos corpos.
+func responseSimilarity(a, b *Exchange, varsA, varsB map[string]string) float64 {
+	if a.Status != b.Status {
+		return 0
+	}
+	ta := tokenCounts(normalizeBody(string(a.Body), varsA))
+	tb := tokenCounts(normalizeBody(string(b.Body), varsB))
+
+	var total, common int
+	for tok, n := range ta {
+		total += n
+		if m := tb[tok]; m < n {
+			common += m
+		} else {
+			common += n
+		}
+	}
+	for _, n := range tb {
+		total += n
+	}
+	if total == 0 {
+		return 1
+	}
+	return math.Round(2*float64(common)/float64(total)*1000) / 1000
+}
+
+func tokenCounts(s string) map[string]int {
+	counts := map[string]int{}
+	for _, tok := range tokenRe.FindAllString(s, -1) {
+		counts[strings.ToLower(tok)]++
+	}
+	return counts
+}
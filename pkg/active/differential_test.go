@@ -0,0 +1,87 @@
+package active
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+var boolRe = regexp.MustCompile(`^1' AND '(\d+)'='(\d+)$`)
+
+// boolServer simula uma injeção booleana em q: a condição verdadeira devolve o
+// mesmo item que q=1 e a falsa, uma página vazia. As páginas têm conteúdo
+// dinâmico (hora, token CSRF) e refletem o valor recebido.
+func boolServer(vulnerable bool) *httptest.Server {
+	var n int
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		q := r.URL.Query().Get("q")
+		found := q == "1"
+		if m := boolRe.FindStringSubmatch(q); m != nil && vulnerable {
+			found = m[1] == m[2]
+		}
+		fmt.Fprintf(w, `<html><head><meta name="csrf-token" content="tok%d"></head><body>
+<p>Generated at %s</p><p>You searched for %s</p>`, n, time.Now().Add(time.Duration(n)*time.Second).Format(time.RFC3339), html.EscapeString(q))
+		if found {
+			fmt.Fprint(w, `<ul><li>Product one</li><li>Price 10</li><li>In stock</li></ul>`)
+		} else {
+			fmt.Fprint(w, `<p>No products found</p>`)
+		}
+		fmt.Fprint(w, `</body></html>`)
+	}))
+}
+
+const boolPayload = `[{"name":"bool","category":"sqli",
+  "template":"{{original}}' AND '{{randint}}'='{{randint}}",
+  "false_template":"{{original}}' AND '{{randint}}'='{{randint}}1"}]`
+
+func differentialScan(t *testing.T, srv *httptest.Server) ScanResult {
+	t.Helper()
+	res, err := RunActiveScan(ActiveOptions{
+		URL:              srv.URL + "/?q=1",
+		PayloadsPath:     writePayloads(t, boolPayload),
+		PayloadApproval:  unsigned,
+		Rate:             1000,
+		SkipWAFDetection: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestDifferentialDetection(t *testing.T) {
+	srv := boolServer(true)
+	defer srv.Close()
+
+	f := findingAt(differentialScan(t, srv), "query:q")
+	if f == nil || f.Type != "VulnerabilityFound" {
+		t.Fatalf("expected a differential finding, got %+v", f)
+	}
+	d := f.Evidence.Differential
+	if d == nil || d.Trials != 3 || d.BaselineStability < 0.95 || d.TrueBaseline[0] < 0.95 || d.TrueFalse[0] > 0.9 {
+		t.Fatalf("unexpected differential evidence %+v", d)
+	}
+}
+
+func TestDifferentialNotVulnerable(t *testing.T) {
+	srv := boolServer(false)
+	defer srv.Close()
+
+	res := differentialScan(t, srv)
+	if len(res.Findings) != 0 || res.Stats.Attempts != 1 || res.Stats.ByPayload["bool"].Attempts != 1 {
+		t.Fatalf("a server that ignores the condition must not be reported, got %+v / %+v", res.Findings, res.Stats)
+	}
+}
+
+func TestNormalizeBody(t *testing.T) {
+	a := `<input type="hidden" name="csrf_token" value="abc123"> at 2024-01-02T10:11:12Z id 0123456789abcdef0123 echo X'Y`
+	b := `<input type="hidden" name="csrf_token" value="zzz999"> at 2025-06-07T01:02:03Z id fedcba9876543210fedc echo Q`
+	if na, nb := normalizeBody(a, map[string]string{"payload": "X'Y"}), normalizeBody(b, map[string]string{"payload": "Q"}); na != nb {
+		t.Fatalf("dynamic content not removed:\n%s\n%s", na, nb)
+	}
+}
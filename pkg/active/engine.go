@@ -0,0 +1,411 @@
+package active
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ghostn3xus/reconsec/pkg/report"
+	"github.com/ghostn3xus/reconsec/pkg/utils"
+)
+
+const defaultMaxBody = 512000
+
+// HTTPRequest é uma requisição montada pelo scanner para ser enviada ao alvo.
+type HTTPRequest struct {
+	Method string
+	URL    string
+	Header http.Header
+	Body   []byte
+
+	// headerOrder guarda os nomes dos cabeçalhos de uma requisição bruta, um por
+	// linha, na ordem e na grafia originais (ver ParseRawRequest).
+	headerOrder []string
+
+	// tokenSource é a mesma requisição sem o payload; é ela, e não a injetada,
+	// que busca a página de origem dos tokens anti-CSRF.
+	tokenSource *HTTPRequest
+}
+
+// Exchange guarda a evidência completa de uma tentativa.
+type Exchange struct {
+	Request  HTTPRequest
+	Status   int
+	Header   http.Header
+	Body     []byte
+	Duration time.Duration
+
+	// CSRF registra os tokens renovados antes do envio, se houver.
+	CSRF *report.CSRFEvidence
+}
+
+// Sender envia uma requisição e devolve a troca completa com o alvo.
+type Sender interface {
+	Send(ctx context.Context, req HTTPRequest) (*Exchange, error)
+}
+
+// NativeSender envia as requisições diretamente pelo cliente HTTP do Go.
+type NativeSender struct {
+	Client  *http.Client
+	MaxBody int64
+
+	// PathAsIs envia o caminho e a query exatamente como estão na URL, sem
+	// normalizar nem recodificar (como o --path-as-is do curl). Requisições
+	// brutas (ParseRawRequest) são escritas direto na conexão (ver sendRaw).
+	PathAsIs bool
+
+	// Session é aplicada às requisições brutas, que não passam pelo Client.
+	Session *utils.Session
+}
+
+// NewNativeSender cria um NativeSender que não segue redirecionamentos, para que
+// a resposta avaliada seja exatamente a produzida pelo payload.
+func NewNativeSender(client *http.Client) *NativeSender {
+	c := *client
+	c.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	return &NativeSender{Client: &c, MaxBody: defaultMaxBody}
+}
+
+func (s *NativeSender) Send(ctx context.Context, r HTTPRequest) (*Exchange, error) {
+	if s.PathAsIs && r.headerOrder != nil {
+		return s.sendRaw(ctx, r)
+	}
+	method := r.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	target := r.URL
+	origin, raw := splitTarget(r.URL)
+	if s.PathAsIs {
+		target = origin + "/"
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(r.Body))
+	if err != nil {
+		return nil, err
+	}
+	if s.PathAsIs {
+		req.URL.Opaque = raw
+	}
+	for k, vv := range r.Header {
+		for _, v := range vv {
+			req.Header.Add(k, v)
+		}
+	}
+	if host := r.Header.Get("Host"); host != "" {
+		req.Host = host
+	}
+
+	start := time.Now()
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBody(s.MaxBody)))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Exchange{
+		Request:  r,
+		Status:   resp.StatusCode,
+		Header:   resp.Header,
+		Body:     body,
+		Duration: time.Since(start),
+	}, nil
+}
+
+// sendRaw escreve uma requisição bruta na conexão exatamente como Raw a
+// formata: cabeçalhos na ordem e na grafia capturadas, com Host e Content-Length
+// atualizados. O Client não é usado, então proxies do ambiente são ignorados e a
+// sessão entra pelos cabeçalhos de Session, sem novo login automático.
+func (s *NativeSender) sendRaw(ctx context.Context, r HTTPRequest) (*Exchange, error) {
+	if s.Session != nil {
+		var err error
+		if r, err = withSessionHeaders(ctx, s.Session, r); err != nil {
+			return nil, err
+		}
+	}
+	origin, _ := splitTarget(r.URL)
+	u, err := url.Parse(origin)
+	if err != nil {
+		return nil, err
+	}
+	if s.Client != nil && s.Client.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Client.Timeout)
+		defer cancel()
+	}
+
+	conn, err := dialRaw(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	start := time.Now()
+	if _, err := io.WriteString(conn, r.Raw()); err != nil {
+		return nil, rawError(ctx, err)
+	}
+	method := r.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	br := bufio.NewReader(conn)
+	for {
+		resp, err := http.ReadResponse(br, &http.Request{Method: method})
+		if err != nil {
+			return nil, rawError(ctx, err)
+		}
+		if resp.StatusCode >= 100 && resp.StatusCode < 200 {
+			continue
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxBody(s.MaxBody)))
+		if err != nil {
+			return nil, rawError(ctx, err)
+		}
+		return &Exchange{Request: r, Status: resp.StatusCode, Header: resp.Header, Body: body, Duration: time.Since(start)}, nil
+	}
+}
+
+// dialRaw abre a conexão com a origem, com TLS (só HTTP/1.1) em https.
+func dialRaw(ctx context.Context, u *url.URL) (net.Conn, error) {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil || u.Scheme != "https" {
+		return conn, err
+	}
+	tc := tls.Client(conn, &tls.Config{ServerName: u.Hostname(), NextProtos: []string{"http/1.1"}})
+	if err := tc.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tc, nil
+}
+
+// rawError troca o erro da conexão fechada pelo do contexto, se ele acabou.
+func rawError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// withSessionHeaders copia os cabeçalhos da sessão para r; os cookies da sessão
+// são somados aos da requisição e os demais só entram se ausentes.
+func withSessionHeaders(ctx context.Context, s *utils.Session, r HTTPRequest) (HTTPRequest, error) {
+	h, err := s.Headers(ctx, r.URL)
+	if err != nil {
+		return r, err
+	}
+	r = r.clone()
+	for k, vv := range h {
+		switch {
+		case r.Header.Get(k) == "":
+			r.Header[k] = vv
+		case k == "Cookie":
+			r.Header.Set(k, r.Header.Get(k)+"; "+h.Get(k))
+		}
+	}
+	return r, nil
+}
+
+// curlArgs traduz a requisição para argumentos do curl, preservando o caminho sem normalização.
+func curlArgs(r HTTPRequest) []string {
+	method := r.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	args := []string{"-sS", "-i", "--path-as-is", "-X", method, "-H", "Expect:"}
+	for _, k := range sortedHeaderKeys(r.Header) {
+		for _, v := range r.Header[k] {
+			args = append(args, "-H", k+": "+v)
+		}
+	}
+	if len(r.Body) > 0 {
+		args = append(args, "--data-binary", "@-")
+	}
+	return append(args, r.URL)
+}
+
+func parseCurlOutput(r HTTPRequest, out []byte, d time.Duration, limit int64) (*Exchange, error) {
+	br := bufio.NewReader(bytes.NewReader(out))
+	for {
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			return nil, fmt.Errorf("sandbox: could not parse curl output: %w", err)
+		}
+		// Respostas informativas (100 Continue etc.) precedem a resposta final.
+		if resp.StatusCode >= 100 && resp.StatusCode < 200 {
+			continue
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, limit))
+		return &Exchange{Request: r, Status: resp.StatusCode, Header: resp.Header, Body: body, Duration: d}, nil
+	}
+}
+
+// Evidence converte a troca em evidência de relatório com requisição e resposta brutas.
+func (e *Exchange) Evidence() *report.Evidence {
+	return &report.Evidence{
+		Request:    e.Request.Raw(),
+		Response:   e.RawResponse(),
+		Status:     e.Status,
+		DurationMs: e.Duration.Milliseconds(),
+		CSRF:       e.CSRF,
+	}
+}
+
+// Raw formata a requisição como HTTP/1.1.
+func (r HTTPRequest) Raw() string {
+	method := r.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	origin, target := splitTarget(r.URL)
+	_, host, _ := strings.Cut(origin, "://")
+	if h := r.Header.Get("Host"); h != "" {
+		host = h
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s HTTP/1.1\r\n", method, target)
+	if r.headerOrder != nil {
+		r.writeOrderedHeader(&sb, host)
+		sb.WriteString("\r\n")
+		sb.Write(r.Body)
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "Host: %s\r\n", host)
+	for _, k := range sortedHeaderKeys(r.Header) {
+		if strings.EqualFold(k, "Host") {
+			continue
+		}
+		for _, v := range r.Header[k] {
+			fmt.Fprintf(&sb, "%s: %s\r\n", k, v)
+		}
+	}
+	sb.WriteString("\r\n")
+	sb.Write(r.Body)
+	return sb.String()
+}
+
+// writeOrderedHeader escreve os cabeçalhos de uma requisição bruta na ordem e
+// na grafia capturadas. Cada linha leva o próximo valor do seu cabeçalho e a
+// última linha de um nome leva os que sobraram; Host e Content-Length vêm da
+// URL e do corpo atuais. Cabeçalhos novos (injeção, sessão, CSRF) vão ao fim.
+func (r HTTPRequest) writeOrderedHeader(sb *strings.Builder, host string) {
+	last := map[string]int{}
+	for i, name := range r.headerOrder {
+		last[http.CanonicalHeaderKey(name)] = i
+	}
+	if _, ok := last["Host"]; !ok {
+		fmt.Fprintf(sb, "Host: %s\r\n", host)
+	}
+	used := map[string]int{}
+	for i, name := range r.headerOrder {
+		key := http.CanonicalHeaderKey(name)
+		n := used[key]
+		used[key]++
+		switch key {
+		case "Host":
+			if n == 0 {
+				fmt.Fprintf(sb, "%s: %s\r\n", name, host)
+			}
+			continue
+		case "Content-Length":
+			if n == 0 {
+				fmt.Fprintf(sb, "%s: %d\r\n", name, len(r.Body))
+			}
+			continue
+		}
+		values := r.Header[key]
+		end := n + 1
+		if i == last[key] {
+			end = len(values)
+		}
+		for ; n < end && n < len(values); n++ {
+			fmt.Fprintf(sb, "%s: %s\r\n", name, values[n])
+		}
+	}
+	for _, k := range sortedHeaderKeys(r.Header) {
+		if _, ok := last[http.CanonicalHeaderKey(k)]; ok || strings.EqualFold(k, "Host") {
+			continue
+		}
+		for _, v := range r.Header[k] {
+			fmt.Fprintf(sb, "%s: %s\r\n", k, v)
+		}
+	}
+	_, hasLength := last["Content-Length"]
+	_, chunked := last["Transfer-Encoding"]
+	if !hasLength && !chunked && len(r.Body) > 0 {
+		fmt.Fprintf(sb, "Content-Length: %d\r\n", len(r.Body))
+	}
+}
+
+// RawResponse formata a resposta recebida como HTTP/1.1.
+func (e *Exchange) RawResponse() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "HTTP/1.1 %d %s\r\n", e.Status, http.StatusText(e.Status))
+	for _, k := range sortedHeaderKeys(e.Header) {
+		for _, v := range e.Header[k] {
+			fmt.Fprintf(&sb, "%s: %s\r\n", k, v)
+		}
+	}
+	sb.WriteString("\r\n")
+	sb.Write(e.Body)
+	return sb.String()
+}
+
+// splitTarget separa a URL em origem ("https://host") e alvo da linha de
+// requisição ("/caminho?query"), sem decodificar nada. O fragmento é descartado.
+func splitTarget(rawURL string) (string, string) {
+	rawURL, _, _ = strings.Cut(rawURL, "#")
+	scheme, rest, ok := strings.Cut(rawURL, "://")
+	if !ok {
+		return "", rawURL
+	}
+	i := strings.IndexAny(rest, "/?")
+	if i < 0 {
+		return scheme + "://" + rest, "/"
+	}
+	target := rest[i:]
+	if target[0] == '?' {
+		target = "/" + target
+	}
+	return scheme + "://" + rest[:i], target
+}
+
+func sortedHeaderKeys(h http.Header) []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func maxBody(n int64) int64 {
+	if n <= 0 {
+		return defaultMaxBody
+	}
+	return n
+}
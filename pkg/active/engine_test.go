@@ -0,0 +1,174 @@
+package active
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghostn3xus/reconsec/pkg/approval"
+	"github.com/ghostn3xus/reconsec/pkg/utils"
+)
+
+// unsigned aceita os arquivos de payload não assinados gerados pelos testes.
+var unsigned = &approval.Policy{AllowUnsigned: true}
+
+func writePayloads(t *testing.T, content string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "p.json"), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestRunActiveScanNative(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "<html>%s</html>", r.URL.Query().Get("p"))
+	}))
+	defer srv.Close()
+
+	dir := writePayloads(t, `[{"name":"m","category":"marker","template":"<b>{{INJECT}}</b>"}]`)
+	res, err := RunActiveScan(ActiveOptions{URL: srv.URL, PayloadsPath: dir, PayloadApproval: unsigned, Rate: 100, SkipWAFDetection: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Findings) != 1 || res.Findings[0].Type != "VulnerabilityFound" {
+		t.Fatalf("expected one reflection finding, got %+v", res.Findings)
+	}
+	ev := res.Findings[0].Evidence
+	if ev == nil || ev.Status != 200 || !strings.HasPrefix(ev.Request, "GET /?p=") || !strings.Contains(ev.Response, "<b>__RECONSEC_") {
+		t.Fatalf("unexpected evidence %+v", ev)
+	}
+}
+
+func TestParseCurlOutput(t *testing.T) {
+	out := "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 302 Found\r\nLocation: /x\r\nContent-Length: 2\r\n\r\nok"
+	ex, err := parseCurlOutput(HTTPRequest{URL: "http://t/"}, []byte(out), time.Millisecond, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ex.Status != 302 || ex.Header.Get("Location") != "/x" || string(ex.Body) != "ok" {
+		t.Fatalf("unexpected exchange %+v", ex)
+	}
+}
+
+func TestRunActiveScanWithSession(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie("sid"); err != nil || c.Value != "ok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, "<html>%s</html>", r.URL.Query().Get("p"))
+	}))
+	defer srv.Close()
+
+	session, err := utils.NewSession(utils.SessionProfile{Cookies: map[string]string{"sid": "ok"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := writePayloads(t, `[{"name":"m","category":"marker","template":"<b>{{INJECT}}</b>"}]`)
+	res, err := RunActiveScan(ActiveOptions{URL: srv.URL, PayloadsPath: dir, PayloadApproval: unsigned, Rate: 100, SkipWAFDetection: true, Session: session})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Findings) != 1 || res.Findings[0].Evidence.Status != 200 {
+		t.Fatalf("expected the scan to run inside the session, got %+v", res.Findings)
+	}
+}
+
+func TestNativeSenderPathAsIs(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.RequestURI
+	}))
+	defer srv.Close()
+
+	sender := NewNativeSender(srv.Client())
+	sender.PathAsIs = true
+	if _, err := sender.Send(context.Background(), HTTPRequest{URL: srv.URL + "/a/../b/%2e%2e/c?q=%zz&r"}); err != nil {
+		t.Fatal(err)
+	}
+	if got != "/a/../b/%2e%2e/c?q=%zz&r" {
+		t.Fatalf("path was normalized: %s", got)
+	}
+}
+
+func TestNativeSenderRawHeaderOrder(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	got := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		br := bufio.NewReader(conn)
+		var head strings.Builder
+		for {
+			line, err := br.ReadString('\n')
+			head.WriteString(line)
+			if err != nil || line == "\r\n" {
+				break
+			}
+		}
+		body := make([]byte, len("a=1&b=22"))
+		io.ReadFull(br, body)
+		got <- head.String() + string(body)
+		io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok")
+	}()
+
+	raw := "POST /a/../b?x=1 HTTP/1.1\r\n" +
+		"host: " + ln.Addr().String() + "\r\n" +
+		"x-lower: 1\r\n" +
+		"Cookie: a=1\r\n" +
+		"User-Agent: ua\r\n" +
+		"Cookie: b=2\r\n" +
+		"content-length: 3\r\n" +
+		"\r\n" +
+		"a=1"
+	req, err := ParseRawRequest([]byte(raw), "http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err = InjectionPoint{Kind: InjectForm, Name: "b"}.Apply(req, "22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Added", "z")
+
+	sender := NewNativeSender(http.DefaultClient)
+	sender.PathAsIs = true
+	ex, err := sender.Send(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "POST /a/../b?x=1 HTTP/1.1\r\n" +
+		"host: " + ln.Addr().String() + "\r\n" +
+		"x-lower: 1\r\n" +
+		"Cookie: a=1\r\n" +
+		"User-Agent: ua\r\n" +
+		"Cookie: b=2\r\n" +
+		"content-length: 8\r\n" +
+		"X-Added: z\r\n" +
+		"\r\n" +
+		"a=1&b=22"
+	if sent := <-got; sent != want {
+		t.Fatalf("raw request was rewritten:\n%q\nwant\n%q", sent, want)
+	}
+	if ex.Status != 200 || string(ex.Body) != "ok" || ex.Request.Raw() != want {
+		t.Fatalf("unexpected exchange %d %q\n%q", ex.Status, ex.Body, ex.Request.Raw())
+	}
+}
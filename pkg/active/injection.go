@@ -0,0 +1,631 @@
+package active
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// InjectionKind identifica em que parte da requisição um payload é colocado.
+type InjectionKind string
+
+const (
+	InjectQuery     InjectionKind = "query"
+	InjectForm      InjectionKind = "form"
+	InjectMultipart InjectionKind = "multipart"
+	InjectJSON      InjectionKind = "json"
+	InjectXML       InjectionKind = "xml"
+	InjectHeader    InjectionKind = "header"
+	InjectCookie    InjectionKind = "cookie"
+	InjectPath      InjectionKind = "path"
+	InjectMarker    InjectionKind = "marker"
+)
+
+// InjectionPoint é um local da requisição base que pode receber um payload.
+// Name é o nome do parâmetro, cabeçalho ou cookie; para JSON é o caminho da
+// chave (ex.: "user.tags[0]"), para XML o caminho do nó (ex.: "/order/item[2]/sku")
+// e para segmentos de caminho o valor original do segmento. Index distingue
+// ocorrências repetidas do mesmo nome e, em segmentos, a posição no caminho.
+type InjectionPoint struct {
+	Kind     InjectionKind `json:"kind"`
+	Name     string        `json:"name"`
+	Index    int           `json:"index,omitempty"`
+	Original string        `json:"original,omitempty"`
+}
+
+func (p InjectionPoint) String() string {
+	if p.Index > 0 || p.Kind == InjectPath {
+		return fmt.Sprintf("%s:%s#%d", p.Kind, p.Name, p.Index)
+	}
+	return fmt.Sprintf("%s:%s", p.Kind, p.Name)
+}
+
+// skippedHeaders não são pontos de injeção: são recalculados no envio ou tratados como cookies.
+var skippedHeaders = map[string]bool{"Host": true, "Content-Length": true, "Cookie": true, "Transfer-Encoding": true}
+
+// EnumerateInjectionPoints encontra todos os pontos de injeção de uma requisição base.
+// Se a requisição tiver posições §marcadas§, só elas são pontos de injeção.
+func EnumerateInjectionPoints(req HTTPRequest) []InjectionPoint {
+	var points []InjectionPoint
+	walkMarkers(req, func(n int, original string) string {
+		points = append(points, InjectionPoint{Kind: InjectMarker, Name: strconv.Itoa(n), Original: original})
+		return original
+	})
+	if len(points) > 0 {
+		return points
+	}
+
+	if u, err := url.Parse(req.URL); err == nil {
+		for i, seg := range pathSegments(u) {
+			if seg == "" {
+				continue
+			}
+			name, _ := url.PathUnescape(seg)
+			points = append(points, InjectionPoint{Kind: InjectPath, Name: name, Index: i, Original: name})
+		}
+		points = append(points, urlencodedPoints(InjectQuery, u.RawQuery)...)
+	}
+
+	if len(req.Body) > 0 {
+		mediaType, params, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		switch {
+		case mediaType == "application/x-www-form-urlencoded":
+			points = append(points, urlencodedPoints(InjectForm, string(req.Body))...)
+		case mediaType == "multipart/form-data":
+			points = append(points, multipartPoints(req.Body, params["boundary"])...)
+		case strings.Contains(mediaType, "json"):
+			points = append(points, jsonPoints(req.Body)...)
+		case strings.Contains(mediaType, "xml"):
+			points = append(points, xmlPoints(req.Body)...)
+		}
+	}
+
+	for _, c := range parseCookieHeader(req.Header.Get("Cookie")) {
+		points = append(points, InjectionPoint{Kind: InjectCookie, Name: c[0], Original: c[1]})
+	}
+
+	for _, k := range sortedHeaderKeys(req.Header) {
+		if skippedHeaders[k] {
+			continue
+		}
+		points = append(points, InjectionPoint{Kind: InjectHeader, Name: k, Original: req.Header.Get(k)})
+	}
+
+	return points
+}
+
+// Apply devolve uma cópia da requisição com value colocado no ponto de injeção.
+// Um parâmetro de query ou formulário inexistente é acrescentado.
+func (p InjectionPoint) Apply(req HTTPRequest, value string) (HTTPRequest, error) {
+	out := req.clone()
+
+	switch p.Kind {
+	case InjectQuery:
+		// Só a query é reescrita; o caminho fica exatamente como estava.
+		rest, fragment, hasFragment := strings.Cut(out.URL, "#")
+		rest, query, _ := strings.Cut(rest, "?")
+		out.URL = rest + "?" + setURLEncoded(query, p.Name, p.Index, value)
+		if hasFragment {
+			out.URL += "#" + fragment
+		}
+
+	case InjectPath:
+		u, err := url.Parse(out.URL)
+		if err != nil {
+			return out, err
+		}
+		segs := pathSegments(u)
+		if p.Index < 0 || p.Index >= len(segs) {
+			return out, fmt.Errorf("path segment %d out of range", p.Index)
+		}
+		segs[p.Index] = url.PathEscape(value)
+		raw := strings.Join(segs, "/")
+		u.Path, _ = url.PathUnescape(raw)
+		u.RawPath = raw
+		out.URL = u.String()
+
+	case InjectForm:
+		out.Body = []byte(setURLEncoded(string(out.Body), p.Name, p.Index, value))
+
+	case InjectMultipart:
+		_, params, _ := mime.ParseMediaType(out.Header.Get("Content-Type"))
+		body, err := setMultipartField(out.Body, params["boundary"], p.Name, p.Index, value)
+		if err != nil {
+			return out, err
+		}
+		out.Body = body
+
+	case InjectJSON:
+		body, err := setJSONValue(out.Body, p.Name, value)
+		if err != nil {
+			return out, err
+		}
+		out.Body = body
+
+	case InjectXML:
+		body, err := setXMLValue(out.Body, p.Name, value)
+		if err != nil {
+			return out, err
+		}
+		out.Body = body
+
+	case InjectHeader:
+		out.Header.Set(p.Name, value)
+
+	case InjectMarker:
+		n, err := strconv.Atoi(p.Name)
+		if err != nil {
+			return out, fmt.Errorf("invalid marker %q", p.Name)
+		}
+		out = walkMarkers(out, func(i int, original string) string {
+			if i == n {
+				return value
+			}
+			return original
+		})
+
+	case InjectCookie:
+		cookies := parseCookieHeader(out.Header.Get("Cookie"))
+		found := false
+		for i := range cookies {
+			if cookies[i][0] == p.Name {
+				cookies[i][1] = value
+				found = true
+			}
+		}
+		if !found {
+			cookies = append(cookies, [2]string{p.Name, value})
+		}
+		parts := make([]string, len(cookies))
+		for i, c := range cookies {
+			parts[i] = c[0] + "=" + c[1]
+		}
+		out.Header.Set("Cookie", strings.Join(parts, "; "))
+
+	default:
+		return out, fmt.Errorf("unknown injection kind %q", p.Kind)
+	}
+
+	return out, nil
+}
+
+// markerDelim delimita as posições de injeção escolhidas pelo usuário em uma
+// requisição bruta (ex.: "id=§42§"), como no Intruder do Burp.
+const markerDelim = "§"
+
+// walkMarkers devolve uma cópia da requisição em que cada par de marcadores
+// (numerados a partir de 1 na ordem URL, cabeçalhos e corpo) é trocado pelo
+// retorno de fn. Na URL, os bytes que não podem ir na linha de requisição são
+// codificados.
+func walkMarkers(req HTTPRequest, fn func(n int, original string) string) HTTPRequest {
+	out := req.clone()
+	n := 0
+	replace := func(s string, inURL bool) string {
+		if !strings.Contains(s, markerDelim) {
+			return s
+		}
+		var sb strings.Builder
+		for {
+			start := strings.Index(s, markerDelim)
+			if start < 0 {
+				break
+			}
+			end := strings.Index(s[start+len(markerDelim):], markerDelim)
+			if end < 0 {
+				break
+			}
+			end += start + len(markerDelim)
+			n++
+			original := s[start+len(markerDelim) : end]
+			v := fn(n, original)
+			if inURL && v != original {
+				v = escapeTarget(v)
+			}
+			sb.WriteString(s[:start])
+			sb.WriteString(v)
+			s = s[end+len(markerDelim):]
+		}
+		sb.WriteString(s)
+		return sb.String()
+	}
+
+	out.URL = replace(out.URL, true)
+	for _, k := range sortedHeaderKeys(out.Header) {
+		for i, v := range out.Header[k] {
+			out.Header[k][i] = replace(v, false)
+		}
+	}
+	out.Body = []byte(replace(string(out.Body), false))
+	return out
+}
+
+// HasMarkers informa se a requisição tem posições §marcadas§.
+func HasMarkers(req HTTPRequest) bool {
+	found := false
+	walkMarkers(req, func(_ int, original string) string {
+		found = true
+		return original
+	})
+	return found
+}
+
+// FillMarkers coloca value em todas as posições §marcadas§ da requisição.
+func FillMarkers(req HTTPRequest, value string) HTTPRequest {
+	return walkMarkers(req, func(int, string) string { return value })
+}
+
+// stripMarkers remove os marcadores, mantendo os valores originais entre eles.
+func stripMarkers(req HTTPRequest) HTTPRequest {
+	return walkMarkers(req, func(_ int, original string) string { return original })
+}
+
+// escapeTarget codifica apenas o que não pode ir na linha de requisição
+// (espaços, controles, bytes não ASCII e "#"); o resto vai como está.
+func escapeTarget(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c >= 0x7f || c == '#' {
+			fmt.Fprintf(&sb, "%%%02X", c)
+			continue
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+func (r HTTPRequest) clone() HTTPRequest {
+	out := r
+	out.Header = r.Header.Clone()
+	if out.Header == nil {
+		out.Header = make(map[string][]string)
+	}
+	out.Body = append([]byte(nil), r.Body...)
+	return out
+}
+
+// pathSegments devolve os segmentos do caminho ainda codificados; o primeiro é
+// vazio quando o caminho começa com "/".
+func pathSegments(u *url.URL) []string {
+	return strings.Split(u.EscapedPath(), "/")
+}
+
+func urlencodedPoints(kind InjectionKind, raw string) []InjectionPoint {
+	var points []InjectionPoint
+	seen := map[string]int{}
+	for _, pair := range strings.Split(raw, "&") {
+		if pair == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(pair, "=")
+		name, err := url.QueryUnescape(k)
+		if err != nil {
+			name = k
+		}
+		val, err := url.QueryUnescape(v)
+		if err != nil {
+			val = v
+		}
+		points = append(points, InjectionPoint{Kind: kind, Name: name, Index: seen[name], Original: val})
+		seen[name]++
+	}
+	return points
+}
+
+// setURLEncoded troca o valor da index-ésima ocorrência de name sem reordenar os
+// demais parâmetros.
+func setURLEncoded(raw, name string, index int, value string) string {
+	pairs := strings.Split(raw, "&")
+	seen := 0
+	for i, pair := range pairs {
+		k, _, _ := strings.Cut(pair, "=")
+		if n, err := url.QueryUnescape(k); err == nil && n == name || k == name {
+			if seen == index {
+				pairs[i] = k + "=" + url.QueryEscape(value)
+				return strings.Join(pairs, "&")
+			}
+			seen++
+		}
+	}
+	extra := url.QueryEscape(name) + "=" + url.QueryEscape(value)
+	if raw == "" {
+		return extra
+	}
+	return raw + "&" + extra
+}
+
+func multipartPoints(body []byte, boundary string) []InjectionPoint {
+	var points []InjectionPoint
+	if boundary == "" {
+		return nil
+	}
+	seen := map[string]int{}
+	mr := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		name := part.FormName()
+		if name == "" || part.FileName() != "" {
+			continue
+		}
+		val, _ := io.ReadAll(part)
+		points = append(points, InjectionPoint{Kind: InjectMultipart, Name: name, Index: seen[name], Original: string(val)})
+		seen[name]++
+	}
+	return points
+}
+
+func setMultipartField(body []byte, boundary, name string, index int, value string) ([]byte, error) {
+	if boundary == "" {
+		return nil, fmt.Errorf("multipart body without boundary")
+	}
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	if err := mw.SetBoundary(boundary); err != nil {
+		return nil, err
+	}
+
+	mr := multipart.NewReader(bytes.NewReader(body), boundary)
+	seen := 0
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == name && part.FileName() == "" {
+			if seen == index {
+				content = []byte(value)
+			}
+			seen++
+		}
+		w, err := mw.CreatePart(part.Header)
+		if err != nil {
+			return nil, err
+		}
+		w.Write(content)
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func jsonPoints(body []byte) []InjectionPoint {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil
+	}
+
+	var points []InjectionPoint
+	var walk func(path string, v interface{})
+	walk = func(path string, v interface{}) {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			keys := make([]string, 0, len(t))
+			for k := range t {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				p := k
+				if path != "" {
+					p = path + "." + k
+				}
+				walk(p, t[k])
+			}
+		case []interface{}:
+			for i, item := range t {
+				walk(fmt.Sprintf("%s[%d]", path, i), item)
+			}
+		case nil:
+			points = append(points, InjectionPoint{Kind: InjectJSON, Name: path})
+		default:
+			points = append(points, InjectionPoint{Kind: InjectJSON, Name: path, Original: fmt.Sprint(t)})
+		}
+	}
+	walk("", doc)
+	return points
+}
+
+// splitJSONPath converte "a.b[0].c" em ["a", "b", 0, "c"].
+func splitJSONPath(path string) []interface{} {
+	var out []interface{}
+	for _, part := range strings.Split(path, ".") {
+		for part != "" {
+			i := strings.IndexByte(part, '[')
+			if i < 0 {
+				out = append(out, part)
+				break
+			}
+			if i > 0 {
+				out = append(out, part[:i])
+			}
+			j := strings.IndexByte(part[i:], ']')
+			if j < 0 {
+				out = append(out, part[i:])
+				break
+			}
+			if n, err := strconv.Atoi(part[i+1 : i+j]); err == nil {
+				out = append(out, n)
+			}
+			part = part[i+j+1:]
+		}
+	}
+	return out
+}
+
+func setJSONValue(body []byte, path, value string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid JSON body: %w", err)
+	}
+
+	keys := splitJSONPath(path)
+	if len(keys) == 0 {
+		doc = value
+	} else {
+		parent := doc
+		for i, key := range keys {
+			last := i == len(keys)-1
+			switch k := key.(type) {
+			case string:
+				m, ok := parent.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("JSON path %s: %s is not an object", path, k)
+				}
+				if last {
+					m[k] = value
+				} else {
+					parent = m[k]
+				}
+			case int:
+				a, ok := parent.([]interface{})
+				if !ok || k >= len(a) {
+					return nil, fmt.Errorf("JSON path %s: index %d out of range", path, k)
+				}
+				if last {
+					a[k] = value
+				} else {
+					parent = a[k]
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+type xmlLeaf struct {
+	path       string
+	start, end int64
+	text       string
+}
+
+// xmlLeaves localiza o texto de cada elemento folha pelo deslocamento no corpo
+// original, para que a substituição preserve o restante do documento.
+func xmlLeaves(body []byte) ([]xmlLeaf, error) {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	dec.Strict = false
+
+	type frame struct {
+		path     string
+		hasChild bool
+		start    int64
+		text     strings.Builder
+		counts   map[string]int
+	}
+	stack := []*frame{{counts: map[string]int{}}}
+	var leaves []xmlLeaf
+
+	for {
+		offset := dec.InputOffset()
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		top := stack[len(stack)-1]
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			top.hasChild = true
+			name := t.Name.Local
+			if t.Name.Space != "" {
+				name = t.Name.Space + ":" + name
+			}
+			top.counts[name]++
+			path := top.path + "/" + name
+			if n := top.counts[name]; n > 1 {
+				path = fmt.Sprintf("%s[%d]", path, n)
+			}
+			stack = append(stack, &frame{path: path, start: dec.InputOffset(), counts: map[string]int{}})
+		case xml.CharData:
+			top.text.Write(t)
+		case xml.EndElement:
+			if len(stack) > 1 {
+				// Elementos auto-fechados (<a/>) não têm onde receber texto sem reescrever a tag.
+				selfClosing := top.start >= 2 && string(body[top.start-2:top.start]) == "/>"
+				if !top.hasChild && !selfClosing {
+					leaves = append(leaves, xmlLeaf{path: top.path, start: top.start, end: offset, text: top.text.String()})
+				}
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	return leaves, nil
+}
+
+func xmlPoints(body []byte) []InjectionPoint {
+	leaves, err := xmlLeaves(body)
+	if err != nil {
+		return nil
+	}
+	points := make([]InjectionPoint, 0, len(leaves))
+	for _, l := range leaves {
+		points = append(points, InjectionPoint{Kind: InjectXML, Name: l.path, Original: strings.TrimSpace(l.text)})
+	}
+	return points
+}
+
+// setXMLValue troca o conteúdo do nó sem escapar o valor, já que payloads XML
+// (entidades, CDATA) precisam chegar ao parser do alvo como foram escritos.
+func setXMLValue(body []byte, path, value string) ([]byte, error) {
+	leaves, err := xmlLeaves(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid XML body: %w", err)
+	}
+	for _, l := range leaves {
+		if l.path == path {
+			out := make([]byte, 0, len(body)+len(value))
+			out = append(out, body[:l.start]...)
+			out = append(out, value...)
+			out = append(out, body[l.end:]...)
+			return out, nil
+		}
+	}
+	return nil, fmt.Errorf("XML node %s not found", path)
+}
+
+// parseCookieHeader divide um cabeçalho Cookie em pares nome/valor preservando a ordem.
+func parseCookieHeader(h string) [][2]string {
+	var out [][2]string
+	for _, part := range strings.Split(h, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(part, "=")
+		out = append(out, [2]string{strings.TrimSpace(k), v})
+	}
+	return out
+}
@@ -0,0 +1,150 @@
+package active
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestEnumerateInjectionPointsRaw(t *testing.T) {
+	raw := "POST /api/v1/orders?debug=1&debug=2 HTTP/1.1\r\n" +
+		"Host: shop.example\r\n" +
+		"Cookie: session=abc; theme=dark\r\n" +
+		"User-Agent: test\r\n" +
+		"Content-Type: application/json\r\n" +
+		"Content-Length: 40\r\n\r\n" +
+		`{"user":{"name":"bob"},"items":[1,"x"]}`
+
+	req, err := ParseRawRequest([]byte(raw), "https")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.URL != "https://shop.example/api/v1/orders?debug=1&debug=2" {
+		t.Fatalf("unexpected URL %s", req.URL)
+	}
+
+	got := map[string]bool{}
+	for _, p := range EnumerateInjectionPoints(req) {
+		got[p.String()] = true
+	}
+	for _, want := range []string{
+		"path:api#1", "path:orders#3", "query:debug", "query:debug#1",
+		"json:user.name", "json:items[0]", "json:items[1]",
+		"cookie:session", "cookie:theme", "header:User-Agent", "header:Content-Type",
+	} {
+		if !got[want] {
+			t.Errorf("missing point %s (got %v)", want, got)
+		}
+	}
+	if got["header:Cookie"] || got["header:Content-Length"] {
+		t.Errorf("structural headers must not be injection points: %v", got)
+	}
+}
+
+func TestInjectionPointApply(t *testing.T) {
+	base := HTTPRequest{
+		Method: http.MethodPost,
+		URL:    "http://t/a/b?x=1&y=2",
+		Header: http.Header{"Cookie": {"s=1; t=2"}, "Content-Type": {"application/x-www-form-urlencoded"}},
+		Body:   []byte("f=1&g=2"),
+	}
+
+	cases := []struct {
+		point InjectionPoint
+		check func(HTTPRequest) bool
+	}{
+		{InjectionPoint{Kind: InjectQuery, Name: "y"}, func(r HTTPRequest) bool { return r.URL == "http://t/a/b?x=1&y=%3Cv%3E" }},
+		{InjectionPoint{Kind: InjectPath, Name: "b", Index: 2}, func(r HTTPRequest) bool { return r.URL == "http://t/a/%3Cv%3E?x=1&y=2" }},
+		{InjectionPoint{Kind: InjectForm, Name: "f"}, func(r HTTPRequest) bool { return string(r.Body) == "f=%3Cv%3E&g=2" }},
+		{InjectionPoint{Kind: InjectCookie, Name: "t"}, func(r HTTPRequest) bool { return r.Header.Get("Cookie") == "s=1; t=<v>" }},
+		{InjectionPoint{Kind: InjectHeader, Name: "Referer"}, func(r HTTPRequest) bool { return r.Header.Get("Referer") == "<v>" }},
+	}
+	for _, c := range cases {
+		out, err := c.point.Apply(base, "<v>")
+		if err != nil {
+			t.Fatalf("%s: %v", c.point, err)
+		}
+		if !c.check(out) {
+			t.Errorf("%s: unexpected request %+v body=%q", c.point, out, out.Body)
+		}
+	}
+	if base.Header.Get("Referer") != "" || string(base.Body) != "f=1&g=2" {
+		t.Fatal("Apply must not modify the base request")
+	}
+}
+
+func TestInjectionPointApplyXMLAndMultipart(t *testing.T) {
+	xmlReq := HTTPRequest{
+		URL:    "http://t/",
+		Header: http.Header{"Content-Type": {"application/xml"}},
+		Body:   []byte(`<?xml version="1.0"?><order><item><sku>A1</sku></item><item><sku>B2</sku></item><note/></order>`),
+	}
+	points := EnumerateInjectionPoints(xmlReq)
+	if len(points) != 3 || points[2].Kind != InjectHeader || points[1].Name != "/order/item[2]/sku" || points[1].Original != "B2" {
+		t.Fatalf("unexpected XML points %+v", points)
+	}
+	out, err := points[1].Apply(xmlReq, "&xxe;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out.Body), "<sku>A1</sku></item><item><sku>&xxe;</sku>") {
+		t.Fatalf("unexpected XML body %s", out.Body)
+	}
+
+	body := "--XB\r\nContent-Disposition: form-data; name=\"title\"\r\n\r\nhello\r\n" +
+		"--XB\r\nContent-Disposition: form-data; name=\"file\"; filename=\"a.txt\"\r\n\r\ndata\r\n--XB--\r\n"
+	mpReq := HTTPRequest{
+		URL:    "http://t/",
+		Header: http.Header{"Content-Type": {"multipart/form-data; boundary=XB"}},
+		Body:   []byte(body),
+	}
+	points = EnumerateInjectionPoints(mpReq)
+	var title InjectionPoint
+	for _, p := range points {
+		if p.Kind == InjectMultipart {
+			title = p
+		}
+	}
+	if title.Name != "title" || title.Original != "hello" {
+		t.Fatalf("unexpected multipart points %+v", points)
+	}
+	out, err = title.Apply(mpReq, "<v>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out.Body), "\r\n\r\n<v>\r\n--XB") || !strings.Contains(string(out.Body), "data") {
+		t.Fatalf("unexpected multipart body %q", out.Body)
+	}
+}
+
+func TestEnumerateInjectionPointsMarkers(t *testing.T) {
+	raw := "POST /a/../b?id=§42§&x=1 HTTP/1.1\r\n" +
+		"Host: t\r\n" +
+		"X-Token: §abc§\r\n\r\n" +
+		"name=§bob§&age=3"
+
+	req, err := ParseRawRequest([]byte(raw), "http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	points := EnumerateInjectionPoints(req)
+	if len(points) != 3 {
+		t.Fatalf("only marked positions must be injection points, got %v", points)
+	}
+	for i, want := range []string{"42", "abc", "bob"} {
+		if points[i].Kind != InjectMarker || points[i].Original != want {
+			t.Errorf("point %d: got %+v, want marker %q", i, points[i], want)
+		}
+	}
+
+	out, err := points[0].Apply(req, "1 OR 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.URL != "http://t/a/../b?id=1%20OR%201&x=1" || out.Header.Get("X-Token") != "abc" || string(out.Body) != "name=bob&age=3" {
+		t.Fatalf("unexpected request %+v body=%q", out, out.Body)
+	}
+	if clean := stripMarkers(req); clean.URL != "http://t/a/../b?id=42&x=1" || HasMarkers(clean) {
+		t.Fatalf("stripMarkers left %+v", clean)
+	}
+}
@@ -0,0 +1,149 @@
+package active
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ghostn3xus/reconsec/pkg/report"
+)
+
+// Step é uma etapa de uma sequência (macro). As etapas rodam em ordem a cada
+// tentativa e os valores extraídos viram variáveis ({{nome}}) das seguintes.
+type Step struct {
+	Name       string      `json:"name,omitempty" yaml:"name,omitempty"`
+	Request    RequestDef  `json:"request" yaml:"request"`
+	Extractors []Extractor `json:"extractors,omitempty" yaml:"extractors,omitempty"`
+
+	// Inject marca a etapa que recebe o payload; sem nenhuma marcada, é a última.
+	Inject bool `json:"inject,omitempty" yaml:"inject,omitempty"`
+}
+
+// isMacro informa se o template é uma sequência de etapas.
+func (p PayloadTemplate) isMacro() bool {
+	return len(p.Steps) > 0
+}
+
+// injectStep devolve o índice da etapa que recebe o payload.
+func (p PayloadTemplate) injectStep() int {
+	for i, s := range p.Steps {
+		if s.Inject {
+			return i
+		}
+	}
+	return len(p.Steps) - 1
+}
+
+func (s Step) label(i int) string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return fmt.Sprintf("step %d", i+1)
+}
+
+// planMacroJobs monta um job por ponto de injeção da etapa marcada. Cada job
+// roda a sequência inteira com o valor benigno (linha de base, compartilhada
+// pelas variantes do mesmo ponto) e depois com o payload; os matchers avaliam a
+// resposta da última etapa.
+func planMacroJobs(base HTTPRequest, p PayloadTemplate, vars map[string]string) ([]job, error) {
+	single := p
+	single.Steps = nil
+	single.Request = &p.Steps[p.injectStep()].Request
+	attempts, err := planAttemptsWith(base, single, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := &baselineCache{}
+	var jobs []job
+	for _, a := range attempts {
+		a := a
+		jobs = append(jobs, job{
+			host:    requestHost(a.req.URL),
+			payload: p,
+			attempt: a,
+			probe: func(ctx context.Context, send sendFunc) evaluation {
+				clean, err := cache.get(ctx, a.clean, 1, func(ctx context.Context, _ HTTPRequest) (*Exchange, error) {
+					ex, _, err := runMacro(ctx, send, base, p, a.redoClean)
+					return ex, err
+				})
+				if err != nil {
+					return probeError(err)
+				}
+				ex, steps, err := runMacro(ctx, send, base, p, a.redo)
+				if err != nil {
+					return probeError(err)
+				}
+				ev := evaluateAttempt(p, a, ex, clean)
+				if ev.finding != nil {
+					ev.finding.Evidence.Steps = steps
+					ev.finding.Notes += fmt.Sprintf(" Injected at %s of a %d-step sequence.", p.Steps[p.injectStep()].label(p.injectStep()), len(p.Steps))
+				}
+				return ev
+			},
+		})
+	}
+	return jobs, nil
+}
+
+// runMacro envia as etapas em ordem. As variáveis extraídas são renderizadas em
+// cada etapa antes de inject aplicar o payload (ou o valor benigno) à etapa
+// marcada. Devolve a resposta da última etapa.
+func runMacro(ctx context.Context, send sendFunc, base HTTPRequest, p PayloadTemplate, inject func(HTTPRequest) (HTTPRequest, error)) (*Exchange, []report.MacroStep, error) {
+	at := p.injectStep()
+	clean := stripMarkers(base)
+	vars := map[string]string{}
+	var (
+		last  *Exchange
+		steps []report.MacroStep
+	)
+	for i, st := range p.Steps {
+		def := st.Request.render(vars)
+		from := clean
+		if i == at {
+			from = base
+		}
+		req, err := buildTemplateRequest(from, &def)
+		if err != nil {
+			return nil, steps, fmt.Errorf("macro %s: %w", st.label(i), err)
+		}
+		if i == at {
+			if req, err = inject(req); err != nil {
+				return nil, steps, fmt.Errorf("macro %s: %w", st.label(i), err)
+			}
+		}
+		ex, err := send(ctx, req)
+		if err != nil {
+			return nil, steps, err
+		}
+
+		rec := report.MacroStep{Name: st.label(i), Request: ex.Request.Raw(), Status: ex.Status, Injected: i == at}
+		for _, e := range st.Extractors {
+			values := e.Extract(ex)
+			if len(values) == 0 {
+				return nil, steps, fmt.Errorf("macro %s: extractor %s found nothing (status %d)", st.label(i), e.Name, ex.Status)
+			}
+			vars[e.Name] = values[0]
+			if rec.Extracted == nil {
+				rec.Extracted = map[string]string{}
+			}
+			rec.Extracted[e.Name] = values[0]
+		}
+		steps = append(steps, rec)
+		last = ex
+	}
+	return last, steps, nil
+}
+
+// render substitui as variáveis extraídas em caminho, cabeçalhos e corpo.
+func (d RequestDef) render(vars map[string]string) RequestDef {
+	out := d
+	out.Path, _ = renderString(d.Path, vars)
+	out.Body, _ = renderString(d.Body, vars)
+	if d.Headers != nil {
+		out.Headers = map[string]string{}
+		for k, v := range d.Headers {
+			out.Headers[k], _ = renderString(v, vars)
+		}
+	}
+	return out
+}
@@ -0,0 +1,111 @@
+package active
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMacroInjectsOnlyTheMarkedStep(t *testing.T) {
+	// O checkout só reflete a nota de um carrinho recém-criado, e cada carrinho vale uma vez.
+	var mu sync.Mutex
+	carts := map[string]bool{}
+	n := 0
+	var addBodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		r.ParseForm()
+		switch r.URL.Path {
+		case "/cart/add":
+			n++
+			id := fmt.Sprint("c", n)
+			carts[id] = true
+			addBodies = append(addBodies, r.PostForm.Encode())
+			fmt.Fprintf(w, `{"cart":{"id":%q}}`, id)
+		case "/checkout":
+			if !carts[r.PostForm.Get("cart")] {
+				w.WriteHeader(http.StatusConflict)
+				fmt.Fprint(w, "no cart")
+				return
+			}
+			delete(carts, r.PostForm.Get("cart"))
+			fmt.Fprintf(w, "<p>Order note: %s</p>", r.PostForm.Get("note"))
+		}
+	}))
+	defer srv.Close()
+
+	dir := writePayloads(t, `[{"name":"checkout-xss","category":"xss","template":"<b>{{INJECT}}</b>",
+  "steps":[
+    {"name":"add","request":{"method":"POST","path":"/cart/add","headers":{"Content-Type":"application/x-www-form-urlencoded"},"body":"item=1"},
+     "extractors":[{"name":"cart_id","type":"json","json":["cart.id"]}]},
+    {"name":"checkout","inject":true,"request":{"method":"POST","path":"/checkout","headers":{"Content-Type":"application/x-www-form-urlencoded"},"body":"cart={{cart_id}}&note=hello"}}
+  ]}]`)
+	res, err := RunActiveScan(ActiveOptions{URL: srv.URL + "/", PayloadsPath: dir, PayloadApproval: unsigned, Rate: 1000, SkipWAFDetection: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Findings) != 1 {
+		t.Fatalf("expected the checkout note reflection, got %+v (stats %+v)", res.Findings, res.Stats)
+	}
+	f := res.Findings[0]
+	if !strings.Contains(f.Notes, "form:note") || !strings.Contains(f.Notes, "checkout of a 2-step sequence") {
+		t.Fatalf("unexpected notes %q", f.Notes)
+	}
+	steps := f.Evidence.Steps
+	if len(steps) != 2 || steps[0].Injected || !steps[1].Injected || steps[0].Extracted["cart_id"] == "" {
+		t.Fatalf("unexpected step evidence %+v", steps)
+	}
+	if !strings.Contains(steps[1].Request, "cart="+steps[0].Extracted["cart_id"]) {
+		t.Fatalf("the extracted cart must be sent at checkout, got %q", steps[1].Request)
+	}
+	for _, body := range addBodies {
+		if body != "item=1" {
+			t.Fatalf("only the marked step may receive the injection, add got %q", body)
+		}
+	}
+	// Quatro pontos (caminho, cart, note e Content-Type), cada um com uma
+	// sequência limpa e uma com payload.
+	if st := res.Stats; st.Attempts != 4 || st.Requests != 16 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
+
+func TestMacroExtractorFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	dir := writePayloads(t, `[{"name":"m","category":"marker","template":"{{INJECT}}","steps":[
+  {"request":{"path":"/token"},"extractors":[{"name":"tok","type":"regex","regex":["token=(\\w+)"],"group":1}]},
+  {"request":{"path":"/use?t={{tok}}&q=1"}}]}]`)
+	res, err := RunActiveScan(ActiveOptions{URL: srv.URL + "/", PayloadsPath: dir, PayloadApproval: unsigned, Rate: 1000, SkipWAFDetection: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Findings) != 0 || res.Stats.Errors == 0 || !strings.Contains(res.Stats.ErrorSamples[0], "macro step 1: extractor tok found nothing (status 403)") {
+		t.Fatalf("expected an extractor error in the stats, got %+v", res.Stats)
+	}
+}
+
+func TestValidateMacroTemplate(t *testing.T) {
+	probs := validateTemplate(PayloadTemplate{
+		Name: "m", Category: "marker", Template: "{{INJECT}}",
+		Request: &RequestDef{Path: "/x"},
+		Steps:   []Step{{Inject: true}, {Inject: true, Extractors: []Extractor{{Name: "a", Type: "kval"}}}},
+	})
+	var msgs []string
+	for _, p := range probs {
+		msgs = append(msgs, joinField("t", p.path)+": "+p.msg)
+	}
+	got := strings.Join(msgs, "\n")
+	for _, want := range []string{"t.steps: request and steps cannot be used together", "t.steps[1].inject: only one step", "t.steps[1].extractors[0].kval: kval extractor needs"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,383 @@
+package active
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// RequestDef descreve a requisição de um template. Path é relativo à URL alvo
+// (ou absoluto) e, assim como Headers e Body, aceita {{INJECT}}; quando nenhum
+// campo contém {{INJECT}}, o payload é aplicado a cada ponto de injeção.
+type RequestDef struct {
+	Method  string            `json:"method,omitempty" yaml:"method,omitempty"`
+	Path    string            `json:"path,omitempty" yaml:"path,omitempty"`
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Body    string            `json:"body,omitempty" yaml:"body,omitempty"`
+}
+
+// Matcher decide, a partir da resposta real, se um payload teve efeito.
+// Type pode ser status, word, regex, size ou time. Os valores são combinados
+// por Condition ("or" por padrão) e o resultado é invertido se Negative.
+// Words e Regex aceitam {{payload}} e {{marker}}; em Regex, o valor das
+// variáveis entra como texto literal.
+type Matcher struct {
+	Name            string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Type            string   `json:"type" yaml:"type"`
+	Part            string   `json:"part,omitempty" yaml:"part,omitempty"`
+	Words           []string `json:"words,omitempty" yaml:"words,omitempty"`
+	Regex           []string `json:"regex,omitempty" yaml:"regex,omitempty"`
+	Status          []int    `json:"status,omitempty" yaml:"status,omitempty"`
+	Size            []int    `json:"size,omitempty" yaml:"size,omitempty"`
+	Duration        float64  `json:"duration,omitempty" yaml:"duration,omitempty"`
+	Condition       string   `json:"condition,omitempty" yaml:"condition,omitempty"`
+	Negative        bool     `json:"negative,omitempty" yaml:"negative,omitempty"`
+	CaseInsensitive bool     `json:"case-insensitive,omitempty" yaml:"case-insensitive,omitempty"`
+}
+
+// Extractor captura valores da resposta. Type pode ser regex (usa Group),
+// kval (nomes de cabeçalho ou cookie) ou json (caminhos como "data.items[0].id").
+type Extractor struct {
+	Name  string   `json:"name" yaml:"name"`
+	Type  string   `json:"type" yaml:"type"`
+	Part  string   `json:"part,omitempty" yaml:"part,omitempty"`
+	Regex []string `json:"regex,omitempty" yaml:"regex,omitempty"`
+	Group int      `json:"group,omitempty" yaml:"group,omitempty"`
+	KVal  []string `json:"kval,omitempty" yaml:"kval,omitempty"`
+	JSON  []string `json:"json,omitempty" yaml:"json,omitempty"`
+}
+
+// defaultMatchers mantém o comportamento de antes do DSL: o payload refletido sem alteração.
+var defaultMatchers = []Matcher{{Name: "reflection", Type: "word", Words: []string{"{{payload}}"}}}
+
+// regexCache guarda as expressões dos templates. Expressões com variáveis mudam
+// a cada requisição (marcadores únicos) e não entram no cache.
+var (
+	regexCacheMu sync.Mutex
+	regexCache   = map[string]*regexp.Regexp{}
+)
+
+func compileRegex(expr string) (*regexp.Regexp, error) {
+	regexCacheMu.Lock()
+	defer regexCacheMu.Unlock()
+	if re, ok := regexCache[expr]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	regexCache[expr] = re
+	return re, nil
+}
+
+// matcherRegex compila uma expressão de matcher com as variáveis da requisição
+// escapadas, para que um payload com "(", "[" ou "*" case literalmente.
+func matcherRegex(expr string, vars map[string]string, caseInsensitive bool) (*regexp.Regexp, error) {
+	expanded, _ := renderStringQuoted(expr, vars, regexp.QuoteMeta)
+	static := expanded == expr
+	if caseInsensitive {
+		expanded = "(?i)" + expanded
+	}
+	if static {
+		return compileRegex(expanded)
+	}
+	return regexp.Compile(expanded)
+}
+
+// responsePart devolve a parte da resposta que um matcher ou extractor inspeciona.
+func responsePart(ex *Exchange, part string) string {
+	switch part {
+	case "", "body":
+		return string(ex.Body)
+	case "header":
+		return rawHeaders(ex.Header)
+	case "all", "response":
+		return rawHeaders(ex.Header) + "\r\n" + string(ex.Body)
+	case "request":
+		return ex.Request.Raw()
+	default:
+		// Nome de um cabeçalho específico, ex.: "location".
+		return strings.Join(ex.Header.Values(part), "\n")
+	}
+}
+
+func rawHeaders(h http.Header) string {
+	var sb strings.Builder
+	for _, k := range sortedHeaderKeys(h) {
+		for _, v := range h[k] {
+			fmt.Fprintf(&sb, "%s: %s\r\n", k, v)
+		}
+	}
+	return sb.String()
+}
+
+// expandVars substitui as variáveis da requisição, aceitando o mesmo pipeline de
+// funções dos templates (ex.: {{payload|html}}).
+func expandVars(s string, vars map[string]string) string {
+	out, _ := renderString(s, vars)
+	return out
+}
+
+// Match avalia o matcher contra a resposta.
+func (m Matcher) Match(ex *Exchange, vars map[string]string) (bool, error) {
+	and := strings.EqualFold(m.Condition, "and")
+	var results []bool
+
+	switch m.Type {
+	case "status":
+		for _, s := range m.Status {
+			results = append(results, ex.Status == s)
+		}
+	case "size":
+		for _, s := range m.Size {
+			results = append(results, len(ex.Body) == s)
+		}
+	case "time":
+		results = append(results, ex.Duration >= time.Duration(m.Duration*float64(time.Second)))
+	case "word":
+		data := responsePart(ex, m.Part)
+		if m.CaseInsensitive {
+			data = strings.ToLower(data)
+		}
+		for _, w := range m.Words {
+			w = expandVars(w, vars)
+			if m.CaseInsensitive {
+				w = strings.ToLower(w)
+			}
+			results = append(results, strings.Contains(data, w))
+		}
+	case "regex":
+		data := responsePart(ex, m.Part)
+		for _, expr := range m.Regex {
+			re, err := matcherRegex(expr, vars, m.CaseInsensitive)
+			if err != nil {
+				return false, fmt.Errorf("matcher %s: %w", m.Name, err)
+			}
+			results = append(results, re.MatchString(data))
+		}
+	default:
+		return false, fmt.Errorf("unknown matcher type %q", m.Type)
+	}
+
+	matched := len(results) > 0 && and
+	for _, r := range results {
+		if and && !r {
+			matched = false
+			break
+		}
+		if !and && r {
+			matched = true
+			break
+		}
+	}
+
+	if m.Negative {
+		return !matched, nil
+	}
+	return matched, nil
+}
+
+// MatchResponse avalia os matchers do template (ou a reflexão do payload, se
+// não houver nenhum) e devolve os nomes dos que casaram.
+func (p PayloadTemplate) MatchResponse(ex *Exchange, vars map[string]string) (bool, []string, error) {
+	matchers := p.matchers()
+	and := strings.EqualFold(p.MatchersCondition, "and")
+
+	var names []string
+	for i, m := range matchers {
+		ok, err := m.Match(ex, vars)
+		if err != nil {
+			return false, nil, err
+		}
+		if !ok {
+			if and {
+				return false, nil, nil
+			}
+			continue
+		}
+		name := m.Name
+		if name == "" {
+			name = fmt.Sprintf("%s-%d", m.Type, i)
+		}
+		names = append(names, name)
+	}
+
+	return len(names) > 0, names, nil
+}
+
+func (p PayloadTemplate) matchers() []Matcher {
+	if len(p.Matchers) == 0 {
+		return defaultMatchers
+	}
+	return p.Matchers
+}
+
+// excerptContext é quantos bytes de contexto o trecho de evidência mostra de cada lado.
+const excerptContext = 80
+
+// locate devolve a parte inspecionada e a posição da primeira ocorrência de um
+// matcher word ou regex. Os demais tipos (e os negativos) não têm posição.
+func (m Matcher) locate(ex *Exchange, vars map[string]string) (string, int, int, bool) {
+	if m.Negative {
+		return "", 0, 0, false
+	}
+	data := responsePart(ex, m.Part)
+	switch m.Type {
+	case "word":
+		hay := data
+		if m.CaseInsensitive {
+			hay = strings.ToLower(data)
+		}
+		for _, w := range m.Words {
+			w = expandVars(w, vars)
+			if m.CaseInsensitive {
+				w = strings.ToLower(w)
+			}
+			if i := strings.Index(hay, w); w != "" && i >= 0 && i+len(w) <= len(data) {
+				return data, i, i + len(w), true
+			}
+		}
+	case "regex":
+		for _, expr := range m.Regex {
+			re, err := matcherRegex(expr, vars, m.CaseInsensitive)
+			if err != nil {
+				continue
+			}
+			if loc := re.FindStringIndex(data); loc != nil {
+				return data, loc[0], loc[1], true
+			}
+		}
+	}
+	return "", 0, 0, false
+}
+
+// matchExcerpt devolve o trecho da resposta em volta do que casou; sem posição
+// conhecida (status, size, time), a linha de status e o início do corpo.
+func (p PayloadTemplate) matchExcerpt(ex *Exchange, vars map[string]string) string {
+	for _, m := range p.matchers() {
+		if data, start, end, ok := m.locate(ex, vars); ok {
+			return excerpt(data, start, end)
+		}
+	}
+	return responseHead(ex)
+}
+
+func responseHead(ex *Exchange) string {
+	return fmt.Sprintf("HTTP %d %s\n%s", ex.Status, http.StatusText(ex.Status), excerpt(string(ex.Body), 0, excerptContext))
+}
+
+// excerpt recorta data[start:end] com excerptContext bytes de cada lado, sem
+// partir caracteres UTF-8; "..." marca o que foi cortado.
+func excerpt(data string, start, end int) string {
+	from, to := start-excerptContext, end+excerptContext
+	prefix, suffix := "...", "..."
+	if from <= 0 {
+		from, prefix = 0, ""
+	}
+	if to >= len(data) {
+		to, suffix = len(data), ""
+	}
+	for from > 0 && !utf8.RuneStart(data[from]) {
+		from--
+	}
+	for to < len(data) && !utf8.RuneStart(data[to]) {
+		to++
+	}
+	return prefix + data[from:to] + suffix
+}
+
+// Extract executa os extractors do template sobre a resposta.
+func (p PayloadTemplate) Extract(ex *Exchange) map[string][]string {
+	if len(p.Extractors) == 0 {
+		return nil
+	}
+	out := map[string][]string{}
+	for _, e := range p.Extractors {
+		if vals := e.Extract(ex); len(vals) > 0 {
+			out[e.Name] = append(out[e.Name], vals...)
+		}
+	}
+	return out
+}
+
+// Extract devolve os valores capturados pelo extractor.
+func (e Extractor) Extract(ex *Exchange) []string {
+	var vals []string
+	switch e.Type {
+	case "regex":
+		data := responsePart(ex, e.Part)
+		for _, expr := range e.Regex {
+			re, err := compileRegex(expr)
+			if err != nil {
+				continue
+			}
+			for _, m := range re.FindAllStringSubmatch(data, -1) {
+				if e.Group < len(m) {
+					vals = append(vals, m[e.Group])
+				}
+			}
+		}
+	case "kval":
+		for _, k := range e.KVal {
+			vals = append(vals, ex.Header.Values(k)...)
+			for _, c := range (&http.Response{Header: ex.Header}).Cookies() {
+				if c.Name == k {
+					vals = append(vals, c.Value)
+				}
+			}
+		}
+	case "json":
+		dec := json.NewDecoder(bytes.NewReader(ex.Body))
+		dec.UseNumber()
+		var doc interface{}
+		if err := dec.Decode(&doc); err != nil {
+			return nil
+		}
+		for _, path := range e.JSON {
+			if v, ok := lookupJSON(doc, path); ok {
+				vals = append(vals, v)
+			}
+		}
+	}
+	return vals
+}
+
+func lookupJSON(doc interface{}, path string) (string, bool) {
+	cur := doc
+	for _, key := range splitJSONPath(path) {
+		switch k := key.(type) {
+		case string:
+			m, ok := cur.(map[string]interface{})
+			if !ok {
+				return "", false
+			}
+			if cur, ok = m[k]; !ok {
+				return "", false
+			}
+		case int:
+			a, ok := cur.([]interface{})
+			if !ok || k >= len(a) {
+				return "", false
+			}
+			cur = a[k]
+		}
+	}
+	switch v := cur.(type) {
+	case string:
+		return v, true
+	case nil:
+		return "", false
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(v)
+		return string(b), true
+	default:
+		return fmt.Sprint(v), true
+	}
+}
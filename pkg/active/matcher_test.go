@@ -0,0 +1,97 @@
+package active
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMatchResponse(t *testing.T) {
+	ex := &Exchange{
+		Status:   500,
+		Header:   http.Header{"Set-Cookie": {"sid=42; Path=/"}, "X-Trace": {"abc"}},
+		Body:     []byte(`{"error":"You have an error in your SQL syntax near 'M1'","data":{"id":7}}`),
+		Duration: 1500 * time.Millisecond,
+	}
+	vars := map[string]string{"payload": "'M1'", "marker": "M1"}
+
+	p := PayloadTemplate{
+		Name:              "sqli-error",
+		MatchersCondition: "and",
+		Matchers: []Matcher{
+			{Name: "status", Type: "status", Status: []int{500, 502}},
+			{Name: "sql", Type: "regex", Regex: []string{`sql syntax.*{{marker}}`}, CaseInsensitive: true},
+			{Name: "no-waf", Type: "word", Part: "header", Words: []string{"cf-ray"}, Negative: true},
+			{Name: "slow", Type: "time", Duration: 1},
+		},
+		Extractors: []Extractor{
+			{Name: "id", Type: "json", JSON: []string{"data.id"}},
+			{Name: "sid", Type: "kval", KVal: []string{"sid", "X-Trace"}},
+			{Name: "near", Type: "regex", Regex: []string{`near '([^']+)'`}, Group: 1},
+		},
+	}
+
+	ok, names, err := p.MatchResponse(ex, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || len(names) != 4 {
+		t.Fatalf("expected all matchers to match, got %v %v", ok, names)
+	}
+
+	got := p.Extract(ex)
+	if got["id"][0] != "7" || got["sid"][0] != "42" || got["sid"][1] != "abc" || got["near"][0] != "M1" {
+		t.Fatalf("unexpected extraction %v", got)
+	}
+
+	p.Matchers = append(p.Matchers, Matcher{Type: "size", Size: []int{1}})
+	if ok, _, _ := p.MatchResponse(ex, vars); ok {
+		t.Fatal("and-condition must fail when one matcher fails")
+	}
+}
+
+func TestRegexMatcherQuotesVars(t *testing.T) {
+	ex := &Exchange{Status: 200, Body: []byte(`<p>a(b[c*d?</p>`)}
+	m := Matcher{Type: "regex", Regex: []string{`<p>{{payload}}</p>`}}
+
+	ok, err := m.Match(ex, map[string]string{"payload": "a(b[c*d?"})
+	if err != nil || !ok {
+		t.Fatalf("a payload with regex metacharacters must match literally, got %v %v", ok, err)
+	}
+	if ok, _ := m.Match(ex, map[string]string{"payload": "a.b.c.d."}); ok {
+		t.Fatal("payload characters must not act as regex syntax")
+	}
+
+	regexCacheMu.Lock()
+	before := len(regexCache)
+	regexCacheMu.Unlock()
+	for i := 0; i < 50; i++ {
+		m.Match(ex, map[string]string{"payload": newMarker()})
+	}
+	regexCacheMu.Lock()
+	defer regexCacheMu.Unlock()
+	if len(regexCache) != before {
+		t.Fatalf("expanded expressions must not be cached: %d -> %d", before, len(regexCache))
+	}
+}
+
+func TestPlanAttemptsTemplateRequest(t *testing.T) {
+	base := HTTPRequest{Method: http.MethodGet, URL: "https://t/app?x=1", Header: http.Header{}}
+	p := PayloadTemplate{Template: "a b", Request: &RequestDef{
+		Method:  "post",
+		Path:    "/search?q={{INJECT}}",
+		Headers: map[string]string{"X-Test": "{{INJECT}}"},
+	}}
+
+	attempts, err := planAttempts(base, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 1 || attempts[0].point != "template" {
+		t.Fatalf("expected a single template attempt, got %+v", attempts)
+	}
+	r := attempts[0].req
+	if r.Method != "POST" || r.URL != "https://t/search?q=a+b" || r.Header.Get("X-Test") != "a b" {
+		t.Fatalf("unexpected request %+v", r)
+	}
+}
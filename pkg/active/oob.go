@@ -0,0 +1,92 @@
+package active
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ghostn3xus/reconsec/pkg/report"
+)
+
+// collectOOB espera por interações atrasadas, consulta o servidor OOB e
+// transforma cada tentativa que provocou contato em achado. Em sequências, o
+// identificador é o da etapa injetada; templates por tempo e diferenciais com
+// OOB são recusados na validação.
+func collectOOB(ctx context.Context, opts ActiveOptions, jobs []job, results []*report.Finding, sent func(slot int) bool) error {
+	byID := map[string]job{}
+	var ids []string
+	for _, j := range jobs {
+		if (j.probe != nil && !j.payload.isMacro()) || !j.payload.usesOOB() || !sent(j.slot) {
+			continue
+		}
+		id := j.attempt.vars["OOB_ID"]
+		byID[id] = j
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	wait := time.Duration(opts.OOBWaitSec) * time.Second
+	if opts.OOBWaitSec <= 0 {
+		wait = 5 * time.Second
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(wait):
+	}
+
+	interactions, err := opts.OOB.Poll(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, in := range interactions {
+		j, ok := byID[in.ID]
+		if !ok {
+			continue
+		}
+		f := results[j.slot]
+		if f == nil {
+			f = &report.Finding{URL: j.attempt.req.URL}
+			results[j.slot] = f
+		}
+		if f.Evidence == nil {
+			f.Evidence = &report.Evidence{Request: j.attempt.req.Raw()}
+		}
+		f.Evidence.OOB = append(f.Evidence.OOB, report.OOBInteraction{
+			ID:         in.ID,
+			Protocol:   in.Protocol,
+			RemoteAddr: in.RemoteAddr,
+			Time:       in.Time,
+			QName:      in.QName,
+			QType:      in.QType,
+			Request:    in.Request,
+		})
+	}
+
+	for _, id := range ids {
+		j := byID[id]
+		f := results[j.slot]
+		if f == nil || f.Evidence == nil || len(f.Evidence.OOB) == 0 {
+			continue
+		}
+		var protocols []string
+		seen := map[string]bool{}
+		for _, in := range f.Evidence.OOB {
+			if !seen[in.Protocol] {
+				seen[in.Protocol] = true
+				protocols = append(protocols, in.Protocol)
+			}
+		}
+		f.Type = "VulnerabilityFound"
+		f.Severity = report.SeverityHigh
+		f.Confidence = report.ConfidenceHigh
+		f.Evidence.Matcher = "oob-" + strings.Join(protocols, ",oob-")
+		f.Notes = fmt.Sprintf("Payload '%s' at %s triggered %d out-of-band interaction(s) (%s) with id %s.",
+			j.payload.Name, j.attempt.point, len(f.Evidence.OOB), strings.Join(protocols, ", "), id)
+	}
+	return nil
+}
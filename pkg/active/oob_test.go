@@ -0,0 +1,113 @@
+package active
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ghostn3xus/reconsec/pkg/oob"
+)
+
+func TestRunActiveScanOOB(t *testing.T) {
+	server := oob.NewServer(oob.Config{DNSPort: -1})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	client, err := oob.NewClient(context.Background(), server.Info().HTTPURL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// O alvo busca a URL recebida em "u" (SSRF cego: nada é refletido).
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u := r.URL.Query().Get("u"); strings.HasPrefix(u, "http") {
+			if resp, err := http.Get(u); err == nil {
+				resp.Body.Close()
+			}
+		}
+		w.Write([]byte("done"))
+	}))
+	defer target.Close()
+
+	dir := writePayloads(t, `[{"name":"ssrf","category":"ssrf","template":"{{OOB_URL}}"}]`)
+	res, err := RunActiveScan(ActiveOptions{
+		URL:              target.URL + "/?u=x&v=y",
+		PayloadsPath:     dir,
+		PayloadApproval:  unsigned,
+		Rate:             1000,
+		SkipWAFDetection: true,
+		OOB:              client,
+		OOBWaitSec:       1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hit, miss := findingAt(res, "query:u"), findingAt(res, "query:v")
+	if hit == nil || hit.Type != "VulnerabilityFound" || hit.Evidence.Matcher != "oob-http" || len(hit.Evidence.OOB) != 1 {
+		t.Fatalf("expected an OOB finding at u, got %+v", hit)
+	}
+	if miss != nil || res.Stats.Attempts != 2 || res.Stats.Findings != 1 {
+		t.Fatalf("expected no interaction for v, got %+v / %+v", miss, res.Stats)
+	}
+
+	res, err = RunActiveScan(ActiveOptions{URL: target.URL, PayloadsPath: dir, PayloadApproval: unsigned, SkipWAFDetection: true})
+	if err != nil || len(res.Findings) != 0 || len(res.Warnings) != 1 {
+		t.Fatalf("OOB payloads must be skipped without a server, got %v / %+v", err, res)
+	}
+}
+
+func TestRunActiveScanOOBMacro(t *testing.T) {
+	server := oob.NewServer(oob.Config{DNSPort: -1})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	client, err := oob.NewClient(context.Background(), server.Info().HTTPURL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// O webhook só busca a URL com um token emitido pela etapa anterior.
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.URL.Path {
+		case "/token":
+			fmt.Fprint(w, `{"token":"t1"}`)
+		case "/hook":
+			if u := r.PostForm.Get("u"); r.PostForm.Get("token") == "t1" && strings.HasPrefix(u, "http") {
+				if resp, err := http.Get(u); err == nil {
+					resp.Body.Close()
+				}
+			}
+			w.Write([]byte("queued"))
+		}
+	}))
+	defer target.Close()
+
+	dir := writePayloads(t, `[{"name":"hook-ssrf","category":"ssrf","template":"{{OOB_URL}}",
+  "steps":[
+    {"name":"token","request":{"method":"GET","path":"/token"},"extractors":[{"name":"tok","type":"json","json":["token"]}]},
+    {"name":"hook","inject":true,"request":{"method":"POST","path":"/hook","headers":{"Content-Type":"application/x-www-form-urlencoded"},"body":"token={{tok}}&u=x"}}
+  ]}]`)
+	res, err := RunActiveScan(ActiveOptions{
+		URL:              target.URL + "/",
+		PayloadsPath:     dir,
+		PayloadApproval:  unsigned,
+		Rate:             1000,
+		SkipWAFDetection: true,
+		OOB:              client,
+		OOBWaitSec:       1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hit := findingAt(res, "form:u")
+	if hit == nil || hit.Evidence.Matcher != "oob-http" || len(hit.Evidence.OOB) != 1 {
+		t.Fatalf("expected the sequence's OOB interaction to be correlated, got %+v", res.Findings)
+	}
+}
@@ -0,0 +1,196 @@
+package active
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SafetyClasses são as classes de segurança de um template, da mais branda à
+// mais arriscada: passive só observa, safe envia marcadores inertes, intrusive
+// pode alterar o comportamento do alvo e destructive pode alterar ou apagar dados.
+var SafetyClasses = []string{"passive", "safe", "intrusive", "destructive"}
+
+// defaultSafety é a classe de um template que não declara a sua.
+const defaultSafety = "intrusive"
+
+func safetyRank(class string) int {
+	for i, c := range SafetyClasses {
+		if c == class {
+			return i
+		}
+	}
+	return -1
+}
+
+// Intensity controla quantas variantes de codificação e quais pontos de
+// injeção são testados.
+type Intensity struct {
+	// Encodings é o número máximo de variantes de codificação por template
+	// (-1 = todas as declaradas).
+	Encodings int
+	// Kinds são os tipos de ponto de injeção testados (nil = todos).
+	Kinds []InjectionKind
+}
+
+// Intensities são os níveis aceitos em ScanPolicy.Intensity. low testa só
+// parâmetros com o payload original; medium acrescenta cookies, segmentos do
+// caminho e duas codificações; high testa tudo, inclusive cabeçalhos.
+var Intensities = map[string]Intensity{
+	"low":    {Encodings: 0, Kinds: []InjectionKind{InjectQuery, InjectForm, InjectMultipart, InjectJSON, InjectXML}},
+	"medium": {Encodings: 2, Kinds: []InjectionKind{InjectQuery, InjectForm, InjectMultipart, InjectJSON, InjectXML, InjectCookie, InjectPath}},
+	"high":   {Encodings: -1},
+}
+
+// ScanPolicy escolhe o que uma varredura ativa pode enviar.
+type ScanPolicy struct {
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	// Categories limita os templates às categorias listadas (vazio = todas).
+	Categories []string `json:"categories,omitempty" yaml:"categories,omitempty"`
+
+	// Intensity é low, medium ou high (padrão: high).
+	Intensity string `json:"intensity,omitempty" yaml:"intensity,omitempty"`
+
+	// MaxSafety é a classe mais arriscada permitida no engajamento; templates
+	// acima dela são recusados (vazio = destructive).
+	MaxSafety string `json:"max_safety,omitempty" yaml:"max_safety,omitempty"`
+
+	// Safety atribui ou eleva a classe de templates pelo nome.
+	Safety map[string]string `json:"safety,omitempty" yaml:"safety,omitempty"`
+}
+
+// LoadScanPolicy lê uma política de varredura YAML ou JSON.
+func LoadScanPolicy(path string) (*ScanPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p ScanPolicy
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("invalid scan policy %s: %w", filepath.Base(path), err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid scan policy %s: %w", filepath.Base(path), err)
+	}
+	return &p, nil
+}
+
+// Validate confere categorias, intensidade e classes de segurança.
+func (p *ScanPolicy) Validate() error {
+	for _, c := range p.Categories {
+		if !isKnownCategory(c) {
+			return fmt.Errorf("unknown category %q (known: %s)", c, strings.Join(KnownCategories, ", "))
+		}
+	}
+	if _, ok := Intensities[p.Intensity]; p.Intensity != "" && !ok {
+		return fmt.Errorf("unknown intensity %q (known: low, medium, high)", p.Intensity)
+	}
+	if p.MaxSafety != "" && safetyRank(p.MaxSafety) < 0 {
+		return fmt.Errorf("unknown safety class %q (known: %s)", p.MaxSafety, strings.Join(SafetyClasses, ", "))
+	}
+	names := make([]string, 0, len(p.Safety))
+	for name := range p.Safety {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if safetyRank(p.Safety[name]) < 0 {
+			return fmt.Errorf("template %s: unknown safety class %q (known: %s)", name, p.Safety[name], strings.Join(SafetyClasses, ", "))
+		}
+	}
+	return nil
+}
+
+// Restrict devolve uma cópia da política cuja classe máxima é a mais branda
+// entre a da política e max (o limite do operador nunca é relaxado pelo arquivo).
+func (p *ScanPolicy) Restrict(max string) (*ScanPolicy, error) {
+	out := ScanPolicy{}
+	if p != nil {
+		out = *p
+	}
+	if max == "" {
+		return &out, nil
+	}
+	if safetyRank(max) < 0 {
+		return nil, fmt.Errorf("unknown safety class %q (known: %s)", max, strings.Join(SafetyClasses, ", "))
+	}
+	if out.MaxSafety == "" || safetyRank(max) < safetyRank(out.MaxSafety) {
+		out.MaxSafety = max
+	}
+	return &out, nil
+}
+
+// safetyOf devolve a classe efetiva de um template: a mais arriscada entre a
+// declarada no template e a atribuída pela política.
+func (p *ScanPolicy) safetyOf(t PayloadTemplate) string {
+	class := t.Safety
+	if class == "" {
+		class = defaultSafety
+	}
+	if c, ok := p.Safety[t.Name]; ok && (t.Safety == "" || safetyRank(c) > safetyRank(class)) {
+		class = c
+	}
+	return class
+}
+
+// filter aplica categorias, classe máxima e limite de codificações aos
+// templates, devolvendo um aviso para cada template recusado.
+func (p *ScanPolicy) filter(payloads []PayloadTemplate) ([]PayloadTemplate, []string) {
+	if p == nil {
+		return payloads, nil
+	}
+	categories := map[string]bool{}
+	for _, c := range p.Categories {
+		categories[c] = true
+	}
+	level := p.intensity()
+
+	var out []PayloadTemplate
+	var warnings []string
+	for _, t := range payloads {
+		if len(categories) > 0 && !categories[t.Category] {
+			continue
+		}
+		if class := p.safetyOf(t); p.MaxSafety != "" && safetyRank(class) > safetyRank(p.MaxSafety) {
+			warnings = append(warnings, fmt.Sprintf("refused payload %s: safety class %s exceeds the allowed maximum %s", t.Name, class, p.MaxSafety))
+			continue
+		}
+		if level.Encodings >= 0 && len(t.Encodings) > level.Encodings {
+			t.Encodings = t.Encodings[:level.Encodings]
+		}
+		out = append(out, t)
+	}
+	return out, warnings
+}
+
+func (p *ScanPolicy) intensity() Intensity {
+	if p == nil || p.Intensity == "" {
+		return Intensities["high"]
+	}
+	return Intensities[p.Intensity]
+}
+
+// skips informa se o ponto (ex.: "header:User-Agent [url]") está fora da
+// profundidade da intensidade. Injeções em {{INJECT}} do template e posições
+// §marcadas§ pelo operador são sempre testadas.
+func (p *ScanPolicy) skips(point string) bool {
+	kinds := p.intensity().Kinds
+	kind, _, ok := strings.Cut(point, ":")
+	if kinds == nil || !ok || InjectionKind(kind) == InjectMarker {
+		return false
+	}
+	for _, k := range kinds {
+		if InjectionKind(kind) == k {
+			return false
+		}
+	}
+	return true
+}
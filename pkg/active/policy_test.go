@@ -0,0 +1,105 @@
+package active
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScanPolicyFiltersTemplates(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "<p>%s</p>", r.URL.Query().Get("q"))
+	}))
+	defer srv.Close()
+
+	dir := writePayloads(t, `[
+  {"name":"m","category":"marker","template":"<b>{{INJECT}}</b>","safety":"safe","encodings":["url","html_entity","unicode"]},
+  {"name":"undeclared","category":"xss","template":"<i>{{INJECT}}</i>"},
+  {"name":"drop","category":"sqli","template":"'; DROP TABLE t-- {{INJECT}}","safety":"destructive"},
+  {"name":"promoted","category":"marker","template":"<u>{{INJECT}}</u>","safety":"safe"}
+]`)
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	policy := "name: baseline\ncategories: [marker, xss]\nintensity: low\nmax_safety: intrusive\nsafety:\n  promoted: destructive\n"
+	if err := os.WriteFile(path, []byte(policy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadScanPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, err = p.Restrict("safe"); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := RunActiveScan(ActiveOptions{URL: srv.URL + "/?q=1", PayloadsPath: dir, PayloadApproval: unsigned, Rate: 1000, SkipWAFDetection: true, Policy: p})
+	if err != nil {
+		t.Fatal(err)
+	}
+	warnings := strings.Join(res.Warnings, "\n")
+	for _, want := range []string{
+		"refused payload undeclared: safety class intrusive exceeds the allowed maximum safe",
+		"refused payload promoted: safety class destructive exceeds the allowed maximum safe",
+	} {
+		if !strings.Contains(warnings, want) {
+			t.Errorf("missing warning %q in %q", want, warnings)
+		}
+	}
+	if strings.Contains(warnings, "drop") {
+		t.Errorf("templates outside the selected categories are dropped silently, got %q", warnings)
+	}
+	// Intensidade low: só o parâmetro q, sem variantes de codificação.
+	if len(res.Stats.ByPayload) != 1 || res.Stats.Attempts != 1 || len(res.Findings) != 1 {
+		t.Fatalf("expected a single raw attempt of m, got %+v", res.Stats)
+	}
+
+	if _, err := RunActiveScan(ActiveOptions{URL: srv.URL, PayloadsPath: dir, PayloadApproval: unsigned, SkipWAFDetection: true, Policy: &ScanPolicy{MaxSafety: "passive"}}); err == nil || !strings.Contains(err.Error(), "no payload templates allowed") {
+		t.Fatalf("expected every template to be refused, got %v", err)
+	}
+}
+
+func TestScanPolicyValidation(t *testing.T) {
+	for _, p := range []ScanPolicy{
+		{Categories: []string{"rce"}},
+		{Intensity: "extreme"},
+		{MaxSafety: "harmless"},
+		{Safety: map[string]string{"x": "risky"}},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("expected %+v to be rejected", p)
+		}
+	}
+	// O limite do operador nunca é relaxado pela política.
+	p, err := (&ScanPolicy{MaxSafety: "safe"}).Restrict("destructive")
+	if err != nil || p.MaxSafety != "safe" {
+		t.Fatalf("unexpected restriction %+v (%v)", p, err)
+	}
+	if _, err := (*ScanPolicy)(nil).Restrict("unknown"); err == nil {
+		t.Fatal("expected an unknown class error")
+	}
+}
+
+func TestScanPolicyKeepsMarkers(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "<p>%s</p>", r.Header.Get("X-Name"))
+	}))
+	defer srv.Close()
+
+	dir := writePayloads(t, `[{"name":"m","category":"marker","template":"<b>{{INJECT}}</b>","safety":"safe"}]`)
+	raw := "GET /?q=1 HTTP/1.1\r\nHost: " + strings.TrimPrefix(srv.URL, "http://") + "\r\nX-Name: §bob§\r\n\r\n"
+	req, err := ParseRawRequest([]byte(raw), "http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Cabeçalhos estão fora de low, mas a posição foi marcada pelo operador.
+	res, err := RunActiveScan(ActiveOptions{Requests: []HTTPRequest{req}, PayloadsPath: dir, PayloadApproval: unsigned, Rate: 1000, SkipWAFDetection: true, Policy: &ScanPolicy{Intensity: "low"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Stats.Attempts != 1 || len(res.Findings) != 1 {
+		t.Fatalf("expected the marked header to be tested under low, got %+v", res.Stats)
+	}
+}
@@ -0,0 +1,287 @@
+package active
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"math/big"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/ghostn3xus/reconsec/pkg/oob"
+)
+
+// placeholderRe casa {{nome}} e {{nome|func|func}}.
+var placeholderRe = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)((?:\s*\|\s*[A-Za-z_][A-Za-z0-9_]*)*)\s*\}\}`)
+
+// templateFuncs são as funções aceitas no pipeline de um placeholder.
+var templateFuncs = map[string]func(string) string{
+	"urlencode":        url.QueryEscape,
+	"double_urlencode": func(s string) string { return url.QueryEscape(url.QueryEscape(s)) },
+	"pathencode":       url.PathEscape,
+	"base64":           func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	"hex":              func(s string) string { return hex.EncodeToString([]byte(s)) },
+	"html":             html.EscapeString,
+	"html_entity":      htmlEntityEncode,
+	"unicode":          unicodeEscape,
+	"json":             jsonStringEscape,
+	"upper":            strings.ToUpper,
+	"lower":            strings.ToLower,
+	"case":             caseMutate,
+}
+
+// Encodings são as variantes que um template pode declarar em "encodings". Cada
+// uma é aplicada ao payload inteiro, depois da renderização.
+var Encodings = map[string]func(string) string{
+	"url":         url.QueryEscape,
+	"double_url":  func(s string) string { return url.QueryEscape(url.QueryEscape(s)) },
+	"html_entity": htmlEntityEncode,
+	"unicode":     unicodeEscape,
+	"json_string": jsonStringEscape,
+	"case":        caseMutate,
+}
+
+// htmlEntityEncode troca cada caractere não alfanumérico por uma entidade numérica.
+func htmlEntityEncode(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if r < 128 && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			sb.WriteRune(r)
+		} else {
+			fmt.Fprintf(&sb, "&#%d;", r)
+		}
+	}
+	return sb.String()
+}
+
+// unicodeEscape troca cada caractere não alfanumérico por \uXXXX.
+func unicodeEscape(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if r < 128 && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			sb.WriteRune(r)
+		} else {
+			fmt.Fprintf(&sb, "\\u%04x", r)
+		}
+	}
+	return sb.String()
+}
+
+// jsonStringEscape escapa a string como conteúdo de uma string JSON (sem aspas).
+func jsonStringEscape(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b[1 : len(b)-1])
+}
+
+// caseMutate alterna maiúsculas e minúsculas (ex.: <ScRiPt>) para filtros que
+// comparam palavras-chave sem ignorar caixa.
+func caseMutate(s string) string {
+	var sb strings.Builder
+	upper := true
+	for _, r := range s {
+		if unicode.IsLetter(r) {
+			if upper {
+				r = unicode.ToUpper(r)
+			} else {
+				r = unicode.ToLower(r)
+			}
+			upper = !upper
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// renderString substitui os placeholders conhecidos aplicando o pipeline de
+// funções. Placeholders desconhecidos ficam intactos.
+func renderString(s string, vars map[string]string) (string, error) {
+	return renderStringQuoted(s, vars, nil)
+}
+
+// renderStringQuoted é renderString aplicando quote, se definido, ao valor de
+// cada placeholder depois do pipeline (ex.: regexp.QuoteMeta em matchers regex).
+func renderStringQuoted(s string, vars map[string]string, quote func(string) string) (string, error) {
+	var firstErr error
+	out := placeholderRe.ReplaceAllStringFunc(s, func(m string) string {
+		sub := placeholderRe.FindStringSubmatch(m)
+		val, ok := vars[sub[1]]
+		if !ok {
+			return m
+		}
+		for _, fn := range splitPipeline(sub[2]) {
+			f, ok := templateFuncs[fn]
+			if !ok {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("unknown template function %q", fn)
+				}
+				return m
+			}
+			val = f(val)
+		}
+		if quote != nil {
+			val = quote(val)
+		}
+		return val
+	})
+	return out, firstErr
+}
+
+func splitPipeline(s string) []string {
+	var fns []string
+	for _, f := range strings.Split(s, "|") {
+		if f = strings.TrimSpace(f); f != "" {
+			fns = append(fns, f)
+		}
+	}
+	return fns
+}
+
+var markerSeq uint64
+
+// newMarker gera um marcador único por requisição.
+func newMarker() string {
+	n := atomic.AddUint64(&markerSeq, 1)
+	return fmt.Sprintf("__RECONSEC_%s_%d__", time.Now().Format("150405"), n)
+}
+
+const randAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	max := big.NewInt(int64(len(randAlphabet)))
+	for i := range b {
+		v, _ := rand.Int(rand.Reader, max)
+		b[i] = randAlphabet[v.Int64()]
+	}
+	return string(b)
+}
+
+func randomInt() string {
+	v, _ := rand.Int(rand.Reader, big.NewInt(900000))
+	return fmt.Sprint(v.Int64() + 100000)
+}
+
+// PayloadVariant é uma forma concreta de um payload pronta para envio.
+type PayloadVariant struct {
+	Encoding string
+	Value    string
+	Vars     map[string]string
+}
+
+// Variáveis extras com o domínio e a URL do servidor OOB; quando presentes,
+// {{OOB}} e {{OOB_URL}} são montados com o identificador da requisição.
+const (
+	oobDomainVar = "OOB_DOMAIN"
+	oobURLVar    = "OOB_SERVER"
+)
+
+// RenderPayload renderiza o template uma vez por variante: {{INJECT}} vira um
+// marcador único da requisição e as variáveis embutidas (marker, randstr,
+// randint, host, OOB_ID) são preenchidas. A variante "raw" vem primeiro, seguida das
+// codificações declaradas em Encodings. extra acrescenta variáveis (ex.: DELAY).
+func (p PayloadTemplate) RenderPayload(host string, extra map[string]string) ([]PayloadVariant, error) {
+	encodings := append([]string{"raw"}, p.Encodings...)
+	variants := make([]PayloadVariant, 0, len(encodings))
+	for _, enc := range encodings {
+		encode := func(s string) string { return s }
+		if enc != "raw" {
+			f, ok := Encodings[enc]
+			if !ok {
+				return nil, fmt.Errorf("unknown encoding %q", enc)
+			}
+			encode = f
+		}
+
+		marker := newMarker()
+		vars := map[string]string{
+			"INJECT":  marker,
+			"marker":  marker,
+			"randstr": randomString(8),
+			"randint": randomInt(),
+			"host":    host,
+			"OOB_ID":  oob.NewID(),
+		}
+		for k, v := range extra {
+			vars[k] = v
+		}
+		if domain := vars[oobDomainVar]; domain != "" {
+			vars["OOB"] = vars["OOB_ID"] + "." + domain
+			vars["OOB_URL"] = vars[oobURLVar] + "/" + vars["OOB_ID"]
+		}
+		payload, err := renderString(p.Template, vars)
+		if err != nil {
+			return nil, err
+		}
+		vars["payload"] = payload
+		vars["encoded"] = encode(payload)
+		variants = append(variants, PayloadVariant{Encoding: enc, Value: vars["encoded"], Vars: vars})
+	}
+	return variants, nil
+}
+
+// templateProblems devolve as funções desconhecidas usadas nos placeholders de s.
+func templateProblems(s string) []string {
+	var probs []string
+	for _, sub := range placeholderRe.FindAllStringSubmatch(s, -1) {
+		for _, fn := range splitPipeline(sub[2]) {
+			if _, ok := templateFuncs[fn]; !ok {
+				probs = append(probs, fmt.Sprintf("unknown template function %q in %s", fn, sub[0]))
+			}
+		}
+	}
+	return probs
+}
+
+// hasInject informa se s contém {{INJECT}}, com ou sem funções.
+func hasInject(s string) bool {
+	for _, sub := range placeholderRe.FindAllStringSubmatch(s, -1) {
+		if sub[1] == "INJECT" {
+			return true
+		}
+	}
+	return false
+}
+
+// usesOOB informa se o template precisa de um servidor de interações.
+func (p PayloadTemplate) usesOOB() bool {
+	fields := []string{p.Template, p.FalseTemplate}
+	defs := make([]*RequestDef, 0, len(p.Steps)+1)
+	if p.Request != nil {
+		defs = append(defs, p.Request)
+	}
+	for i := range p.Steps {
+		defs = append(defs, &p.Steps[i].Request)
+	}
+	for _, d := range defs {
+		fields = append(fields, d.Path, d.Body)
+		for _, v := range d.Headers {
+			fields = append(fields, v)
+		}
+	}
+	for _, f := range fields {
+		for _, sub := range placeholderRe.FindAllStringSubmatch(f, -1) {
+			if sub[1] == "OOB" || sub[1] == "OOB_URL" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mergeVars copia as variáveis de todos os mapas; os últimos têm precedência.
+func mergeVars(maps ...map[string]string) map[string]string {
+	out := map[string]string{}
+	for _, m := range maps {
+		for k, v := range m {
+			out[k] = v
+		}
+	}
+	return out
+}
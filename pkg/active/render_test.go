@@ -0,0 +1,62 @@
+package active
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRenderStringPipeline(t *testing.T) {
+	vars := map[string]string{"INJECT": "<a b>"}
+	got, err := renderString("{{INJECT|urlencode|base64}} {{ INJECT | html }} {{INJECT|case}} {{other}}", vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "JTNDYStiJTNF &lt;a b&gt; <A b> {{other}}" {
+		t.Fatalf("unexpected render %q", got)
+	}
+	if _, err := renderString("{{INJECT|rot13}}", vars); err == nil {
+		t.Fatal("unknown functions must be reported")
+	}
+}
+
+func TestPlanAttemptsEncodingVariants(t *testing.T) {
+	base := HTTPRequest{Method: http.MethodGet, URL: "https://t/?q=1", Header: http.Header{}}
+	p := PayloadTemplate{
+		Template:  `<s>{{INJECT}}{{host}}`,
+		Encodings: []string{"url", "html_entity", "unicode", "json_string"},
+	}
+
+	attempts, err := planAttempts(base, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 5 {
+		t.Fatalf("expected raw plus 4 variants, got %d", len(attempts))
+	}
+
+	seen := map[string]bool{}
+	for _, a := range attempts {
+		m := a.vars["marker"]
+		if seen[m] {
+			t.Fatalf("marker %q reused across requests", m)
+		}
+		seen[m] = true
+		if a.vars["payload"] != "<s>"+m+"t" {
+			t.Fatalf("unexpected payload %q", a.vars["payload"])
+		}
+	}
+	want := map[string]string{
+		"query:q":               "<s>",
+		"query:q [url]":         "%3Cs%3E",
+		"query:q [html_entity]": "&#60;s&#62;",
+		"query:q [unicode]":     `\u003cs\u003e`,
+		"query:q [json_string]": `\u003cs\u003e__RECONSEC_`,
+	}
+	for _, a := range attempts {
+		prefix, ok := want[a.point]
+		if !ok || !strings.HasPrefix(a.vars["encoded"], prefix) {
+			t.Errorf("%s: unexpected encoded value %q", a.point, a.vars["encoded"])
+		}
+	}
+}
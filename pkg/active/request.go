@@ -0,0 +1,145 @@
+package active
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// RequestFromURL cria uma requisição base GET a partir de uma URL.
+func RequestFromURL(raw string) (HTTPRequest, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return HTTPRequest{}, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return HTTPRequest{}, fmt.Errorf("absolute URL required: %s", raw)
+	}
+	return HTTPRequest{Method: http.MethodGet, URL: u.String(), Header: http.Header{}}, nil
+}
+
+// ParseRawRequest lê uma requisição HTTP/1.1 bruta (como exportada por um proxy).
+// O esquema é usado quando a linha de requisição traz apenas o caminho. A ordem
+// e a grafia dos cabeçalhos são guardadas e reproduzidas por Raw e pelo envio
+// com NativeSender.PathAsIs.
+func ParseRawRequest(data []byte, scheme string) (HTTPRequest, error) {
+	if scheme == "" {
+		scheme = "https"
+	}
+
+	head, body := splitRawRequest(data)
+	lines := strings.Split(strings.ReplaceAll(head, "\r\n", "\n"), "\n")
+	parts := strings.Fields(lines[0])
+	if len(parts) < 2 {
+		return HTTPRequest{}, fmt.Errorf("malformed request line: %q", lines[0])
+	}
+
+	req := HTTPRequest{Method: parts[0], Header: http.Header{}, Body: body}
+	for i, line := range lines[1:] {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			return HTTPRequest{}, fmt.Errorf("malformed header on line %d: %q", i+2, line)
+		}
+		req.Header.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+		req.headerOrder = append(req.headerOrder, strings.TrimSpace(k))
+	}
+	if req.headerOrder == nil {
+		req.headerOrder = []string{}
+	}
+
+	target := parts[1]
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		req.URL = target
+	} else {
+		host := req.Header.Get("Host")
+		if host == "" {
+			return HTTPRequest{}, fmt.Errorf("request has no Host header")
+		}
+		req.URL = scheme + "://" + host + target
+	}
+	req.Header.Del("Host")
+	req.Header.Del("Content-Length")
+	return req, nil
+}
+
+// LoadRawRequest lê uma requisição bruta de um arquivo.
+func LoadRawRequest(path, scheme string) (HTTPRequest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return HTTPRequest{}, err
+	}
+	return ParseRawRequest(data, scheme)
+}
+
+func splitRawRequest(data []byte) (string, []byte) {
+	if i := bytes.Index(data, []byte("\r\n\r\n")); i >= 0 {
+		return string(data[:i]), data[i+4:]
+	}
+	if i := bytes.Index(data, []byte("\n\n")); i >= 0 {
+		return string(data[:i]), data[i+2:]
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+type harFile struct {
+	Log struct {
+		Entries []struct {
+			Request struct {
+				Method  string `json:"method"`
+				URL     string `json:"url"`
+				Headers []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"headers"`
+				PostData *struct {
+					MimeType string `json:"mimeType"`
+					Text     string `json:"text"`
+				} `json:"postData"`
+			} `json:"request"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// LoadHAR lê as requisições de todas as entradas de um arquivo HAR.
+func LoadHAR(path string) ([]HTTPRequest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var har harFile
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, fmt.Errorf("invalid HAR file %s: %w", path, err)
+	}
+
+	var reqs []HTTPRequest
+	for _, e := range har.Log.Entries {
+		r := HTTPRequest{Method: e.Request.Method, URL: e.Request.URL, Header: http.Header{}}
+		for _, h := range e.Request.Headers {
+			// Pseudo-cabeçalhos do HTTP/2 (":authority" etc.) e os recalculados no envio ficam de fora.
+			if strings.HasPrefix(h.Name, ":") || strings.EqualFold(h.Name, "Host") || strings.EqualFold(h.Name, "Content-Length") {
+				continue
+			}
+			r.Header.Add(h.Name, h.Value)
+		}
+		if pd := e.Request.PostData; pd != nil {
+			r.Body = []byte(pd.Text)
+			if r.Header.Get("Content-Type") == "" && pd.MimeType != "" {
+				r.Header.Set("Content-Type", pd.MimeType)
+			}
+		}
+		reqs = append(reqs, r)
+	}
+
+	if len(reqs) == 0 {
+		return nil, fmt.Errorf("no entries found in HAR file %s", path)
+	}
+	return reqs, nil
+}
@@ -0,0 +1,304 @@
+package active
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghostn3xus/reconsec/pkg/utils"
+)
+
+// NetworkPolicy controla o acesso de rede do processo isolado.
+type NetworkPolicy string
+
+const (
+	// NetworkNone isola completamente a rede (o alvo fica inacessível; útil para ensaios).
+	NetworkNone NetworkPolicy = "none"
+	// NetworkBridge usa a rede NAT do runtime de containers.
+	NetworkBridge NetworkPolicy = "bridge"
+	// NetworkHost compartilha a rede do operador.
+	NetworkHost NetworkPolicy = "host"
+)
+
+// SandboxConfig define os limites aplicados a cada execução isolada.
+type SandboxConfig struct {
+	// Network é a política de rede (padrão: bridge em containers, host nos demais).
+	Network NetworkPolicy
+
+	// CPUs é o limite de núcleos (containers e nsjail). 0 = sem limite.
+	CPUs float64
+
+	// MemoryMB é o limite de memória. 0 = sem limite.
+	MemoryMB int
+
+	// Timeout é o tempo máximo de cada execução (padrão 30s).
+	Timeout time.Duration
+
+	// MaxOutput é o máximo capturado de stdout e de stderr (padrão 1 MiB).
+	MaxOutput int64
+
+	// Image é a imagem usada pelos backends de container.
+	Image string
+}
+
+// SandboxResult é a saída capturada de uma execução isolada.
+type SandboxResult struct {
+	Stdout    []byte
+	Stderr    []byte
+	ExitCode  int
+	Duration  time.Duration
+	Truncated bool
+}
+
+// Sandbox executa um comando isolado do host do operador.
+type Sandbox interface {
+	Name() string
+	Run(ctx context.Context, argv []string, stdin []byte) (*SandboxResult, error)
+}
+
+// SandboxBackends são os nomes aceitos por NewSandbox.
+var SandboxBackends = []string{"docker", "podman", "unshare", "nsjail", "local"}
+
+const (
+	defaultSandboxImage   = "curlimages/curl:8.2.1"
+	defaultSandboxTimeout = 30 * time.Second
+	defaultMaxOutput      = 1 << 20
+)
+
+// NewSandbox cria o backend pelo nome, com os padrões de cfg aplicados.
+func NewSandbox(backend string, cfg SandboxConfig) (Sandbox, error) {
+	if cfg.Network == "" {
+		// Containers usam a rede NAT; os demais backends, a rede do host.
+		cfg.Network = NetworkHost
+		if backend == "docker" || backend == "podman" {
+			cfg.Network = NetworkBridge
+		}
+	}
+	switch cfg.Network {
+	case NetworkNone, NetworkBridge, NetworkHost:
+	default:
+		return nil, fmt.Errorf("unknown sandbox network policy %q (none, bridge or host)", cfg.Network)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultSandboxTimeout
+	}
+	if cfg.MaxOutput <= 0 {
+		cfg.MaxOutput = defaultMaxOutput
+	}
+	if cfg.Image == "" {
+		cfg.Image = defaultSandboxImage
+	}
+
+	switch backend {
+	case "docker", "podman":
+		return &ContainerSandbox{Runtime: backend, Config: cfg}, nil
+	case "unshare", "nsjail":
+		if cfg.Network == NetworkBridge {
+			// Sem runtime de containers não há rede NAT: só sem rede ou com a do host.
+			return nil, fmt.Errorf("the %s backend supports the none and host network policies only", backend)
+		}
+		return &NamespaceSandbox{Tool: backend, Config: cfg}, nil
+	case "local":
+		return &LocalSandbox{Config: cfg}, nil
+	}
+	return nil, fmt.Errorf("unknown sandbox backend %q (known: %s)", backend, strings.Join(SandboxBackends, ", "))
+}
+
+// ContainerSandbox executa o comando em um container descartável (docker ou podman)
+// sem capabilities, com sistema de arquivos somente leitura e limites de recursos.
+type ContainerSandbox struct {
+	Runtime string
+	Config  SandboxConfig
+}
+
+func (s *ContainerSandbox) Name() string { return s.Runtime }
+
+func (s *ContainerSandbox) command(argv []string) []string {
+	cmd := []string{s.Runtime, "run", "--rm", "-i",
+		"--network", string(s.Config.Network),
+		"--read-only", "--cap-drop", "ALL", "--security-opt", "no-new-privileges",
+		"--pids-limit", "64"}
+	if s.Config.CPUs > 0 {
+		cmd = append(cmd, "--cpus", strconv.FormatFloat(s.Config.CPUs, 'f', -1, 64))
+	}
+	if s.Config.MemoryMB > 0 {
+		cmd = append(cmd, "--memory", strconv.Itoa(s.Config.MemoryMB)+"m")
+	}
+	cmd = append(cmd, s.Config.Image)
+	// A imagem do curl já tem o curl como entrypoint.
+	if len(argv) > 0 && argv[0] == "curl" && s.Config.Image == defaultSandboxImage {
+		argv = argv[1:]
+	}
+	return append(cmd, argv...)
+}
+
+func (s *ContainerSandbox) Run(ctx context.Context, argv []string, stdin []byte) (*SandboxResult, error) {
+	return runCaptured(ctx, s.command(argv), stdin, s.Config)
+}
+
+// NamespaceSandbox isola o processo em namespaces do Linux, com unshare (e
+// prlimit para memória e tempo de CPU) ou com nsjail.
+type NamespaceSandbox struct {
+	Tool   string
+	Config SandboxConfig
+}
+
+func (s *NamespaceSandbox) Name() string { return s.Tool }
+
+// nsjailMounts são os diretórios do host montados (só leitura) no nsjail: o
+// processo precisa das bibliotecas, do carregador dinâmico (/lib64 no x86_64)
+// e da resolução de nomes do host. Os que não existem são ignorados.
+var nsjailMounts = []string{"/usr", "/lib", "/lib64", "/etc", "/bin"}
+
+func (s *NamespaceSandbox) command(argv []string) ([]string, error) {
+	if len(argv) == 0 {
+		return nil, errors.New("sandbox: empty command")
+	}
+	path, err := exec.LookPath(argv[0])
+	if err != nil {
+		return nil, fmt.Errorf("sandbox: %w", err)
+	}
+	argv = append([]string{path}, argv[1:]...)
+	cpuSeconds := strconv.Itoa(int(s.Config.Timeout.Seconds()) + 1)
+
+	if s.Tool == "nsjail" {
+		cmd := []string{"nsjail", "-Mo", "--quiet", "--time_limit", cpuSeconds, "--rlimit_cpu", cpuSeconds}
+		if s.Config.MemoryMB > 0 {
+			cmd = append(cmd, "--rlimit_as", strconv.Itoa(s.Config.MemoryMB))
+		}
+		if s.Config.CPUs > 0 {
+			cmd = append(cmd, "--cgroup_cpu_ms_per_sec", strconv.Itoa(int(s.Config.CPUs*1000)))
+		}
+		if s.Config.Network == NetworkHost {
+			cmd = append(cmd, "--disable_clone_newnet")
+		}
+		for _, dir := range nsjailMounts {
+			if _, err := os.Stat(dir); err == nil {
+				cmd = append(cmd, "-R", dir)
+			}
+		}
+		return append(append(cmd, "--"), argv...), nil
+	}
+
+	cmd := []string{"unshare", "--user", "--map-root-user", "--pid", "--fork", "--mount-proc", "--ipc", "--uts"}
+	if s.Config.Network == NetworkNone {
+		cmd = append(cmd, "--net")
+	}
+	cmd = append(cmd, "--", "prlimit", "--cpu="+cpuSeconds)
+	if s.Config.MemoryMB > 0 {
+		cmd = append(cmd, "--as="+strconv.Itoa(s.Config.MemoryMB*1024*1024))
+	}
+	return append(append(cmd, "--"), argv...), nil
+}
+
+func (s *NamespaceSandbox) Run(ctx context.Context, argv []string, stdin []byte) (*SandboxResult, error) {
+	cmd, err := s.command(argv)
+	if err != nil {
+		return nil, err
+	}
+	return runCaptured(ctx, cmd, stdin, s.Config)
+}
+
+// LocalSandbox executa o comando diretamente, sem isolamento; só aplica o
+// tempo máximo e a captura de saída. Serve para testes e ambientes sem suporte.
+type LocalSandbox struct {
+	Config SandboxConfig
+}
+
+func (s *LocalSandbox) Name() string { return "local" }
+
+func (s *LocalSandbox) Run(ctx context.Context, argv []string, stdin []byte) (*SandboxResult, error) {
+	if len(argv) == 0 {
+		return nil, errors.New("sandbox: empty command")
+	}
+	return runCaptured(ctx, argv, stdin, s.Config)
+}
+
+// cappedBuffer guarda no máximo limit bytes e marca se algo foi descartado.
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	limit     int64
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - int64(b.buf.Len()); room < int64(len(p)) {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// runCaptured executa argv com o tempo máximo da configuração, capturando stdout e stderr.
+func runCaptured(ctx context.Context, argv []string, stdin []byte, cfg SandboxConfig) (*SandboxResult, error) {
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+	}
+	limit := cfg.MaxOutput
+	if limit <= 0 {
+		limit = defaultMaxOutput
+	}
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	stdout, stderr := &cappedBuffer{limit: limit}, &cappedBuffer{limit: limit}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+
+	start := time.Now()
+	err := cmd.Run()
+	res := &SandboxResult{
+		Stdout:    stdout.buf.Bytes(),
+		Stderr:    stderr.buf.Bytes(),
+		Duration:  time.Since(start),
+		Truncated: stdout.truncated || stderr.truncated,
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return res, fmt.Errorf("sandbox: time limit of %s exceeded: %w", cfg.Timeout, context.DeadlineExceeded)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		res.ExitCode = exitErr.ExitCode()
+		return res, nil
+	}
+	if err != nil {
+		return res, fmt.Errorf("sandbox: %w", err)
+	}
+	return res, nil
+}
+
+// SandboxSender envia as requisições com curl dentro de um Sandbox, isolando o
+// cliente do host do operador. Com Session, os cabeçalhos da sessão são
+// copiados para a requisição (a renovação só acontece quando eles expiram).
+type SandboxSender struct {
+	Sandbox Sandbox
+	MaxBody int64
+	Session *utils.Session
+}
+
+func (s *SandboxSender) Send(ctx context.Context, r HTTPRequest) (*Exchange, error) {
+	if s.Session != nil {
+		var err error
+		if r, err = withSessionHeaders(ctx, s.Session, r); err != nil {
+			return nil, err
+		}
+	}
+	res, err := s.Sandbox.Run(ctx, append([]string{"curl"}, curlArgs(r)...), r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.ExitCode != 0 {
+		return nil, fmt.Errorf("sandbox %s: curl exited with %d: %s", s.Sandbox.Name(), res.ExitCode, strings.TrimSpace(string(res.Stderr)))
+	}
+	return parseCurlOutput(r, res.Stdout, res.Duration, maxBody(s.MaxBody))
+}
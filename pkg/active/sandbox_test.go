@@ -0,0 +1,151 @@
+package active
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewSandboxDefaultsAndErrors(t *testing.T) {
+	sb, err := NewSandbox("docker", SandboxConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := sb.(*ContainerSandbox)
+	if c.Config.Network != NetworkBridge || c.Config.Timeout != defaultSandboxTimeout || c.Config.Image != defaultSandboxImage {
+		t.Fatalf("unexpected defaults %+v", c.Config)
+	}
+	if sb, _ := NewSandbox("unshare", SandboxConfig{}); sb.(*NamespaceSandbox).Config.Network != NetworkHost {
+		t.Fatal("namespace backends should default to the host network")
+	}
+
+	for _, tc := range []struct{ backend, network string }{
+		{"chroot", ""},
+		{"docker", "vpn"},
+		{"nsjail", "bridge"},
+	} {
+		if _, err := NewSandbox(tc.backend, SandboxConfig{Network: NetworkPolicy(tc.network)}); err == nil {
+			t.Errorf("expected an error for %s/%s", tc.backend, tc.network)
+		}
+	}
+}
+
+func TestContainerSandboxCommand(t *testing.T) {
+	sb, _ := NewSandbox("podman", SandboxConfig{Network: NetworkNone, CPUs: 0.5, MemoryMB: 128})
+	got := strings.Join(sb.(*ContainerSandbox).command([]string{"curl", "-sS", "http://x/"}), " ")
+	want := "podman run --rm -i --network none --read-only --cap-drop ALL --security-opt no-new-privileges --pids-limit 64 --cpus 0.5 --memory 128m curlimages/curl:8.2.1 -sS http://x/"
+	if got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestNamespaceSandboxCommand(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+	cfg := SandboxConfig{Network: NetworkNone, MemoryMB: 64, Timeout: 4 * time.Second}
+
+	ns := &NamespaceSandbox{Tool: "unshare", Config: cfg}
+	cmd, err := ns.command([]string{"sh", "-c", "true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "unshare --user --map-root-user --pid --fork --mount-proc --ipc --uts --net -- prlimit --cpu=5 --as=67108864 -- " + sh + " -c true"
+	if got := strings.Join(cmd, " "); got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+
+	ns = &NamespaceSandbox{Tool: "nsjail", Config: SandboxConfig{Network: NetworkHost, CPUs: 1, Timeout: 4 * time.Second}}
+	cmd, _ = ns.command([]string{"sh"})
+	got := strings.Join(cmd, " ")
+	for _, part := range []string{"nsjail -Mo --quiet --time_limit 5", "--cgroup_cpu_ms_per_sec 1000", "--disable_clone_newnet", "-R /usr", "-- " + sh} {
+		if !strings.Contains(got, part) {
+			t.Errorf("nsjail command %q lacks %q", got, part)
+		}
+	}
+	if _, err := os.Stat("/lib64"); err == nil && !strings.Contains(got, "-R /lib64") {
+		t.Errorf("nsjail command %q must mount the dynamic loader in /lib64", got)
+	}
+}
+
+func TestNamespaceSandboxNsjailRunsCurl(t *testing.T) {
+	if _, err := exec.LookPath("nsjail"); err != nil {
+		t.Skip("nsjail not available")
+	}
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not available")
+	}
+	if err := exec.Command("nsjail", "-Mo", "--quiet", "-R", "/", "--", "/bin/sh", "-c", "true").Run(); err != nil {
+		t.Skip("nsjail cannot create namespaces here")
+	}
+
+	sb, err := NewSandbox("nsjail", SandboxConfig{Network: NetworkNone, Timeout: 10 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := sb.Run(context.Background(), []string{"curl", "--version"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ExitCode != 0 || !strings.HasPrefix(string(res.Stdout), "curl ") {
+		t.Fatalf("curl did not start inside nsjail: exit %d, stdout %q, stderr %q", res.ExitCode, res.Stdout, res.Stderr)
+	}
+}
+
+func TestLocalSandboxLimits(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	sb, _ := NewSandbox("local", SandboxConfig{MaxOutput: 8, Timeout: 200 * time.Millisecond})
+
+	res, err := sb.Run(context.Background(), []string{"sh", "-c", "cat; echo 0123456789; exit 3"}, []byte("in:"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Stdout) != "in:01234" || !res.Truncated || res.ExitCode != 3 {
+		t.Fatalf("unexpected result %+v (stdout %q)", res, res.Stdout)
+	}
+
+	if _, err := sb.Run(context.Background(), []string{"sleep", "5"}, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the time limit to be enforced, got %v", err)
+	}
+}
+
+func TestSandboxSenderLocal(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not available")
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "q=%s", r.URL.Query().Get("q"))
+	}))
+	defer srv.Close()
+
+	sb, _ := NewSandbox("local", SandboxConfig{})
+	s := &SandboxSender{Sandbox: sb}
+	ex, err := s.Send(context.Background(), HTTPRequest{Method: "GET", URL: srv.URL + "/?q=ok"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ex.Status != 200 || string(ex.Body) != "q=ok" {
+		t.Fatalf("unexpected exchange %d %q", ex.Status, ex.Body)
+	}
+
+	// Com a rede isolada, o alvo não é alcançável.
+	if _, err := exec.LookPath("unshare"); err == nil {
+		sb, _ = NewSandbox("unshare", SandboxConfig{Network: NetworkNone, Timeout: 5 * time.Second})
+		if err := exec.Command("unshare", "--user", "--map-root-user", "true").Run(); err != nil {
+			t.Skip("user namespaces not available")
+		}
+		if _, err := (&SandboxSender{Sandbox: sb}).Send(context.Background(), HTTPRequest{Method: "GET", URL: srv.URL}); err == nil {
+			t.Fatal("expected the isolated network to block the request")
+		}
+	}
+}
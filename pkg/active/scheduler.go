@@ -0,0 +1,425 @@
+package active
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ghostn3xus/reconsec/pkg/report"
+	"github.com/ghostn3xus/reconsec/pkg/utils"
+)
+
+// Progress é enviado ao callback ActiveOptions.Progress após cada tentativa.
+type Progress struct {
+	Done     int     `json:"done"`
+	Total    int     `json:"total"`
+	URL      string  `json:"url"`
+	Payload  string  `json:"payload"`
+	Point    string  `json:"point"`
+	Status   int     `json:"status,omitempty"`
+	Matched  bool    `json:"matched"`
+	Findings int     `json:"findings"`
+	Backoff  bool    `json:"backoff,omitempty"`
+	HostRate float64 `json:"host_rate"`
+}
+
+const (
+	minHostRate     = 0.2
+	recoverAfter    = 10
+	latencySpike    = 3
+	latencyFloor    = 500 * time.Millisecond
+	latencySamples  = 5
+	recoverIncrease = 1.5
+)
+
+// hostState acompanha a saúde de um host para o backoff adaptativo: respostas
+// 429/503 ou picos de latência reduzem a taxa pela metade, e uma sequência de
+// respostas normais a devolve aos poucos até a taxa configurada.
+type hostState struct {
+	mu       sync.Mutex
+	limiter  *utils.Limiter
+	base     float64
+	avg      time.Duration
+	samples  int
+	streak   int
+	backoffs int
+	reason   string
+}
+
+// observe registra uma resposta e informa se ela causou backoff. Com timed, a
+// latência é a esperada do payload: não conta como pico nem entra na média.
+func (h *hostState) observe(status int, d time.Duration, timed bool) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	rate := h.limiter.Rate()
+	reason := ""
+	switch {
+	case status == 429 || status == 503:
+		reason = fmt.Sprintf("HTTP %d", status)
+	case !timed && h.samples >= latencySamples && d > latencyFloor && d > latencySpike*h.avg:
+		reason = fmt.Sprintf("latency spike (%s vs %s average)", d.Round(time.Millisecond), h.avg.Round(time.Millisecond))
+	}
+
+	if reason != "" {
+		h.streak = 0
+		h.backoffs++
+		h.reason = reason
+		if rate/2 >= minHostRate {
+			h.limiter.SetRate(rate / 2)
+		} else {
+			h.limiter.SetRate(minHostRate)
+		}
+		return true
+	}
+
+	if !timed {
+		if h.samples == 0 {
+			h.avg = d
+		} else {
+			h.avg = (h.avg*4 + d) / 5
+		}
+		h.samples++
+	}
+	h.streak++
+	if h.streak >= recoverAfter && rate < h.base {
+		h.streak = 0
+		if rate*recoverIncrease < h.base {
+			h.limiter.SetRate(rate * recoverIncrease)
+		} else {
+			h.limiter.SetRate(h.base)
+		}
+	}
+	return false
+}
+
+// limit reduz a taxa do host e o teto da recuperação para rate, de modo que
+// uma redução de segurança (ex.: WAF bloqueando) não seja desfeita depois.
+func (h *hostState) limit(rate float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.base = rate
+	if h.limiter.Rate() > rate {
+		h.limiter.SetRate(rate)
+	}
+}
+
+// scheduler distribui as tentativas entre os workers respeitando os limites por
+// host, o limite global e o orçamento de requisições.
+type scheduler struct {
+	opts    ActiveOptions
+	sender  Sender
+	limiter *utils.HostLimiter
+	timeout time.Duration
+
+	baselines *baselineCache
+
+	mu       sync.Mutex
+	hosts    map[string]*hostState
+	done     int
+	reserved int
+	skipped  int
+	matched  int
+	stats    ScanStats
+	errSeen  map[string]bool
+	sent     map[int]bool
+}
+
+func newScheduler(opts ActiveOptions, sender Sender) *scheduler {
+	return &scheduler{
+		opts:    opts,
+		sender:  sender,
+		limiter: utils.NewHostLimiter(float64(opts.Rate), float64(opts.GlobalRate), 1),
+		timeout: time.Duration(opts.TimeoutSec) * time.Second,
+		hosts:   map[string]*hostState{},
+
+		baselines: &baselineCache{},
+		errSeen:   map[string]bool{},
+		sent:      map[int]bool{},
+	}
+}
+
+func (s *scheduler) host(name string) *hostState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, ok := s.hosts[name]
+	if !ok {
+		h = &hostState{limiter: s.limiter.Host(name), base: float64(s.opts.Rate)}
+		s.hosts[name] = h
+	}
+	return h
+}
+
+// errBudgetExhausted indica que o orçamento de requisições acabou.
+var errBudgetExhausted = errors.New("request budget exhausted")
+
+// sendFunc envia uma requisição passando pelos limites do scanner.
+type sendFunc func(ctx context.Context, req HTTPRequest) (*Exchange, error)
+
+type job struct {
+	slot    int
+	host    string
+	payload PayloadTemplate
+	attempt attempt
+
+	// probe, se definido, substitui o envio único por uma sequência de
+	// requisições (ex.: detecção por tempo).
+	probe func(ctx context.Context, send sendFunc) evaluation
+}
+
+// outcome classifica o resultado de uma tentativa para as estatísticas.
+type outcome int
+
+const (
+	// outcomeMiss é uma tentativa enviada sem efeito observável.
+	outcomeMiss outcome = iota
+	// outcomeFinding é uma tentativa reportada como achado.
+	outcomeFinding
+	// outcomeSuppressed é uma tentativa que casou, mas a linha de base também casa.
+	outcomeSuppressed
+	// outcomeError é uma falha de envio.
+	outcomeError
+	// outcomeSkipped é uma tentativa não enviada (orçamento ou cancelamento).
+	outcomeSkipped
+)
+
+// evaluation é o resultado de um job: o achado, se houver, e a classificação.
+type evaluation struct {
+	finding *report.Finding
+	outcome outcome
+	err     error
+}
+
+// send consome uma unidade do orçamento, espera o limite do host e envia req.
+// Com timed, a latência da resposta é esperada e não dispara o backoff.
+func (s *scheduler) send(ctx context.Context, host string, req HTTPRequest, timed bool) (*Exchange, bool, error) {
+	s.mu.Lock()
+	if s.opts.MaxRequests > 0 && s.reserved >= s.opts.MaxRequests {
+		s.mu.Unlock()
+		return nil, false, errBudgetExhausted
+	}
+	s.reserved++
+	s.mu.Unlock()
+
+	h := s.host(host)
+	var csrf *report.CSRFEvidence
+	if s.opts.CSRF != nil {
+		var err error
+		if req, csrf, err = s.opts.CSRF.refresh(ctx, req, s.fetchToken); err != nil {
+			return nil, false, err
+		}
+	}
+	if err := s.limiter.Wait(ctx, host); err != nil {
+		return nil, false, err
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	ex, err := s.sender.Send(sendCtx, req)
+	if err != nil {
+		return nil, false, err
+	}
+	ex.CSRF = csrf
+	s.mu.Lock()
+	s.stats.Requests++
+	s.mu.Unlock()
+	return ex, h.observe(ex.Status, ex.Duration, timed), nil
+}
+
+// fetchToken busca a página de origem dos tokens anti-CSRF. A busca respeita o
+// limite do host, mas não consome o orçamento de requisições.
+func (s *scheduler) fetchToken(ctx context.Context, req HTTPRequest) (*Exchange, error) {
+	if err := s.limiter.Wait(ctx, requestHost(req.URL)); err != nil {
+		return nil, err
+	}
+	sendCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	ex, err := s.sender.Send(sendCtx, req)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.stats.TokenFetches++
+	s.mu.Unlock()
+	return ex, nil
+}
+
+// run executa os jobs com opts.Concurrency workers e grava cada achado em
+// results[job.slot]. Tentativas não enviadas (orçamento ou cancelamento) ficam nil.
+func (s *scheduler) run(ctx context.Context, jobs []job, results []*report.Finding) {
+	queue := make(chan job)
+	var wg sync.WaitGroup
+	for i := 0; i < s.opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				s.execute(ctx, j, len(jobs), results)
+			}
+		}()
+	}
+
+dispatch:
+	for _, j := range jobs {
+		select {
+		case <-ctx.Done():
+			break dispatch
+		case queue <- j:
+		}
+	}
+	close(queue)
+	wg.Wait()
+}
+
+func (s *scheduler) execute(ctx context.Context, j job, total int, results []*report.Finding) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	var (
+		ev      evaluation
+		backoff bool
+		status  int
+	)
+	if j.probe != nil {
+		ev = j.probe(ctx, func(ctx context.Context, req HTTPRequest) (*Exchange, error) {
+			ex, _, err := s.send(ctx, j.host, req, true)
+			return ex, err
+		})
+	} else {
+		ev, status, backoff = s.attempt(ctx, j)
+	}
+	if ctx.Err() != nil {
+		// Cancelado durante o envio: a tentativa não conta como feita.
+		return
+	}
+
+	h := s.host(j.host)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ev.outcome == outcomeSkipped {
+		s.skipped++
+		return
+	}
+	results[j.slot] = ev.finding
+	s.sent[j.slot] = true
+	s.done++
+	s.record(j, ev)
+	matched := ev.outcome == outcomeFinding
+	if matched {
+		s.matched++
+	}
+	p := Progress{
+		Done:     s.done,
+		Total:    total,
+		URL:      j.attempt.req.URL,
+		Payload:  j.payload.Name,
+		Point:    j.attempt.point,
+		Status:   status,
+		Matched:  matched,
+		Findings: s.matched,
+		Backoff:  backoff,
+		HostRate: h.limiter.Rate(),
+	}
+	if s.opts.Progress != nil {
+		s.opts.Progress(p)
+	}
+}
+
+// wasSent informa se o job da posição slot chegou a ser enviado.
+func (s *scheduler) wasSent(slot int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sent[slot]
+}
+
+// attempt envia a linha de base do ponto de injeção (uma vez por ponto) e depois
+// a tentativa, e avalia a resposta contra a linha de base.
+func (s *scheduler) attempt(ctx context.Context, j job) (evaluation, int, bool) {
+	baseline, err := s.baselines.get(ctx, j.attempt.clean, baselineSamples, func(ctx context.Context, req HTTPRequest) (*Exchange, error) {
+		ex, _, err := s.send(ctx, j.host, req, false)
+		return ex, err
+	})
+	if err != nil {
+		return probeError(err), 0, false
+	}
+	ex, backoff, err := s.send(ctx, j.host, j.attempt.req, false)
+	if err != nil {
+		return probeError(err), 0, backoff
+	}
+	return evaluateAttempt(j.payload, j.attempt, ex, baseline), ex.Status, backoff
+}
+
+// record soma o resultado de um job às estatísticas. Os achados são contados
+// ao fim da varredura, depois da coleta fora de banda. Chamado com s.mu.
+func (s *scheduler) record(j job, ev evaluation) {
+	st := &s.stats
+	if st.ByPayload == nil {
+		st.ByPayload = map[string]*PayloadStats{}
+	}
+	ps := st.ByPayload[j.payload.Name]
+	if ps == nil {
+		ps = &PayloadStats{}
+		st.ByPayload[j.payload.Name] = ps
+	}
+	st.Attempts++
+	ps.Attempts++
+	switch ev.outcome {
+	case outcomeSuppressed:
+		st.Suppressed++
+		ps.Suppressed++
+	case outcomeError:
+		st.Errors++
+		ps.Errors++
+		if msg := ev.err.Error(); !s.errSeen[msg] && len(st.ErrorSamples) < maxErrorSamples {
+			s.errSeen[msg] = true
+			st.ErrorSamples = append(st.ErrorSamples, fmt.Sprintf("%s (%s at %s)", msg, j.payload.Name, j.attempt.point))
+		}
+	}
+}
+
+// probeError classifica a falha de envio de uma tentativa. Orçamento esgotado
+// e cancelamento contam como não enviados.
+func probeError(err error) evaluation {
+	if errors.Is(err, errBudgetExhausted) || errors.Is(err, context.Canceled) {
+		return evaluation{outcome: outcomeSkipped}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = errors.New("payload execution timed out")
+	}
+	return evaluation{outcome: outcomeError, err: err}
+}
+
+// backoffWarnings resume os hosts que forçaram o scanner a desacelerar.
+func (s *scheduler) backoffWarnings() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var names []string
+	for name := range s.hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var out []string
+	for _, name := range names {
+		h := s.hosts[name]
+		h.mu.Lock()
+		if h.backoffs > 0 {
+			out = append(out, fmt.Sprintf("backed off %d time(s) on %s (last: %s); final rate %.2f req/s", h.backoffs, name, h.reason, h.limiter.Rate()))
+		}
+		h.mu.Unlock()
+	}
+	return out
+}
+
+func requestHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Host
+}
@@ -0,0 +1,151 @@
+package active
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const threePayloads = `[
+  {"name":"a","category":"marker","template":"a{{INJECT}}"},
+  {"name":"b","category":"marker","template":"b{{INJECT}}"},
+  {"name":"c","category":"marker","template":"c{{INJECT}}"}
+]`
+
+func TestRunActiveScanBudgetAndTargets(t *testing.T) {
+	var hits int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Write([]byte("ok"))
+	})
+	a, b := httptest.NewServer(handler), httptest.NewServer(handler)
+	defer a.Close()
+	defer b.Close()
+
+	var progress []Progress
+	res, err := RunActiveScan(ActiveOptions{
+		URL:              a.URL,
+		Targets:          []string{b.URL},
+		PayloadsPath:     writePayloads(t, threePayloads),
+		PayloadApproval:  unsigned,
+		Rate:             100,
+		Concurrency:      1,
+		MaxRequests:      4,
+		SkipWAFDetection: true,
+		Progress:         func(p Progress) { progress = append(progress, p) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Dois envios da linha de base e duas tentativas no primeiro alvo; o resto fica de fora.
+	if hits != 4 || len(res.Findings) != 0 || len(progress) != 2 {
+		t.Fatalf("expected 4 requests within budget, got %d hits, %d findings, %d progress", hits, len(res.Findings), len(progress))
+	}
+	if len(res.Targets) != 2 || progress[1].Done != 2 || progress[1].Total != 6 {
+		t.Fatalf("unexpected targets %v / progress %+v", res.Targets, progress[1])
+	}
+	st := res.Stats
+	if st.Requests != 4 || st.Baselines != 2 || st.Attempts != 2 || st.NotSent != 4 || st.ByPayload["a"].Attempts != 1 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+	if !strings.Contains(strings.Join(res.Warnings, "\n"), "budget of 4 exhausted; 4 attempt(s) not sent") {
+		t.Fatalf("missing budget warning in %v", res.Warnings)
+	}
+}
+
+func TestRunActiveScanBacksOffOnThrottling(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	var rates []float64
+	res, err := RunActiveScan(ActiveOptions{
+		URL:              srv.URL,
+		PayloadsPath:     writePayloads(t, threePayloads),
+		PayloadApproval:  unsigned,
+		Rate:             40,
+		SkipWAFDetection: true,
+		Progress:         func(p Progress) { rates = append(rates, p.HostRate) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// As duas respostas da linha de base já reduzem a taxa para 10.
+	if len(rates) != 3 || rates[0] != 5 || rates[2] != 1.25 {
+		t.Fatalf("expected the host rate to halve on every 429, got %v", rates)
+	}
+	if !strings.Contains(strings.Join(res.Warnings, "\n"), "backed off 5 time(s)") {
+		t.Fatalf("missing backoff warning in %v", res.Warnings)
+	}
+}
+
+func TestRunActiveScanCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	start := time.Now()
+	res, err := RunActiveScanContext(ctx, ActiveOptions{
+		URL:              srv.URL,
+		PayloadsPath:     writePayloads(t, threePayloads),
+		PayloadApproval:  unsigned,
+		Rate:             10,
+		SkipWAFDetection: true,
+		Progress:         func(Progress) { cancel() },
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if res.Stats.Attempts != 1 || time.Since(start) > 900*time.Millisecond {
+		t.Fatalf("scan did not stop promptly: %d attempts after %s", res.Stats.Attempts, time.Since(start))
+	}
+}
+
+func TestHostStateLimitCapsRecovery(t *testing.T) {
+	s := newScheduler(ActiveOptions{Rate: 8}, nil)
+	h := s.host("t")
+	// WAF bloqueando: a taxa cai pela metade antes da varredura.
+	h.limit(4)
+	h.observe(http.StatusTooManyRequests, 0, false)
+	if got := h.limiter.Rate(); got != 2 {
+		t.Fatalf("expected the backoff to halve the WAF rate, got %v", got)
+	}
+	for i := 0; i < 10*recoverAfter; i++ {
+		h.observe(http.StatusOK, 10*time.Millisecond, false)
+		if got := h.limiter.Rate(); got > 4 {
+			t.Fatalf("host recovered above the WAF-halved rate: %v", got)
+		}
+	}
+	if got := h.limiter.Rate(); got != 4 {
+		t.Fatalf("expected the host to recover up to the halved rate, got %v", got)
+	}
+}
+
+func TestHostStateIgnoresTimedLatency(t *testing.T) {
+	s := newScheduler(ActiveOptions{Rate: 8}, nil)
+	h := s.host("t")
+	for i := 0; i < latencySamples; i++ {
+		h.observe(http.StatusOK, time.Second, false)
+	}
+	// Respostas de payloads de tempo não puxam a média para baixo...
+	for i := 0; i < 20; i++ {
+		if h.observe(http.StatusOK, 5*time.Second, true) {
+			t.Fatal("a timed response must not trigger a latency backoff")
+		}
+	}
+	if h.avg != time.Second || h.samples != latencySamples {
+		t.Fatalf("timed responses changed the latency average: %s over %d samples", h.avg, h.samples)
+	}
+	// ...então uma resposta comum com a latência de sempre não é um pico.
+	if h.observe(http.StatusOK, 1200*time.Millisecond, false) {
+		t.Fatal("an ordinary response after timing probes must not look like a spike")
+	}
+}
@@ -0,0 +1,597 @@
+package active
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghostn3xus/reconsec/pkg/approval"
+	"gopkg.in/yaml.v3"
+)
+
+// PayloadSchemaVersion é a versão atual do formato dos arquivos de payload. Um
+// arquivo que é apenas uma lista de templates é tratado como versão 1.
+const PayloadSchemaVersion = 2
+
+// KnownCategories são as categorias aceitas em PayloadTemplate.Category.
+var KnownCategories = []string{"marker", "xss", "sqli", "nosqli", "ssrf", "xxe", "cmdi", "lfi", "ssti", "redirect", "crlf"}
+
+var (
+	knownMatcherTypes   = map[string]bool{"status": true, "word": true, "regex": true, "size": true, "time": true}
+	knownExtractorTypes = map[string]bool{"regex": true, "kval": true, "json": true}
+)
+
+// ValidationError aponta um problema em um arquivo de payload.
+type ValidationError struct {
+	File    string `json:"file"`
+	Line    int    `json:"line,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	loc := e.File
+	if e.Line > 0 {
+		loc += ":" + strconv.Itoa(e.Line)
+	}
+	if e.Field != "" {
+		return fmt.Sprintf("%s: %s: %s", loc, e.Field, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", loc, e.Message)
+}
+
+// loadedTemplate é um template lido de um arquivo com os erros encontrados nele.
+type loadedTemplate struct {
+	PayloadTemplate
+	file  string
+	line  int
+	index int
+	node  *yaml.Node
+	errs  []ValidationError
+}
+
+// isPayloadFile indica se o arquivo tem uma extensão de template de payload.
+func isPayloadFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json", ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// payloadFiles lista os arquivos de template de um arquivo ou diretório.
+func payloadFiles(path string) ([]string, error) {
+	if strings.TrimSpace(path) == "" {
+		return nil, fmt.Errorf("payload path required")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not access path %s: %w", path, err)
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read directory %s: %w", path, err)
+	}
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() && isPayloadFile(e.Name()) {
+			files = append(files, filepath.Join(path, e.Name()))
+		}
+	}
+	return files, nil
+}
+
+// parsePayloadData lê um arquivo JSON ou YAML e valida cada template. Os erros
+// de nível de arquivo (sintaxe, versão) são devolvidos à parte.
+func parsePayloadData(file string, data []byte) ([]loadedTemplate, []ValidationError) {
+	// YAML é um superconjunto de JSON, então o mesmo parser atende aos dois
+	// formatos e fornece as linhas de cada campo.
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, []ValidationError{{File: file, Line: yamlErrorLine(err.Error()), Message: err.Error()}}
+	}
+	if len(root.Content) == 0 {
+		return nil, []ValidationError{{File: file, Message: "empty payload file"}}
+	}
+
+	doc := root.Content[0]
+	var list *yaml.Node
+	switch doc.Kind {
+	case yaml.SequenceNode:
+		list = doc
+	case yaml.MappingNode:
+		version := 0
+		for i := 0; i+1 < len(doc.Content); i += 2 {
+			k, v := doc.Content[i], doc.Content[i+1]
+			switch k.Value {
+			case "schema_version":
+				n, err := strconv.Atoi(v.Value)
+				if err != nil {
+					return nil, []ValidationError{{File: file, Line: v.Line, Field: "schema_version", Message: "must be an integer"}}
+				}
+				version = n
+			case "payloads":
+				list = v
+			default:
+				return nil, []ValidationError{{File: file, Line: k.Line, Field: k.Value, Message: "unknown top-level field"}}
+			}
+		}
+		if version == 0 {
+			return nil, []ValidationError{{File: file, Line: doc.Line, Field: "schema_version", Message: "required"}}
+		}
+		if version > PayloadSchemaVersion {
+			return nil, []ValidationError{{File: file, Line: doc.Line, Field: "schema_version",
+				Message: fmt.Sprintf("unsupported version %d (this build supports up to %d)", version, PayloadSchemaVersion)}}
+		}
+		if list == nil || list.Kind != yaml.SequenceNode {
+			return nil, []ValidationError{{File: file, Line: doc.Line, Field: "payloads", Message: "must be a list of templates"}}
+		}
+	default:
+		return nil, []ValidationError{{File: file, Line: doc.Line, Message: "expected a list of templates or a document with schema_version and payloads"}}
+	}
+
+	var out []loadedTemplate
+	for i, item := range list.Content {
+		lt := loadedTemplate{file: file, line: item.Line, index: i, node: item}
+		prefix := fmt.Sprintf("payloads[%d]", i)
+
+		if item.Kind != yaml.MappingNode {
+			lt.errs = append(lt.errs, ValidationError{File: file, Line: item.Line, Field: prefix, Message: "template must be an object"})
+			out = append(out, lt)
+			continue
+		}
+
+		for _, p := range unknownFields(item, reflect.TypeOf(PayloadTemplate{}), nil) {
+			lt.errs = append(lt.errs, ValidationError{File: file, Line: p.line, Field: joinField(prefix, p.path), Message: p.msg})
+		}
+		if err := item.Decode(&lt.PayloadTemplate); err != nil {
+			lt.errs = append(lt.errs, typeErrors(file, item, prefix, err)...)
+		} else {
+			for _, p := range validateTemplate(lt.PayloadTemplate) {
+				lt.errs = append(lt.errs, ValidationError{File: file, Line: lineAt(item, p.path), Field: joinField(prefix, p.path), Message: p.msg})
+			}
+		}
+		out = append(out, lt)
+	}
+	return out, nil
+}
+
+type fieldProblem struct {
+	path []interface{}
+	line int
+	msg  string
+}
+
+// validateTemplate verifica as regras semânticas de um template já decodificado.
+func validateTemplate(t PayloadTemplate) []fieldProblem {
+	var probs []fieldProblem
+	add := func(msg string, path ...interface{}) {
+		probs = append(probs, fieldProblem{path: path, msg: msg})
+	}
+
+	if strings.TrimSpace(t.Name) == "" {
+		add("required", "name")
+	}
+	if t.Category == "" {
+		add("required", "category")
+	} else if !isKnownCategory(t.Category) {
+		add(fmt.Sprintf("unknown category %q (known: %s)", t.Category, strings.Join(KnownCategories, ", ")), "category")
+	}
+	if !hasInject(t.Template) && !t.isTimeBased() && !t.isDifferential() && !t.usesOOB() {
+		add("missing {{INJECT}} placeholder", "template")
+	}
+	for _, msg := range templateProblems(t.Template) {
+		add(msg, "template")
+	}
+	for _, msg := range templateProblems(t.FalseTemplate) {
+		add(msg, "false_template")
+	}
+	if t.isDifferential() && t.isTimeBased() {
+		add("a template cannot be both time-based and differential", "false_template")
+	}
+	if t.usesOOB() && (t.isTimeBased() || t.isDifferential()) {
+		// Cada rodada leva outro identificador e a interação não seria correlacionada.
+		add("out-of-band placeholders cannot be used in time-based or differential templates", "template")
+	}
+	if t.Request != nil {
+		validateRequestDef(*t.Request, func(msg string, path ...interface{}) {
+			add(msg, append([]interface{}{"request"}, path...)...)
+		})
+	}
+	if t.isMacro() {
+		if t.Request != nil {
+			add("request and steps cannot be used together", "steps")
+		}
+		if t.isTimeBased() || t.isDifferential() {
+			add("a sequence cannot be time-based or differential", "steps")
+		}
+		injected := 0
+		extracted := map[string]bool{}
+		for i, st := range t.Steps {
+			validateRequestDef(st.Request, func(msg string, path ...interface{}) {
+				add(msg, append([]interface{}{"steps", i, "request"}, path...)...)
+			})
+			if st.Inject {
+				injected++
+				if injected > 1 {
+					add("only one step can receive the injection", "steps", i, "inject")
+				}
+			}
+			validateExtractors(st.Extractors, extracted, func(msg string, path ...interface{}) {
+				add(msg, append([]interface{}{"steps", i, "extractors"}, path...)...)
+			})
+		}
+	}
+	if t.Safety != "" && safetyRank(t.Safety) < 0 {
+		add(fmt.Sprintf("unknown safety class %q (known: %s)", t.Safety, strings.Join(SafetyClasses, ", ")), "safety")
+	}
+	for i, enc := range t.Encodings {
+		if _, ok := Encodings[enc]; !ok {
+			add(fmt.Sprintf("unknown encoding %q (known: %s)", enc, strings.Join(encodingNames(), ", ")), "encodings", i)
+		}
+	}
+	switch strings.ToLower(t.MatchersCondition) {
+	case "", "and", "or":
+	default:
+		add(fmt.Sprintf("must be \"and\" or \"or\", got %q", t.MatchersCondition), "matchers-condition")
+	}
+
+	for i, m := range t.Matchers {
+		validateMatcher(m, func(msg string, path ...interface{}) {
+			add(msg, append([]interface{}{"matchers", i}, path...)...)
+		})
+	}
+
+	validateExtractors(t.Extractors, map[string]bool{}, func(msg string, path ...interface{}) {
+		add(msg, append([]interface{}{"extractors"}, path...)...)
+	})
+	return probs
+}
+
+// validateRequestDef verifica os placeholders da requisição de um template ou etapa.
+func validateRequestDef(d RequestDef, add func(msg string, path ...interface{})) {
+	for _, msg := range templateProblems(d.Path) {
+		add(msg, "path")
+	}
+	for _, msg := range templateProblems(d.Body) {
+		add(msg, "body")
+	}
+	for k, v := range d.Headers {
+		for _, msg := range templateProblems(v) {
+			add(msg, "headers", k)
+		}
+	}
+}
+
+// validateExtractors verifica uma lista de extractors; names acumula os nomes
+// já usados, para apontar duplicatas entre etapas.
+func validateExtractors(list []Extractor, names map[string]bool, add func(msg string, path ...interface{})) {
+	for i, e := range list {
+		at := func(path ...interface{}) []interface{} { return append([]interface{}{i}, path...) }
+		if e.Name == "" {
+			add("required", at("name")...)
+		} else if names[e.Name] {
+			add(fmt.Sprintf("duplicate extractor name %q", e.Name), at("name")...)
+		}
+		names[e.Name] = true
+		if !knownExtractorTypes[e.Type] {
+			add(fmt.Sprintf("unknown extractor type %q", e.Type), at("type")...)
+			continue
+		}
+		switch e.Type {
+		case "regex":
+			if len(e.Regex) == 0 {
+				add("regex extractor needs at least one expression", at("regex")...)
+			}
+			for j, expr := range e.Regex {
+				re, err := regexp.Compile(expr)
+				if err != nil {
+					add("invalid regex: "+err.Error(), at("regex", j)...)
+				} else if e.Group > re.NumSubexp() {
+					add(fmt.Sprintf("group %d exceeds the %d capture group(s) of the expression", e.Group, re.NumSubexp()), at("group")...)
+				}
+			}
+		case "kval":
+			if len(e.KVal) == 0 {
+				add("kval extractor needs at least one name", at("kval")...)
+			}
+		case "json":
+			if len(e.JSON) == 0 {
+				add("json extractor needs at least one path", at("json")...)
+			}
+		}
+	}
+}
+
+func validateMatcher(m Matcher, add func(msg string, path ...interface{})) {
+	if !knownMatcherTypes[m.Type] {
+		add(fmt.Sprintf("unknown matcher type %q", m.Type), "type")
+		return
+	}
+	switch strings.ToLower(m.Condition) {
+	case "", "and", "or":
+	default:
+		add(fmt.Sprintf("must be \"and\" or \"or\", got %q", m.Condition), "condition")
+	}
+
+	switch m.Type {
+	case "status":
+		if len(m.Status) == 0 {
+			add("status matcher needs at least one code", "status")
+		}
+		for i, s := range m.Status {
+			if s < 100 || s > 999 {
+				add(fmt.Sprintf("invalid HTTP status %d", s), "status", i)
+			}
+		}
+	case "size":
+		if len(m.Size) == 0 {
+			add("size matcher needs at least one value", "size")
+		}
+	case "time":
+		if m.Duration <= 0 {
+			add("time matcher needs a positive duration in seconds", "duration")
+		}
+	case "word":
+		if len(m.Words) == 0 {
+			add("word matcher needs at least one word", "words")
+		}
+		for i, w := range m.Words {
+			if w == "" {
+				add("empty word", "words", i)
+			}
+			for _, msg := range templateProblems(w) {
+				add(msg, "words", i)
+			}
+		}
+	case "regex":
+		if len(m.Regex) == 0 {
+			add("regex matcher needs at least one expression", "regex")
+		}
+		for i, expr := range m.Regex {
+			// As variáveis são substituídas por texto literal antes de compilar.
+			for _, msg := range templateProblems(expr) {
+				add(msg, "regex", i)
+			}
+			expr = expandVars(expr, map[string]string{"payload": "x", "encoded": "x", "marker": "x", "randstr": "x", "randint": "x", "host": "x"})
+			if _, err := regexp.Compile(expr); err != nil {
+				add("invalid regex: "+err.Error(), "regex", i)
+			}
+		}
+	}
+}
+
+func encodingNames() []string {
+	names := make([]string, 0, len(Encodings))
+	for n := range Encodings {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func isKnownCategory(c string) bool {
+	for _, k := range KnownCategories {
+		if c == k {
+			return true
+		}
+	}
+	return false
+}
+
+// unknownFields aponta chaves que não correspondem a nenhum campo (tag yaml) do tipo,
+// descendo em structs, ponteiros e listas de structs.
+func unknownFields(node *yaml.Node, t reflect.Type, path []interface{}) []fieldProblem {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	var probs []fieldProblem
+	switch {
+	case t.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		fields := map[string]reflect.Type{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			fields[name] = f.Type
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k, v := node.Content[i], node.Content[i+1]
+			p := append(append([]interface{}{}, path...), k.Value)
+			ft, ok := fields[k.Value]
+			if !ok {
+				probs = append(probs, fieldProblem{path: p, line: k.Line, msg: "unknown field"})
+				continue
+			}
+			probs = append(probs, unknownFields(v, ft, p)...)
+		}
+	case t.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode:
+		for i, item := range node.Content {
+			probs = append(probs, unknownFields(item, t.Elem(), append(append([]interface{}{}, path...), i))...)
+		}
+	}
+	return probs
+}
+
+// lineAt devolve a linha do nó no caminho indicado ou, se ele não existir,
+// a do ancestral mais próximo.
+func lineAt(node *yaml.Node, path []interface{}) int {
+	line := node.Line
+	cur := node
+	for _, p := range path {
+		var next *yaml.Node
+		switch k := p.(type) {
+		case string:
+			if cur.Kind == yaml.MappingNode {
+				for i := 0; i+1 < len(cur.Content); i += 2 {
+					if cur.Content[i].Value == k {
+						next = cur.Content[i+1]
+						line = cur.Content[i].Line
+					}
+				}
+			}
+		case int:
+			if cur.Kind == yaml.SequenceNode && k < len(cur.Content) {
+				next = cur.Content[k]
+				line = next.Line
+			}
+		}
+		if next == nil {
+			return line
+		}
+		cur = next
+	}
+	return line
+}
+
+func joinField(prefix string, path []interface{}) string {
+	var sb strings.Builder
+	sb.WriteString(prefix)
+	for _, p := range path {
+		switch k := p.(type) {
+		case string:
+			sb.WriteString("." + k)
+		case int:
+			fmt.Fprintf(&sb, "[%d]", k)
+		}
+	}
+	return sb.String()
+}
+
+var yamlLineRe = regexp.MustCompile(`line (\d+)`)
+
+func yamlErrorLine(msg string) int {
+	if m := yamlLineRe.FindStringSubmatch(msg); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		return n
+	}
+	return 0
+}
+
+// typeErrors converte os erros de tipo do yaml (um por campo) em ValidationErrors,
+// localizando o campo pela linha informada na mensagem.
+func typeErrors(file string, item *yaml.Node, prefix string, err error) []ValidationError {
+	te, ok := err.(*yaml.TypeError)
+	if !ok {
+		return []ValidationError{{File: file, Line: item.Line, Field: prefix, Message: err.Error()}}
+	}
+	var out []ValidationError
+	for _, msg := range te.Errors {
+		l := yamlErrorLine(msg)
+		field := prefix
+		if l == 0 {
+			l = item.Line
+		} else if path := pathAtLine(item, l, nil); path != nil {
+			field = joinField(prefix, path)
+		}
+		msg = strings.TrimLeft(yamlLineRe.ReplaceAllString(msg, ""), ": ")
+		out = append(out, ValidationError{File: file, Line: l, Field: field, Message: msg})
+	}
+	return out
+}
+
+// pathAtLine devolve o caminho do nó escalar mais profundo na linha indicada.
+func pathAtLine(node *yaml.Node, line int, path []interface{}) []interface{} {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k, v := node.Content[i], node.Content[i+1]
+			p := append(append([]interface{}{}, path...), k.Value)
+			if found := pathAtLine(v, line, p); found != nil {
+				return found
+			}
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			if found := pathAtLine(item, line, append(append([]interface{}{}, path...), i)); found != nil {
+				return found
+			}
+		}
+	case yaml.ScalarNode:
+		if node.Line == line {
+			return path
+		}
+	}
+	return nil
+}
+
+// loadTemplates lê todos os arquivos e aplica as verificações entre arquivos
+// (nomes duplicados). Arquivos recusados pela política de aprovação não são
+// carregados; só a validação de schema, que nunca envia nada, passa nil para
+// dispensar a verificação. Os templates vêm em ordem de arquivo.
+func loadTemplates(files []string, policy *approval.Policy) ([]loadedTemplate, []ValidationError, error) {
+	var all []loadedTemplate
+	var problems []ValidationError
+
+	seen := map[string]loadedTemplate{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			problems = append(problems, ValidationError{File: file, Message: err.Error()})
+			continue
+		}
+
+		if policy != nil {
+			res, allowed, err := policy.Check(file, data)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !allowed {
+				msg := fmt.Sprintf("refused: payload file is %s", res.Status)
+				if res.Detail != "" {
+					msg += " (" + res.Detail + ")"
+				}
+				problems = append(problems, ValidationError{File: file, Field: "signature", Message: msg})
+				continue
+			}
+		}
+
+		tpls, fileErrs := parsePayloadData(file, data)
+		problems = append(problems, fileErrs...)
+		for _, lt := range tpls {
+			if first, dup := seen[lt.Name]; dup && lt.Name != "" {
+				lt.errs = append(lt.errs, ValidationError{File: lt.file, Line: lineAt(lt.node, []interface{}{"name"}), Field: fmt.Sprintf("payloads[%d].name", lt.index),
+					Message: fmt.Sprintf("duplicate name %q (first defined at %s:%d)", lt.Name, first.file, first.line)})
+			} else if lt.Name != "" {
+				seen[lt.Name] = lt
+			}
+			problems = append(problems, lt.errs...)
+			all = append(all, lt)
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].File != problems[j].File {
+			return problems[i].File < problems[j].File
+		}
+		return problems[i].Line < problems[j].Line
+	})
+	return all, problems, nil
+}
+
+// ValidatePayloads valida todos os templates de um arquivo ou diretório e
+// devolve cada problema encontrado, com arquivo, linha e campo.
+func ValidatePayloads(path string) ([]ValidationError, error) {
+	files, err := payloadFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no payload files found in %s", path)
+	}
+	_, problems, err := loadTemplates(files, nil)
+	return problems, err
+}
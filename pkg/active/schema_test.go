@@ -0,0 +1,110 @@
+package active
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const invalidYAML = `schema_version: 2
+payloads:
+  - name: ok
+    category: xss
+    template: "<b>{{INJECT}}</b>"
+  - name: bad
+    category: rce
+    template: "static"
+    matchers:
+      - type: regex
+        regex: ["(unclosed"]
+  - name: ok
+    category: marker
+    template: "{{INJECT}}"
+`
+
+func TestValidatePayloadsReportsLines(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.yaml"), []byte(invalidYAML), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := ValidatePayloads(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"a.yaml:7: payloads[1].category: unknown category",
+		"a.yaml:8: payloads[1].template: missing {{INJECT}}",
+		"a.yaml:11: payloads[1].matchers[0].regex[0]: invalid regex",
+		"a.yaml:12: payloads[2].name: duplicate name \"ok\"",
+	}
+	if len(problems) != len(want) {
+		t.Fatalf("expected %d problems, got %v", len(want), problems)
+	}
+	for i, w := range want {
+		if !strings.Contains(problems[i].Error(), w) {
+			t.Errorf("problem %d: expected %q in %q", i, w, problems[i].Error())
+		}
+	}
+}
+
+func TestLoadPayloadsStrict(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.yaml"), []byte(invalidYAML), 0o644)
+	os.WriteFile(filepath.Join(dir, "b.json"), []byte(`[{"name":"j","category":"sqli","template":"'{{INJECT}}"}]`), 0o644)
+
+	payloads, problems, err := LoadPayloadsWithOptions(dir, LoadOptions{Approval: unsigned})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payloads) != 2 || payloads[0].Name != "ok" || payloads[1].Name != "j" || len(problems) != 4 {
+		t.Fatalf("expected the two valid templates and 4 problems, got %+v / %v", payloads, problems)
+	}
+
+	if _, _, err := LoadPayloadsWithOptions(dir, LoadOptions{Strict: true, Approval: unsigned}); err == nil {
+		t.Fatal("strict mode must refuse invalid templates")
+	}
+}
+
+func TestLoadPayloadsRequiresApproval(t *testing.T) {
+	dir := writePayloads(t, `[{"name":"m","category":"marker","template":"<b>{{INJECT}}</b>"}]`)
+
+	// Sem política não há chaveiro: o arquivo não assinado é recusado.
+	if payloads, err := LoadPayloads(dir, nil); err == nil || !strings.Contains(err.Error(), "unsigned") || len(payloads) != 0 {
+		t.Fatalf("expected an unsigned file to be refused, got %+v (%v)", payloads, err)
+	}
+	if _, err := RunActiveScan(ActiveOptions{URL: "http://127.0.0.1:1/?q=1", PayloadsPath: dir, SkipWAFDetection: true}); err == nil {
+		t.Fatal("expected a scan without an approval policy to refuse unsigned payloads")
+	}
+	if payloads, err := LoadPayloads(dir, unsigned); err != nil || len(payloads) != 1 {
+		t.Fatalf("AllowUnsigned must accept the file, got %+v (%v)", payloads, err)
+	}
+}
+
+func TestValidatePayloadsUnsupportedVersion(t *testing.T) {
+	_, errs := parsePayloadData("v.yaml", []byte("schema_version: 99\npayloads: []\n"))
+	if len(errs) != 1 || !strings.Contains(errs[0].Message, "unsupported version 99") {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+}
+
+func TestValidatePayloadsOOBInProbeTemplates(t *testing.T) {
+	dir := writePayloads(t, `[
+  {"name":"t","category":"sqli","template":"sleep({{DELAY}}) {{OOB}}"},
+  {"name":"d","category":"sqli","template":"1 {{OOB}}","false_template":"0"}
+]`)
+	problems, err := ValidatePayloads(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 2 {
+		t.Fatalf("expected both templates to be refused, got %v", problems)
+	}
+	for _, p := range problems {
+		if !strings.Contains(p.Error(), "out-of-band placeholders cannot be used") {
+			t.Errorf("unexpected problem %v", p)
+		}
+	}
+}
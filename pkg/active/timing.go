@@ -0,0 +1,219 @@
+package active
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ghostn3xus/reconsec/pkg/report"
+)
+
+// TimingOptions configura a detecção cega baseada em tempo.
+type TimingOptions struct {
+	// Delays são os atrasos pedidos ao alvo em segundos (padrão 1, 2 e 4). São
+	// necessários ao menos dois valores distintos para a regressão.
+	Delays []float64
+
+	// Trials é o número de rodadas com todos os atrasos (padrão 2).
+	Trials int
+
+	// BaselineSamples é o número de requisições limpas usadas para medir a
+	// latência normal (padrão 5).
+	BaselineSamples int
+
+	// MinR2 é o coeficiente de determinação mínimo da regressão (padrão 0.9).
+	MinR2 float64
+}
+
+const (
+	// minDelayRatio é a fração do atraso pedido que cada amostra precisa exibir
+	// acima da mediana da linha de base.
+	minDelayRatio = 0.7
+	minSlope      = 0.7
+	maxSlope      = 1.5
+)
+
+func (o TimingOptions) withDefaults() TimingOptions {
+	if len(o.Delays) == 0 {
+		o.Delays = []float64{1, 2, 4}
+	}
+	if o.Trials <= 0 {
+		o.Trials = 2
+	}
+	if o.BaselineSamples <= 0 {
+		o.BaselineSamples = 5
+	}
+	if o.MinR2 <= 0 {
+		o.MinR2 = 0.9
+	}
+	return o
+}
+
+// isTimeBased informa se o template pede um atraso ({{DELAY}} ou {{DELAY_MS}}).
+func (p PayloadTemplate) isTimeBased() bool {
+	for _, sub := range placeholderRe.FindAllStringSubmatch(p.Template, -1) {
+		if sub[1] == "DELAY" || sub[1] == "DELAY_MS" {
+			return true
+		}
+	}
+	return false
+}
+
+func delayVars(d float64) map[string]string {
+	return map[string]string{
+		"DELAY":    strconv.FormatFloat(d, 'f', -1, 64),
+		"DELAY_MS": strconv.Itoa(int(d * 1000)),
+	}
+}
+
+func durations(exs []*Exchange) []time.Duration {
+	out := make([]time.Duration, len(exs))
+	for i, ex := range exs {
+		out[i] = ex.Duration
+	}
+	return out
+}
+
+// planTimingJobs monta um job por ponto de injeção (e variante) de um template
+// baseado em tempo. Cada job envia o payload com todos os atrasos configurados.
+func planTimingJobs(base HTTPRequest, p PayloadTemplate, vars map[string]string, opts TimingOptions, cache *baselineCache) ([]job, error) {
+	clean := stripMarkers(base)
+	perDelay := make([][]attempt, len(opts.Delays))
+	for i, d := range opts.Delays {
+		attempts, err := planAttemptsWith(base, p, mergeVars(vars, delayVars(d)))
+		if err != nil {
+			return nil, err
+		}
+		perDelay[i] = attempts
+	}
+
+	var jobs []job
+	for k := range perDelay[0] {
+		series := make([]attempt, len(opts.Delays))
+		for i := range opts.Delays {
+			series[i] = perDelay[i][k]
+		}
+		last := series[len(series)-1]
+		jobs = append(jobs, job{
+			host:    requestHost(last.req.URL),
+			payload: p,
+			attempt: last,
+			probe: func(ctx context.Context, send sendFunc) evaluation {
+				baseline, err := cache.get(ctx, clean, opts.BaselineSamples, send)
+				if err != nil {
+					return probeError(err)
+				}
+				return runTimingProbe(ctx, send, p, series, durations(baseline), opts)
+			},
+		})
+	}
+	return jobs, nil
+}
+
+// runTimingProbe envia o payload com o maior atraso e, se a resposta demorar o
+// esperado, repete todas as rodadas e exige uma relação linear entre atraso
+// pedido e latência observada antes de reportar.
+func runTimingProbe(ctx context.Context, send sendFunc, p PayloadTemplate, series []attempt, baseline []time.Duration, opts TimingOptions) evaluation {
+	median := medianDuration(baseline)
+	var samples []report.TimingSample
+	var lastEx *Exchange
+	var sendErr error
+
+	measure := func(i int) bool {
+		ex, err := send(ctx, series[i].req)
+		if err != nil {
+			sendErr = err
+			return false
+		}
+		lastEx = ex
+		d := opts.Delays[i]
+		samples = append(samples, report.TimingSample{DelaySeconds: d, ObservedMs: ex.Duration.Milliseconds()})
+		return ex.Duration-median >= time.Duration(minDelayRatio*d*float64(time.Second))
+	}
+
+	last := len(series) - 1
+	ok := measure(last)
+	for t := 0; ok && t < opts.Trials; t++ {
+		for i := range series {
+			if !measure(i) {
+				ok = false
+				break
+			}
+		}
+	}
+	if lastEx == nil {
+		return probeError(sendErr)
+	}
+
+	timing := analyzeTiming(baseline, samples)
+
+	confirmed := ok && timing.R2 >= opts.MinR2 && timing.Slope >= minSlope && timing.Slope <= maxSlope
+	if !confirmed {
+		return evaluation{outcome: outcomeMiss}
+	}
+
+	ev := lastEx.Evidence()
+	ev.Timing = &timing
+	ev.Matcher = "time-based"
+	ev.Excerpt = responseHead(lastEx)
+	return evaluation{outcome: outcomeFinding, finding: &report.Finding{
+		Type:       "VulnerabilityFound",
+		Severity:   report.SeverityHigh,
+		Confidence: report.ConfidenceHigh,
+		URL:        lastEx.Request.URL,
+		Notes: fmt.Sprintf("Payload '%s' at %s delayed the response in proportion to the requested delay (slope %.2f, r² %.3f, %d samples).",
+			p.Name, series[last].point, timing.Slope, timing.R2, len(samples)),
+		Evidence: ev,
+	}}
+}
+
+// analyzeTiming ajusta uma reta (mínimos quadrados) entre o atraso pedido e a
+// latência observada, ambos em segundos.
+func analyzeTiming(baseline []time.Duration, samples []report.TimingSample) report.TimingEvidence {
+	ev := report.TimingEvidence{BaselineMedianMs: medianDuration(baseline).Milliseconds(), Samples: samples}
+	for _, b := range baseline {
+		ev.BaselineMs = append(ev.BaselineMs, b.Milliseconds())
+	}
+
+	n := float64(len(samples))
+	if n < 2 {
+		return ev
+	}
+	var sx, sy float64
+	for _, s := range samples {
+		sx += s.DelaySeconds
+		sy += float64(s.ObservedMs) / 1000
+	}
+	mx, my := sx/n, sy/n
+
+	var sxx, sxy, syy float64
+	for _, s := range samples {
+		dx, dy := s.DelaySeconds-mx, float64(s.ObservedMs)/1000-my
+		sxx += dx * dx
+		sxy += dx * dy
+		syy += dy * dy
+	}
+	if sxx == 0 || syy == 0 {
+		return ev
+	}
+	ev.Slope = round3(sxy / sxx)
+	ev.Intercept = round3(my - sxy/sxx*mx)
+	ev.R2 = round3(sxy * sxy / (sxx * syy))
+	return ev
+}
+
+func medianDuration(ds []time.Duration) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), ds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)/2]
+}
+
+func round3(f float64) float64 {
+	return math.Round(f*1000) / 1000
+}
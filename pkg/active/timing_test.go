@@ -0,0 +1,88 @@
+package active
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ghostn3xus/reconsec/pkg/report"
+)
+
+var sleepRe = regexp.MustCompile(`SLEEP\(([0-9.]+)\)`)
+
+// sleepServer dorme o tempo pedido em SLEEP(n) no parâmetro q; com fixed > 0,
+// dorme sempre fixed, independentemente do valor.
+func sleepServer(fixed time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m := sleepRe.FindStringSubmatch(r.URL.Query().Get("q")); m != nil {
+			d := fixed
+			if d == 0 {
+				secs, _ := strconv.ParseFloat(m[1], 64)
+				d = time.Duration(secs * float64(time.Second))
+			}
+			time.Sleep(d)
+		}
+		w.Write([]byte("ok"))
+	}))
+}
+
+func timedScan(t *testing.T, srv *httptest.Server) ScanResult {
+	t.Helper()
+	res, err := RunActiveScan(ActiveOptions{
+		URL:              srv.URL + "/?q=1",
+		PayloadsPath:     writePayloads(t, `[{"name":"sleep","category":"sqli","template":"1' AND SLEEP({{DELAY}})-- "}]`),
+		PayloadApproval:  unsigned,
+		Rate:             1000,
+		SkipWAFDetection: true,
+		Timing:           TimingOptions{Delays: []float64{0.1, 0.2, 0.3}, Trials: 2, BaselineSamples: 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func findingAt(res ScanResult, point string) *report.Finding {
+	re := regexp.MustCompile(`at ` + regexp.QuoteMeta(point) + `\b`)
+	for i, f := range res.Findings {
+		if re.MatchString(f.Notes) {
+			return &res.Findings[i]
+		}
+	}
+	return nil
+}
+
+func TestTimeBasedDetection(t *testing.T) {
+	srv := sleepServer(0)
+	defer srv.Close()
+
+	f := findingAt(timedScan(t, srv), "query:q")
+	if f == nil || f.Type != "VulnerabilityFound" {
+		t.Fatalf("expected a time-based finding, got %+v", f)
+	}
+	tm := f.Evidence.Timing
+	if tm == nil || len(tm.BaselineMs) != 3 || len(tm.Samples) != 7 || tm.R2 < 0.9 || tm.Slope < 0.7 || tm.Slope > 1.5 {
+		t.Fatalf("unexpected timing evidence %+v", tm)
+	}
+}
+
+func TestTimeBasedRejectsConstantDelay(t *testing.T) {
+	srv := sleepServer(300 * time.Millisecond)
+	defer srv.Close()
+
+	res := timedScan(t, srv)
+	if len(res.Findings) != 0 || res.Stats.Attempts != 1 {
+		t.Fatalf("a delay unrelated to the payload must not be reported, got %+v / %+v", res.Findings, res.Stats)
+	}
+}
+
+func TestAnalyzeTiming(t *testing.T) {
+	samples := []report.TimingSample{{DelaySeconds: 1, ObservedMs: 1010}, {DelaySeconds: 2, ObservedMs: 2005}, {DelaySeconds: 4, ObservedMs: 4020}}
+	ev := analyzeTiming([]time.Duration{10 * time.Millisecond}, samples)
+	if ev.Slope != 1.004 || ev.R2 != 1 || ev.BaselineMedianMs != 10 {
+		t.Fatalf("unexpected fit %+v", ev)
+	}
+}
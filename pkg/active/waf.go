@@ -0,0 +1,264 @@
+package active
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// wafProbeQuery é uma consulta de aparência maliciosa, porém inerte, usada para
+// provocar a página de bloqueio de um WAF. Nada aqui é executado no alvo.
+var wafProbeQuery = url.Values{
+	"id":   {"1' OR '1'='1"},
+	"q":    {"<script>alert(1)</script>"},
+	"file": {"../../../../etc/passwd"},
+}.Encode()
+
+// WAFResult descreve o que foi identificado na frente do alvo antes da varredura ativa.
+type WAFResult struct {
+	Detected        bool     `json:"detected"`
+	Blocking        bool     `json:"blocking"`
+	WAF             []string `json:"waf,omitempty"`
+	CDN             []string `json:"cdn,omitempty"`
+	Signals         []string `json:"signals,omitempty"`
+	BenignStatus    int      `json:"benign_status"`
+	MaliciousStatus int      `json:"malicious_status"`
+}
+
+type wafSignature struct {
+	Name    string
+	CDN     bool
+	WAF     bool
+	Headers map[string]string // cabeçalho -> substring (vazio = basta existir)
+	Cookies []string          // prefixos de nome de cookie
+	Body    []string          // assinaturas da página de bloqueio
+
+	// WeakBody são textos comuns também fora de páginas de bloqueio; só contam
+	// se a sonda maliciosa mudar o status ou trouxer um cabeçalho do fabricante.
+	WeakBody []string
+}
+
+var wafSignatures = []wafSignature{
+	{
+		Name: "Cloudflare", CDN: true, WAF: true,
+		Headers: map[string]string{"cf-ray": "", "server": "cloudflare", "cf-cache-status": ""},
+		Cookies: []string{"__cf_bm", "__cfduid", "cf_clearance"},
+		Body:    []string{"attention required! | cloudflare", "cloudflare ray id", "cf-error-details"},
+	},
+	{
+		Name: "Akamai", CDN: true, WAF: true,
+		Headers:  map[string]string{"server": "akamaighost", "x-akamai-transformed": "", "akamai-grn": ""},
+		Cookies:  []string{"ak_bmsc", "bm_sz", "_abck"},
+		Body:     []string{"you don't have permission to access"},
+		WeakBody: []string{"reference #"},
+	},
+	{
+		Name: "AWS CloudFront", CDN: true,
+		Headers: map[string]string{"x-amz-cf-id": "", "x-amz-cf-pop": "", "via": "cloudfront"},
+	},
+	{
+		Name: "AWS WAF", WAF: true,
+		Headers: map[string]string{"x-amzn-waf-action": ""},
+		Cookies: []string{"aws-waf-token"},
+		Body:    []string{"request blocked.", "generated by cloudfront"},
+	},
+	{
+		Name: "Imperva Incapsula", CDN: true, WAF: true,
+		Headers: map[string]string{"x-iinfo": "", "x-cdn": "incapsula"},
+		Cookies: []string{"incap_ses_", "visid_incap_", "nlbi_"},
+		Body:    []string{"incapsula incident id", "_incapsula_resource"},
+	},
+	{
+		Name: "Sucuri", CDN: true, WAF: true,
+		Headers: map[string]string{"x-sucuri-id": "", "x-sucuri-cache": "", "server": "sucuri"},
+		Body:    []string{"sucuri website firewall", "cloudproxy@sucuri.net"},
+	},
+	{
+		Name: "F5 BIG-IP ASM", WAF: true,
+		Headers: map[string]string{"x-wa-info": "", "server": "bigip"},
+		Cookies: []string{"bigipserver", "ts01", "f5_cspm"},
+		Body:    []string{"the requested url was rejected. please consult with your administrator."},
+	},
+	{
+		Name: "ModSecurity", WAF: true,
+		Headers: map[string]string{"server": "mod_security"},
+		Body:    []string{"mod_security", "this error was generated by mod_security", "modsecurity"},
+	},
+	{
+		Name: "Fastly", CDN: true,
+		Headers: map[string]string{"x-fastly-request-id": "", "x-served-by": "cache-", "fastly-debug-digest": ""},
+	},
+	{
+		Name: "Azure Front Door", CDN: true, WAF: true,
+		Headers: map[string]string{"x-azure-ref": "", "x-fd-healthprobe": ""},
+		Body:    []string{"the request is blocked."},
+	},
+	{
+		Name: "Barracuda", WAF: true,
+		Cookies: []string{"barra_counter_session", "bni__barracuda_lb_cookie"},
+		Body:    []string{"barracuda networks"},
+	},
+	{
+		Name: "FortiWeb", WAF: true,
+		Cookies:  []string{"fortiwafsid"},
+		Body:     []string{".fgd_icon", "fortiweb"},
+		WeakBody: []string{"fortigate"},
+	},
+	{
+		Name: "Wordfence", WAF: true,
+		Body: []string{"generated by wordfence", "a potentially unsafe operation has been detected"},
+	},
+}
+
+// blockingStatuses são códigos típicos de páginas de bloqueio de WAF.
+var blockingStatuses = map[int]bool{
+	http.StatusForbidden:          true,
+	http.StatusNotAcceptable:      true,
+	http.StatusTooManyRequests:    true,
+	http.StatusNotImplemented:     true,
+	http.StatusServiceUnavailable: true,
+	419:                           true,
+	999:                           true,
+}
+
+type wafSample struct {
+	status int
+	header http.Header
+	body   string
+}
+
+// DetectWAF compara uma sonda benigna com uma de aparência maliciosa e procura
+// assinaturas conhecidas de WAF/CDN em cabeçalhos, cookies e páginas de bloqueio.
+func DetectWAF(ctx context.Context, client *http.Client, target string) (*WAFResult, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+
+	benign, err := wafFetch(ctx, client, u, "")
+	if err != nil {
+		return nil, fmt.Errorf("benign probe failed: %w", err)
+	}
+
+	res := &WAFResult{BenignStatus: benign.status}
+	found := map[string]wafSignature{}
+	signals := map[string]struct{}{}
+	matchWAFSignatures(benign, nil, found, signals)
+
+	malicious, err := wafFetch(ctx, client, u, wafProbeQuery)
+	switch {
+	case err != nil && connectionDropped(err):
+		// Uma conexão derrubada apenas na sonda maliciosa também é um sinal de bloqueio.
+		res.Blocking = true
+		signals["malicious probe dropped: "+err.Error()] = struct{}{}
+	case err != nil:
+		// Timeouts e outras falhas não indicam bloqueio.
+	default:
+		res.MaliciousStatus = malicious.status
+		matchWAFSignatures(malicious, &benign, found, signals)
+		if malicious.status != benign.status && blockingStatuses[malicious.status] {
+			res.Blocking = true
+			signals[fmt.Sprintf("malicious probe answered %d (benign %d)", malicious.status, benign.status)] = struct{}{}
+		}
+	}
+
+	for name, sig := range found {
+		if sig.WAF {
+			res.WAF = append(res.WAF, name)
+		}
+		if sig.CDN {
+			res.CDN = append(res.CDN, name)
+		}
+	}
+	for s := range signals {
+		res.Signals = append(res.Signals, s)
+	}
+	sort.Strings(res.WAF)
+	sort.Strings(res.CDN)
+	sort.Strings(res.Signals)
+
+	res.Detected = res.Blocking || len(res.WAF) > 0 || len(res.CDN) > 0
+	return res, nil
+}
+
+func wafFetch(ctx context.Context, client *http.Client, base *url.URL, query string) (wafSample, error) {
+	u := *base
+	if query != "" {
+		if u.RawQuery != "" {
+			u.RawQuery += "&" + query
+		} else {
+			u.RawQuery = query
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return wafSample{}, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return wafSample{}, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64000))
+	return wafSample{status: resp.StatusCode, header: resp.Header, body: strings.ToLower(string(body))}, nil
+}
+
+// connectionDropped informa se err é uma conexão derrubada ou fechada pelo
+// servidor (reset ou EOF), a forma como alguns WAFs bloqueiam.
+func connectionDropped(err error) bool {
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// matchWAFSignatures marca as assinaturas encontradas em uma resposta. Assinaturas
+// de corpo só contam na sonda maliciosa (benign é a resposta benigna para
+// comparação, nil na própria sonda benigna), já que textos como "access denied"
+// são comuns em páginas legítimas.
+func matchWAFSignatures(s wafSample, benign *wafSample, found map[string]wafSignature, signals map[string]struct{}) {
+	for _, sig := range wafSignatures {
+		vendorHeader := false
+		for name, want := range sig.Headers {
+			v := strings.ToLower(s.header.Get(name))
+			if v == "" && len(s.header.Values(name)) == 0 {
+				continue
+			}
+			if want == "" || strings.Contains(v, want) {
+				vendorHeader = true
+				found[sig.Name] = sig
+				signals[fmt.Sprintf("%s: header %s", sig.Name, name)] = struct{}{}
+			}
+		}
+
+		for _, c := range s.header.Values("Set-Cookie") {
+			cname := strings.ToLower(strings.TrimSpace(strings.SplitN(c, "=", 2)[0]))
+			for _, prefix := range sig.Cookies {
+				if strings.HasPrefix(cname, prefix) {
+					found[sig.Name] = sig
+					signals[fmt.Sprintf("%s: cookie %s", sig.Name, cname)] = struct{}{}
+				}
+			}
+		}
+
+		if benign == nil {
+			continue
+		}
+		body := sig.Body
+		if vendorHeader || s.status != benign.status {
+			body = append(body[:len(body):len(body)], sig.WeakBody...)
+		}
+		for _, b := range body {
+			if strings.Contains(s.body, b) {
+				found[sig.Name] = sig
+				signals[fmt.Sprintf("%s: block page %q", sig.Name, b)] = struct{}{}
+			}
+		}
+	}
+}
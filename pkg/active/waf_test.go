@@ -0,0 +1,124 @@
+package active
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetectWAFBlockPage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "cloudflare")
+		w.Header().Set("CF-RAY", "7d1f0000aaaa-GRU")
+		if strings.Contains(r.URL.RawQuery, "script") {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("<title>Attention Required! | Cloudflare</title>"))
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	res, err := DetectWAF(context.Background(), srv.Client(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Detected || !res.Blocking {
+		t.Fatalf("expected blocking WAF, got %+v", res)
+	}
+	if len(res.WAF) != 1 || res.WAF[0] != "Cloudflare" {
+		t.Fatalf("expected Cloudflare, got %v", res.WAF)
+	}
+	if res.BenignStatus != 200 || res.MaliciousStatus != 403 {
+		t.Fatalf("unexpected statuses %d/%d", res.BenignStatus, res.MaliciousStatus)
+	}
+}
+
+func TestDetectWAFNone(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("access denied is just text here"))
+	}))
+	defer srv.Close()
+
+	res, err := DetectWAF(context.Background(), srv.Client(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Detected {
+		t.Fatalf("expected no WAF, got %+v", res)
+	}
+}
+
+func TestDetectWAFWeakSignatures(t *testing.T) {
+	// Textos genéricos e o mesmo status nas duas sondas não indicam WAF.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "cookiesession1", Value: "x"})
+		w.Write([]byte("Order reference #123 for your FortiGate appliance"))
+	}))
+	defer srv.Close()
+
+	res, err := DetectWAF(context.Background(), srv.Client(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Detected {
+		t.Fatalf("generic text must not flag a WAF, got %+v", res)
+	}
+
+	// A mesma página com mudança de status é uma página de bloqueio.
+	blocked := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.RawQuery, "script") {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("Access Denied. Reference #18.2f"))
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer blocked.Close()
+	res, err = DetectWAF(context.Background(), blocked.Client(), blocked.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.WAF) != 1 || res.WAF[0] != "Akamai" {
+		t.Fatalf("expected Akamai from the block page, got %+v", res)
+	}
+}
+
+func TestDetectWAFTransportErrors(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.RawQuery, "script") {
+			time.Sleep(300 * time.Millisecond)
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer slow.Close()
+	client := slow.Client()
+	client.Timeout = 100 * time.Millisecond
+	res, err := DetectWAF(context.Background(), client, slow.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Blocking || res.Detected {
+		t.Fatalf("a timeout is not a block, got %+v", res)
+	}
+
+	reset := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.RawQuery, "script") {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer reset.Close()
+	res, err = DetectWAF(context.Background(), reset.Client(), reset.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Blocking {
+		t.Fatalf("a dropped connection is a block, got %+v", res)
+	}
+}
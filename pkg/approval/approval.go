@@ -0,0 +1,306 @@
+// Package approval implementa a aprovação assinada de arquivos de payload:
+// aprovadores assinam os arquivos com chaves ed25519 e o scanner só carrega
+// arquivos cuja assinatura confere com um chaveiro confiável.
+package approval
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SignatureExt é a extensão do arquivo de assinatura gravado ao lado do arquivo de payload.
+const SignatureExt = ".sig"
+
+const signedContext = "reconsec-payload-approval-v1"
+
+// Status é o resultado da verificação de um arquivo.
+type Status string
+
+const (
+	StatusTrusted   Status = "trusted"
+	StatusUnsigned  Status = "unsigned"
+	StatusTampered  Status = "tampered"
+	StatusUntrusted Status = "untrusted-signer"
+)
+
+// PublicKey é uma chave de aprovador como gravada no chaveiro.
+type PublicKey struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	PublicKey string `json:"public_key"`
+}
+
+// PrivateKey é a chave de assinatura de um aprovador.
+type PrivateKey struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	PrivateKey string `json:"private_key"`
+}
+
+// Signature é a aprovação de um arquivo por um aprovador.
+type Signature struct {
+	KeyID     string    `json:"key_id"`
+	Signer    string    `json:"signer"`
+	SHA256    string    `json:"sha256"`
+	SignedAt  time.Time `json:"signed_at"`
+	Signature string    `json:"signature"`
+}
+
+// SignatureFile é o conteúdo de um arquivo .sig; um arquivo pode ter vários aprovadores.
+type SignatureFile struct {
+	Version    int         `json:"version"`
+	Signatures []Signature `json:"signatures"`
+}
+
+// Result descreve a verificação de um arquivo de payload.
+type Result struct {
+	File   string `json:"file"`
+	SHA256 string `json:"sha256"`
+	Status Status `json:"status"`
+	Signer string `json:"signer,omitempty"`
+	KeyID  string `json:"key_id,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Keyring guarda as chaves públicas de aprovadores confiáveis.
+type Keyring struct {
+	keys map[string]PublicKey
+}
+
+// KeyID deriva o identificador de uma chave pública.
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// GenerateKey cria um par de chaves para um aprovador.
+func GenerateKey(name string) (PrivateKey, PublicKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return PrivateKey{}, PublicKey{}, err
+	}
+	id := KeyID(pub)
+	return PrivateKey{ID: id, Name: name, PrivateKey: base64.StdEncoding.EncodeToString(priv)},
+		PublicKey{ID: id, Name: name, PublicKey: base64.StdEncoding.EncodeToString(pub)}, nil
+}
+
+// WriteKeyPair grava <prefix>.key (0600) e <prefix>.pub.
+func WriteKeyPair(prefix string, priv PrivateKey, pub PublicKey) error {
+	if err := writeJSON(prefix+".key", priv, 0o600); err != nil {
+		return err
+	}
+	return writeJSON(prefix+".pub", pub, 0o644)
+}
+
+// LoadPrivateKey lê uma chave de assinatura.
+func LoadPrivateKey(path string) (PrivateKey, ed25519.PrivateKey, error) {
+	var k PrivateKey
+	if err := readJSON(path, &k); err != nil {
+		return k, nil, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(k.PrivateKey)
+	if err != nil || len(raw) != ed25519.PrivateKeySize {
+		return k, nil, fmt.Errorf("invalid private key in %s", path)
+	}
+	priv := ed25519.PrivateKey(raw)
+	if id := KeyID(priv.Public().(ed25519.PublicKey)); id != k.ID {
+		return k, nil, fmt.Errorf("key id mismatch in %s", path)
+	}
+	return k, priv, nil
+}
+
+// LoadKeyring lê as chaves públicas de um arquivo .pub ou de todos os .pub de um diretório.
+func LoadKeyring(path string) (*Keyring, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not access keyring %s: %w", path, err)
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		files, err = filepath.Glob(filepath.Join(path, "*.pub"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	kr := &Keyring{keys: map[string]PublicKey{}}
+	for _, f := range files {
+		var k PublicKey
+		if err := readJSON(f, &k); err != nil {
+			return nil, fmt.Errorf("invalid public key %s: %w", f, err)
+		}
+		raw, err := base64.StdEncoding.DecodeString(k.PublicKey)
+		if err != nil || len(raw) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid public key %s", f)
+		}
+		if id := KeyID(raw); id != k.ID {
+			return nil, fmt.Errorf("key id mismatch in %s", f)
+		}
+		kr.keys[k.ID] = k
+	}
+
+	if len(kr.keys) == 0 {
+		return nil, fmt.Errorf("no trusted keys found in %s", path)
+	}
+	return kr, nil
+}
+
+// Len devolve o número de chaves confiáveis.
+func (kr *Keyring) Len() int {
+	return len(kr.keys)
+}
+
+func signedMessage(digest string, at time.Time) []byte {
+	return []byte(fmt.Sprintf("%s\n%s\n%s", signedContext, digest, at.UTC().Format(time.RFC3339)))
+}
+
+// Digest calcula o SHA-256 do conteúdo em hexadecimal.
+func Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// SignFile assina o arquivo e grava (ou atualiza) o .sig ao lado dele. Uma nova
+// assinatura do mesmo aprovador substitui a anterior.
+func SignFile(file string, key PrivateKey, priv ed25519.PrivateKey) (Signature, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return Signature{}, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	digest := Digest(data)
+	sig := Signature{
+		KeyID:     key.ID,
+		Signer:    key.Name,
+		SHA256:    digest,
+		SignedAt:  now,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(priv, signedMessage(digest, now))),
+	}
+
+	sf, err := readSignatureFile(file)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Signature{}, err
+	}
+	kept := sf.Signatures[:0]
+	for _, s := range sf.Signatures {
+		if s.KeyID != key.ID {
+			kept = append(kept, s)
+		}
+	}
+	sf.Version = 1
+	sf.Signatures = append(kept, sig)
+
+	return sig, writeJSON(file+SignatureExt, sf, 0o644)
+}
+
+func readSignatureFile(file string) (SignatureFile, error) {
+	var sf SignatureFile
+	err := readJSON(file+SignatureExt, &sf)
+	return sf, err
+}
+
+// Verify confere o conteúdo do arquivo com as assinaturas do .sig. Basta uma
+// assinatura válida de um aprovador confiável.
+func (kr *Keyring) Verify(file string, data []byte) Result {
+	res := Result{File: file, SHA256: Digest(data)}
+
+	sf, err := readSignatureFile(file)
+	if errors.Is(err, os.ErrNotExist) || err == nil && len(sf.Signatures) == 0 {
+		res.Status = StatusUnsigned
+		return res
+	}
+	if err != nil {
+		res.Status = StatusTampered
+		res.Detail = "unreadable signature file: " + err.Error()
+		return res
+	}
+
+	res.Status = StatusUntrusted
+	for _, s := range sf.Signatures {
+		k, ok := kr.keys[s.KeyID]
+		if !ok {
+			if res.Status == StatusUntrusted {
+				res.Signer, res.KeyID = s.Signer, s.KeyID
+			}
+			continue
+		}
+		pub, _ := base64.StdEncoding.DecodeString(k.PublicKey)
+		raw, err := base64.StdEncoding.DecodeString(s.Signature)
+		if err != nil || s.SHA256 != res.SHA256 || !ed25519.Verify(pub, signedMessage(s.SHA256, s.SignedAt), raw) {
+			res.Status = StatusTampered
+			res.Signer, res.KeyID = k.Name, k.ID
+			res.Detail = "content does not match the approved signature"
+			continue
+		}
+		res.Status = StatusTrusted
+		res.Signer, res.KeyID = k.Name, k.ID
+		res.Detail = ""
+		return res
+	}
+	return res
+}
+
+// Policy decide quais arquivos podem ser carregados e registra cada decisão.
+type Policy struct {
+	Keyring *Keyring
+	// AllowUnsigned aceita arquivos não assinados, adulterados ou de aprovadores
+	// desconhecidos. A decisão continua sendo registrada na auditoria.
+	AllowUnsigned bool
+	Audit         *AuditLog
+	Engagement    string
+}
+
+// Check verifica um arquivo, registra o evento na auditoria e informa se ele pode ser usado.
+func (p *Policy) Check(file string, data []byte) (Result, bool, error) {
+	var res Result
+	if p.Keyring != nil {
+		res = p.Keyring.Verify(file, data)
+	} else {
+		res = Result{File: file, SHA256: Digest(data), Status: StatusUnsigned, Detail: "no keyring configured"}
+	}
+
+	allowed := res.Status == StatusTrusted || p.AllowUnsigned
+	if p.Audit != nil {
+		if err := p.Audit.Record(AuditEvent{
+			Event:      "payload-load",
+			File:       file,
+			SHA256:     res.SHA256,
+			Status:     res.Status,
+			Signer:     res.Signer,
+			KeyID:      res.KeyID,
+			Allowed:    allowed,
+			Override:   allowed && res.Status != StatusTrusted,
+			Engagement: p.Engagement,
+		}); err != nil {
+			return res, false, fmt.Errorf("audit log: %w", err)
+		}
+	}
+	return res, allowed, nil
+}
+
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func writeJSON(path string, v interface{}, perm os.FileMode) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), perm)
+}
@@ -0,0 +1,87 @@
+package approval
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSignVerifyAndAudit(t *testing.T) {
+	dir := t.TempDir()
+	payload := filepath.Join(dir, "p.json")
+	os.WriteFile(payload, []byte(`[{"name":"m","category":"marker","template":"{{INJECT}}"}]`), 0o644)
+
+	priv, pub, err := GenerateKey("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := filepath.Join(dir, "keys")
+	os.Mkdir(keys, 0o755)
+	if err := WriteKeyPair(filepath.Join(keys, "alice"), priv, pub); err != nil {
+		t.Fatal(err)
+	}
+	kr, err := LoadKeyring(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(payload)
+	if res := kr.Verify(payload, data); res.Status != StatusUnsigned {
+		t.Fatalf("expected unsigned, got %+v", res)
+	}
+
+	key, sk, err := LoadPrivateKey(filepath.Join(keys, "alice.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SignFile(payload, key, sk); err != nil {
+		t.Fatal(err)
+	}
+	if res := kr.Verify(payload, data); res.Status != StatusTrusted || res.Signer != "alice" {
+		t.Fatalf("expected trusted, got %+v", res)
+	}
+	if res := kr.Verify(payload, append(data, ' ')); res.Status != StatusTampered {
+		t.Fatalf("expected tampered, got %+v", res)
+	}
+
+	_, otherPub, _ := GenerateKey("mallory")
+	other := &Keyring{keys: map[string]PublicKey{otherPub.ID: otherPub}}
+	if res := other.Verify(payload, data); res.Status != StatusUntrusted {
+		t.Fatalf("expected untrusted signer, got %+v", res)
+	}
+
+	logPath := filepath.Join(dir, "audit.log")
+	audit, err := OpenAuditLog(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := &Policy{Keyring: kr, Audit: audit, Engagement: "ENG-1"}
+	if _, ok, _ := policy.Check(payload, data); !ok {
+		t.Fatal("trusted file must be allowed")
+	}
+	if _, ok, _ := policy.Check(payload, append(data, ' ')); ok {
+		t.Fatal("tampered file must be refused")
+	}
+	policy.AllowUnsigned = true
+	if _, ok, _ := policy.Check(payload, append(data, ' ')); !ok {
+		t.Fatal("explicit override must allow the file")
+	}
+	audit.Close()
+
+	f, _ := os.Open(logPath)
+	defer f.Close()
+	var events []AuditEvent
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var ev AuditEvent
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, ev)
+	}
+	if len(events) != 3 || !events[0].Allowed || events[1].Allowed || !events[2].Override || events[2].Engagement != "ENG-1" {
+		t.Fatalf("unexpected audit events %+v", events)
+	}
+}
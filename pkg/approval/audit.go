@@ -0,0 +1,74 @@
+package approval
+
+import (
+	"encoding/json"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+)
+
+// AuditEvent é uma linha do log de auditoria.
+type AuditEvent struct {
+	Time       time.Time `json:"time"`
+	Event      string    `json:"event"`
+	Operator   string    `json:"operator,omitempty"`
+	Engagement string    `json:"engagement,omitempty"`
+	File       string    `json:"file"`
+	SHA256     string    `json:"sha256"`
+	Status     Status    `json:"status"`
+	Signer     string    `json:"signer,omitempty"`
+	KeyID      string    `json:"key_id,omitempty"`
+	Allowed    bool      `json:"allowed"`
+	Override   bool      `json:"override,omitempty"`
+}
+
+// AuditLog acrescenta eventos em JSON Lines a um arquivo, para que a equipe de
+// compliance possa mostrar quais payloads foram autorizados em cada engajamento.
+type AuditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenAuditLog abre (ou cria) o log de auditoria em modo append.
+func OpenAuditLog(path string) (*AuditLog, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{file: f}, nil
+}
+
+// Record grava um evento, preenchendo horário e operador.
+func (a *AuditLog) Record(ev AuditEvent) error {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+	if ev.Operator == "" {
+		ev.Operator = currentOperator()
+	}
+
+	line, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, err = a.file.Write(append(line, '\n'))
+	return err
+}
+
+func (a *AuditLog) Close() error {
+	if a.file != nil {
+		return a.file.Close()
+	}
+	return nil
+}
+
+func currentOperator() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
@@ -2,16 +2,30 @@ package discovery
 
 import (
 	"fmt"
+	"net/http"
 	"os/exec"
+	"sort"
 )
 
-// RunDirScan executa o dirsearch com configurações otimizadas para uma varredura profunda.
-func RunDirScan(baseURL string) (string, error) {
+// RunDirScan executa o dirsearch com configurações otimizadas para uma varredura
+// profunda. Os cabeçalhos (ex.: os de uma sessão autenticada) são repassados com -H.
+func RunDirScan(baseURL string, headers http.Header) (string, error) {
 	// 2. Executa o dirsearch com flags otimizadas
 	fmt.Printf("Iniciando varredura profunda com dirsearch em %s...\n", baseURL)
 
 	outputFile := "dirsearch_report.txt"
-	cmd := exec.Command("dirsearch", "-u", baseURL, "-r", "-f", "-x", "400,403,404,500", "--plain-text-report", "--output="+outputFile)
+	args := []string{"-u", baseURL, "-r", "-f", "-x", "400,403,404,500", "--plain-text-report", "--output=" + outputFile}
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range headers[k] {
+			args = append(args, "-H", k+": "+v)
+		}
+	}
+	cmd := exec.Command("dirsearch", args...)
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
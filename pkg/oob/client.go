@@ -0,0 +1,79 @@
+package oob
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client consulta um servidor de interações pela API de polling.
+type Client struct {
+	BaseURL string
+	Token   string
+	Info    Info
+	HTTP    *http.Client
+}
+
+// NewClient conecta ao servidor em baseURL e lê o domínio e a URL de callback.
+func NewClient(ctx context.Context, baseURL, token string) (*Client, error) {
+	c := &Client{BaseURL: strings.TrimRight(baseURL, "/"), Token: token, HTTP: &http.Client{Timeout: 15 * time.Second}}
+	if err := c.call(ctx, http.MethodGet, "info", nil, &c.Info); err != nil {
+		return nil, err
+	}
+	if c.Info.HTTPURL == "" {
+		c.Info.HTTPURL = c.BaseURL
+	}
+	return c, nil
+}
+
+// Host devolve o nome de callback DNS/HTTP de um identificador.
+func (c *Client) Host(id string) string {
+	return id + "." + c.Info.Domain
+}
+
+// URL devolve a URL de callback HTTP de um identificador.
+func (c *Client) URL(id string) string {
+	return c.Info.HTTPURL + "/" + id
+}
+
+// Poll devolve as interações registradas para os identificadores.
+func (c *Client) Poll(ctx context.Context, ids []string) ([]Interaction, error) {
+	var res pollResponse
+	if err := c.call(ctx, http.MethodPost, "poll", pollRequest{IDs: ids}, &res); err != nil {
+		return nil, err
+	}
+	return res.Interactions, nil
+}
+
+func (c *Client) call(ctx context.Context, method, path string, body, out interface{}) error {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+APIPrefix+path, &buf)
+	if err != nil {
+		return err
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("oob server: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oob server: %s returned %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,100 @@
+package oob
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var dnsTypes = map[uint16]string{1: "A", 2: "NS", 5: "CNAME", 15: "MX", 16: "TXT", 28: "AAAA", 255: "ANY"}
+
+type dnsQuestion struct {
+	name  string
+	qtype uint16
+	class uint16
+	end   int
+}
+
+// parseQuestion lê a primeira pergunta de uma mensagem DNS.
+func parseQuestion(msg []byte) (dnsQuestion, error) {
+	var q dnsQuestion
+	if len(msg) < 12 || binary.BigEndian.Uint16(msg[4:6]) == 0 {
+		return q, errors.New("no question")
+	}
+	var labels []string
+	i := 12
+	for {
+		if i >= len(msg) {
+			return q, errors.New("truncated name")
+		}
+		n := int(msg[i])
+		i++
+		if n == 0 {
+			break
+		}
+		if n&0xC0 != 0 || i+n > len(msg) {
+			return q, errors.New("invalid label")
+		}
+		labels = append(labels, string(msg[i:i+n]))
+		i += n
+	}
+	if i+4 > len(msg) {
+		return q, errors.New("truncated question")
+	}
+	q.name = strings.ToLower(strings.Join(labels, "."))
+	q.qtype = binary.BigEndian.Uint16(msg[i : i+2])
+	q.class = binary.BigEndian.Uint16(msg[i+2 : i+4])
+	q.end = i + 4
+	return q, nil
+}
+
+func (s *Server) serveDNS() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.dnsConn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		msg := append([]byte(nil), buf[:n]...)
+		q, err := parseQuestion(msg)
+		if err != nil {
+			continue
+		}
+
+		inZone := q.name == s.cfg.Domain || strings.HasSuffix(q.name, "."+s.cfg.Domain)
+		if inZone {
+			if id := findID(strings.Split(q.name, ".")...); id != "" {
+				qtype := dnsTypes[q.qtype]
+				if qtype == "" {
+					qtype = "TYPE" + strconv.Itoa(int(q.qtype))
+				}
+				s.record(Interaction{ID: id, Protocol: "dns", RemoteAddr: addr.String(), QName: q.name, QType: qtype})
+			}
+		}
+		s.dnsConn.WriteTo(s.dnsReply(msg, q, inZone), addr)
+	}
+}
+
+// dnsReply responde com autoridade: registros A da zona apontam para o host
+// público; nomes fora da zona recebem NXDOMAIN.
+func (s *Server) dnsReply(msg []byte, q dnsQuestion, inZone bool) []byte {
+	out := make([]byte, q.end, q.end+16)
+	copy(out, msg[:q.end])
+	flags := uint16(0x8400) | binary.BigEndian.Uint16(msg[2:4])&0x0100
+	if !inZone {
+		flags |= 3
+	}
+	binary.BigEndian.PutUint16(out[2:4], flags)
+	binary.BigEndian.PutUint16(out[4:6], 1)
+	binary.BigEndian.PutUint16(out[6:8], 0)
+	binary.BigEndian.PutUint16(out[8:10], 0)
+	binary.BigEndian.PutUint16(out[10:12], 0)
+
+	if inZone && (q.qtype == 1 || q.qtype == 255) && q.class == 1 {
+		binary.BigEndian.PutUint16(out[6:8], 1)
+		out = append(out, 0xC0, 0x0C, 0, 1, 0, 1, 0, 0, 0, 0, 0, 4)
+		out = append(out, s.ip...)
+	}
+	return out
+}
@@ -0,0 +1,269 @@
+// Package oob implementa um servidor local de interações fora de banda (DNS e
+// HTTP). Payloads recebem identificadores de correlação únicos; qualquer consulta
+// DNS ou requisição HTTP que contenha um deles é registrada e pode ser
+// consultada pela API de polling.
+package oob
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IDLength é o tamanho dos identificadores de correlação.
+const IDLength = 20
+
+// APIPrefix é o prefixo das rotas da API; requisições a ele não são interações.
+const APIPrefix = "/_reconsec/"
+
+const (
+	maxPerID      = 100
+	maxIDs        = 10000
+	maxRawRequest = 8192
+	idAlphabet    = "abcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+var idRe = regexp.MustCompile(`^[a-z0-9]{20}$`)
+
+// NewID gera um identificador de correlação aleatório.
+func NewID() string {
+	b := make([]byte, IDLength)
+	max := big.NewInt(int64(len(idAlphabet)))
+	for i := range b {
+		v, _ := rand.Int(rand.Reader, max)
+		b[i] = idAlphabet[v.Int64()]
+	}
+	return string(b)
+}
+
+// Interaction é um contato recebido pelo servidor.
+type Interaction struct {
+	ID         string    `json:"id"`
+	Protocol   string    `json:"protocol"`
+	RemoteAddr string    `json:"remote_addr"`
+	Time       time.Time `json:"time"`
+	QName      string    `json:"qname,omitempty"`
+	QType      string    `json:"qtype,omitempty"`
+	Request    string    `json:"request,omitempty"`
+}
+
+// Info descreve como montar os endereços de callback de um servidor.
+type Info struct {
+	Domain  string `json:"domain"`
+	HTTPURL string `json:"http_url"`
+	DNSAddr string `json:"dns_addr,omitempty"`
+}
+
+// Config configura o servidor. Portas 0 escolhem uma porta livre; DNSPort
+// negativo desativa o DNS.
+type Config struct {
+	ListenHost string
+	HTTPPort   int
+	DNSPort    int
+	Domain     string
+
+	// PublicHost é o endereço anunciado nas URLs e nas respostas A (padrão: ListenHost).
+	PublicHost string
+
+	// Token, se definido, é exigido (Authorization: Bearer) na API de polling.
+	Token string
+
+	// OnInteraction, se definido, é chamado a cada interação registrada.
+	OnInteraction func(Interaction)
+}
+
+// Server é o servidor de interações.
+type Server struct {
+	cfg Config
+
+	mu           sync.Mutex
+	interactions map[string][]Interaction
+	order        []string
+
+	httpLn  net.Listener
+	httpSrv *http.Server
+	dnsConn net.PacketConn
+	ip      net.IP
+}
+
+// NewServer cria um servidor com os padrões aplicados; Start abre os listeners.
+func NewServer(cfg Config) *Server {
+	if cfg.ListenHost == "" {
+		cfg.ListenHost = "127.0.0.1"
+	}
+	if cfg.PublicHost == "" {
+		cfg.PublicHost = cfg.ListenHost
+	}
+	if cfg.Domain == "" {
+		cfg.Domain = "oob.local"
+	}
+	cfg.Domain = strings.ToLower(strings.Trim(cfg.Domain, "."))
+	return &Server{cfg: cfg, interactions: map[string][]Interaction{}}
+}
+
+// Start abre os listeners HTTP e DNS e começa a atender em segundo plano.
+func (s *Server) Start() error {
+	s.ip = net.ParseIP(s.cfg.PublicHost).To4()
+	if s.ip == nil {
+		s.ip = net.IPv4(127, 0, 0, 1).To4()
+	}
+
+	ln, err := net.Listen("tcp", net.JoinHostPort(s.cfg.ListenHost, strconv.Itoa(s.cfg.HTTPPort)))
+	if err != nil {
+		return fmt.Errorf("oob http listener: %w", err)
+	}
+	s.httpLn = ln
+	s.httpSrv = &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	go s.httpSrv.Serve(ln)
+
+	if s.cfg.DNSPort >= 0 {
+		conn, err := net.ListenPacket("udp", net.JoinHostPort(s.cfg.ListenHost, strconv.Itoa(s.cfg.DNSPort)))
+		if err != nil {
+			ln.Close()
+			return fmt.Errorf("oob dns listener: %w", err)
+		}
+		s.dnsConn = conn
+		go s.serveDNS()
+	}
+	return nil
+}
+
+// Close encerra os listeners.
+func (s *Server) Close() error {
+	if s.dnsConn != nil {
+		s.dnsConn.Close()
+	}
+	if s.httpSrv != nil {
+		return s.httpSrv.Close()
+	}
+	return nil
+}
+
+// Info devolve o domínio e os endereços efetivos do servidor.
+func (s *Server) Info() Info {
+	info := Info{Domain: s.cfg.Domain}
+	if s.httpLn != nil {
+		_, port, _ := net.SplitHostPort(s.httpLn.Addr().String())
+		info.HTTPURL = "http://" + net.JoinHostPort(s.cfg.PublicHost, port)
+	}
+	if s.dnsConn != nil {
+		info.DNSAddr = s.dnsConn.LocalAddr().String()
+	}
+	return info
+}
+
+// Interactions devolve as interações dos ids pedidos, ou todas se nenhum for informado.
+func (s *Server) Interactions(ids ...string) []Interaction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(ids) == 0 {
+		ids = s.order
+	}
+	out := []Interaction{}
+	for _, id := range ids {
+		out = append(out, s.interactions[id]...)
+	}
+	return out
+}
+
+func (s *Server) record(in Interaction) {
+	in.Time = time.Now().UTC()
+	s.mu.Lock()
+	list, known := s.interactions[in.ID]
+	if !known && len(s.order) >= maxIDs {
+		oldest := s.order[0]
+		s.order = s.order[1:]
+		delete(s.interactions, oldest)
+	}
+	if !known {
+		s.order = append(s.order, in.ID)
+	}
+	if len(list) < maxPerID {
+		s.interactions[in.ID] = append(list, in)
+	}
+	s.mu.Unlock()
+
+	if s.cfg.OnInteraction != nil {
+		s.cfg.OnInteraction(in)
+	}
+}
+
+// findID procura um identificador nos rótulos de um nome de host ou nos segmentos de um caminho.
+func findID(parts ...string) string {
+	for _, p := range parts {
+		if idRe.MatchString(p) {
+			return p
+		}
+	}
+	return ""
+}
+
+// ServeHTTP atende a API de polling e registra qualquer outra requisição que
+// traga um identificador no host ou no caminho.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, APIPrefix) {
+		s.serveAPI(w, r)
+		return
+	}
+
+	host := strings.ToLower(r.Host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	id := findID(append(strings.Split(host, "."), strings.Split(r.URL.Path, "/")...)...)
+	if id != "" {
+		raw, _ := httputil.DumpRequest(r, true)
+		if len(raw) > maxRawRequest {
+			raw = raw[:maxRawRequest]
+		}
+		s.record(Interaction{ID: id, Protocol: "http", RemoteAddr: r.RemoteAddr, Request: string(raw)})
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintln(w, "ok")
+}
+
+type pollRequest struct {
+	IDs []string `json:"ids"`
+}
+
+type pollResponse struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+func (s *Server) serveAPI(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.Token != "" && r.Header.Get("Authorization") != "Bearer "+s.cfg.Token {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var v interface{}
+	switch strings.TrimPrefix(r.URL.Path, APIPrefix) {
+	case "info":
+		v = s.Info()
+	case "poll":
+		var req pollRequest
+		if r.Method == http.MethodPost {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "invalid poll request: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		} else {
+			req.IDs = r.URL.Query()["id"]
+		}
+		v = pollResponse{Interactions: s.Interactions(req.IDs...)}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,73 @@
+package oob
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func dnsQuery(name string) []byte {
+	msg := []byte{0x12, 0x34, 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0}
+	for _, l := range strings.Split(name, ".") {
+		msg = append(msg, byte(len(l)))
+		msg = append(msg, l...)
+	}
+	return append(msg, 0, 0, 1, 0, 1)
+}
+
+func TestServerRecordsInteractions(t *testing.T) {
+	srv := NewServer(Config{Domain: "oob.test", Token: "secret"})
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	ctx := context.Background()
+	if _, err := NewClient(ctx, srv.Info().HTTPURL, "wrong"); err == nil {
+		t.Fatal("poll API must require the token")
+	}
+	c, err := NewClient(ctx, srv.Info().HTTPURL, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, other := NewID(), NewID()
+
+	conn, err := net.Dial("udp", srv.Info().DNSAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write(dnsQuery(c.Host(id)))
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	reply := make([]byte, 512)
+	n, err := conn.Read(reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if binary.BigEndian.Uint16(reply[6:8]) != 1 || !net.IP(reply[n-4:n]).Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Fatalf("unexpected DNS answer % x", reply[:n])
+	}
+
+	resp, err := http.Get(c.URL(id) + "?x=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	http.Get(c.URL(other))
+
+	got, err := c.Poll(ctx, []string{id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Protocol != "dns" || got[0].QName != id+".oob.test" || got[0].QType != "A" ||
+		got[1].Protocol != "http" || !strings.HasPrefix(got[1].Request, "GET /"+id+"?x=1") {
+		t.Fatalf("unexpected interactions %+v", got)
+	}
+	if all, _ := c.Poll(ctx, nil); len(all) != 3 {
+		t.Fatalf("expected 3 interactions in total, got %d", len(all))
+	}
+}
@@ -0,0 +1,176 @@
+package poc
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghostn3xus/reconsec/pkg/report"
+	"github.com/ghostn3xus/reconsec/pkg/utils"
+)
+
+// BatchOptions configura a sonda de uma lista de alvos. Options é o modelo
+// aplicado a cada URL (URL e Request são ignorados).
+type BatchOptions struct {
+	Options PoCOptions
+	Probes  []string
+
+	// Concurrency é o número de URLs sondadas ao mesmo tempo.
+	Concurrency int
+
+	// Rate limita as requisições por segundo de cada host e GlobalRate a soma
+	// de todos os hosts (0 = sem limite).
+	Rate       float64
+	GlobalRate float64
+}
+
+// BatchResult é o resultado de uma URL, emitido assim que a sonda termina.
+type BatchResult struct {
+	Target   string           `json:"target"`
+	Findings []report.Finding `json:"findings"`
+	Error    string           `json:"error,omitempty"`
+	Time     time.Time        `json:"time"`
+}
+
+// BatchStats resume um lote.
+type BatchStats struct {
+	Probed     int `json:"probed"`
+	Duplicates int `json:"duplicates"`
+	Invalid    int `json:"invalid"`
+	Errors     int `json:"errors"`
+}
+
+// targetFromLine extrai a URL de uma linha de entrada: o primeiro campo que
+// começa com http:// ou https://. Isso aceita listas simples, a saída de outras
+// ferramentas (ex.: "https://alvo [200]") e as linhas "REQ GET <url> HTTP/1.1"
+// do log do proxy. Linhas vazias e comentários (#) são ignorados.
+func targetFromLine(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", false
+	}
+	for _, f := range strings.Fields(line) {
+		lower := strings.ToLower(f)
+		if strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") {
+			return f, true
+		}
+	}
+	return "", false
+}
+
+// dedupKey identifica URLs com o mesmo caminho e o mesmo conjunto de
+// parâmetros: só os nomes contam, não os valores nem a ordem.
+func dedupKey(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("absolute URL required: %s", raw)
+	}
+	var names []string
+	seen := map[string]bool{}
+	for name := range u.Query() {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return strings.ToLower(u.Scheme+"://"+u.Host) + u.EscapedPath() + "?" + strings.Join(names, "&"), nil
+}
+
+// Batch lê alvos de r (uma URL por linha, ver targetFromLine), descarta os que
+// repetem caminho e parâmetros de um já visto e sonda os demais com um pool de
+// workers que compartilham os limites de taxa. Cada resultado é passado a emit
+// assim que fica pronto; emit nunca é chamado em paralelo. Com ctx cancelado,
+// as URLs ainda não iniciadas são descartadas.
+func Batch(ctx context.Context, opts BatchOptions, r io.Reader, emit func(BatchResult)) (BatchStats, error) {
+	var stats BatchStats
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	if len(opts.Probes) == 0 {
+		opts.Probes = []string{"reflection"}
+	}
+	for _, n := range opts.Probes {
+		if Probes[n] == nil {
+			return stats, fmt.Errorf("unknown probe %q", n)
+		}
+	}
+
+	limiter := utils.NewHostLimiter(opts.Rate, opts.GlobalRate, 1)
+	targets := make(chan string)
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for target := range targets {
+				opt := opts.Options
+				opt.URL, opt.Request = target, nil
+				opt.Limiter, opt.ctx = limiter, ctx
+				findings, err := Run(opt, opts.Probes...)
+
+				res := BatchResult{Target: target, Findings: findings, Time: time.Now()}
+				if res.Findings == nil {
+					res.Findings = []report.Finding{}
+				}
+				mu.Lock()
+				stats.Probed++
+				if err != nil {
+					res.Error = err.Error()
+					stats.Errors++
+				}
+				emit(res)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	seen := map[string]bool{}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	var err error
+feed:
+	for sc.Scan() {
+		target, ok := targetFromLine(sc.Text())
+		if !ok {
+			continue
+		}
+		key, kerr := dedupKey(target)
+		if kerr != nil || seen[key] {
+			mu.Lock()
+			if kerr != nil {
+				stats.Invalid++
+			} else {
+				stats.Duplicates++
+			}
+			mu.Unlock()
+			continue
+		}
+		seen[key] = true
+
+		select {
+		case targets <- target:
+		case <-ctx.Done():
+			err = ctx.Err()
+			break feed
+		}
+	}
+	close(targets)
+	wg.Wait()
+	if err == nil {
+		err = sc.Err()
+	}
+	return stats, err
+}
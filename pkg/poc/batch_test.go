@@ -0,0 +1,96 @@
+package poc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestTargetFromLine(t *testing.T) {
+	cases := map[string]string{
+		"https://t/a?x=1":                 "https://t/a?x=1",
+		"  http://t/b  ":                  "http://t/b",
+		"REQ GET http://t/c?q=1 HTTP/1.1": "http://t/c?q=1",
+		"http://t/d [200] [text/html]":    "http://t/d",
+		"# http://t/comentario":           "",
+		"":                                "",
+		"t/sem-esquema":                   "",
+		"2024/01/01 RESP 200 OK for https://t/e?z=": "https://t/e?z=",
+	}
+	for line, want := range cases {
+		got, ok := targetFromLine(line)
+		if got != want || ok != (want != "") {
+			t.Errorf("targetFromLine(%q) = %q, %t; want %q", line, got, ok, want)
+		}
+	}
+}
+
+func TestDedupKey(t *testing.T) {
+	a, _ := dedupKey("https://T.example/p?a=1&b=2")
+	b, _ := dedupKey("https://t.example/p?b=9&a=3&a=4")
+	c, _ := dedupKey("https://t.example/p?a=1")
+	d, _ := dedupKey("https://t.example/P?a=1&b=2")
+	if a != b {
+		t.Errorf("same path and parameter names must share a key: %q vs %q", a, b)
+	}
+	if a == c || a == d {
+		t.Errorf("different parameters or paths must not share a key: %q %q %q", a, c, d)
+	}
+	if _, err := dedupKey("/relative?a=1"); err == nil {
+		t.Error("expected an error for a URL without host")
+	}
+}
+
+func TestBatch(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/echo" {
+			w.Write([]byte("<p>" + r.URL.Query().Get("q") + "</p>"))
+			return
+		}
+		w.Write([]byte("<p>static</p>"))
+	}))
+	defer srv.Close()
+
+	input := strings.Join([]string{
+		"# alvos",
+		srv.URL + "/echo?q=1",
+		srv.URL + "/echo?q=2",
+		"REQ GET " + srv.URL + "/static?id=1 HTTP/1.1",
+		"http://%zz/invalid",
+		"",
+	}, "\n")
+
+	results := map[string]BatchResult{}
+	stats, err := Batch(context.Background(), BatchOptions{Concurrency: 4, Rate: 100}, strings.NewReader(input), func(res BatchResult) {
+		results[res.Target] = res
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Probed != 2 || stats.Duplicates != 1 || stats.Invalid != 1 || stats.Errors != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	echo, ok := results[srv.URL+"/echo?q=1"]
+	if !ok || len(echo.Findings) == 0 || echo.Findings[0].Type != "ReflectedInput" {
+		t.Fatalf("expected a reflection on /echo, got %+v", echo)
+	}
+	static, ok := results[srv.URL+"/static?id=1"]
+	if !ok || static.Findings == nil || len(static.Findings) != 0 {
+		t.Fatalf("expected an empty result for /static, got %+v", static)
+	}
+}
+
+func TestBatchUnknownProbe(t *testing.T) {
+	_, err := Batch(context.Background(), BatchOptions{Probes: []string{"nope"}}, strings.NewReader("http://t/"), func(BatchResult) {
+		t.Error("nothing must be probed")
+	})
+	if err == nil {
+		t.Fatal("expected an error for an unknown probe")
+	}
+}
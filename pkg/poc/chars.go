@@ -0,0 +1,210 @@
+package poc
+
+import (
+	"html"
+	"strings"
+
+	"github.com/ghostn3xus/reconsec/pkg/active"
+	"github.com/ghostn3xus/reconsec/pkg/report"
+)
+
+// survivalChars são os caracteres testados em cada reflexão, um por sonda.
+var survivalChars = []string{"<", ">", `"`, "'", "`", `\`, "/", "(", ")", ";", "{", "}", "\n"}
+
+// Como um caractere voltou na reflexão.
+const (
+	CharRaw      = "raw"
+	CharEncoded  = "encoded"
+	CharStripped = "stripped"
+	CharBlocked  = "blocked" // a reflexão inteira sumiu (validação ou WAF)
+)
+
+// Graus de explorabilidade de uma reflexão.
+const (
+	ExploitLikely   = "likely"
+	ExploitPartial  = "partial"
+	ExploitUnlikely = "unlikely"
+)
+
+// canaryMaxGap limita a distância entre os marcadores de um canário na resposta.
+const canaryMaxGap = 32
+
+// canary envolve o caractere em marcadores derivados do token: o de abertura
+// começa com o token e o de fechamento não é confundido com ele.
+func canary(token, ch string) (string, string, string) {
+	start, end := token+"L", "R"+token
+	return start + ch + end, start, end
+}
+
+// probeChars envia uma sonda por caractere no local e devolve a matriz de cada
+// ocorrência pedida; occurrences são índices entre as ocorrências do token na
+// resposta original, na mesma ordem em que os marcadores voltam. Caracteres
+// cujo envio falha (ex.: quebra de linha em cabeçalhos) ficam fora da matriz.
+func (p *prober) probeChars(loc active.InjectionPoint, token string, occurrences []int) [][]report.CharSurvival {
+	out := make([][]report.CharSurvival, len(occurrences))
+	for _, ch := range survivalChars {
+		value, start, end := canary(token, ch)
+		req, err := loc.Apply(p.base, value)
+		if err != nil {
+			continue
+		}
+		ex := p.send(req)
+		if ex == nil {
+			continue
+		}
+		returned := canaryReturns(string(ex.Body), start, end)
+		for i, n := range occurrences {
+			r := report.CharSurvival{Char: ch, State: CharBlocked}
+			if n < len(returned) {
+				r.Returned = returned[n]
+				r.State = charState(ch, returned[n])
+			}
+			out[i] = append(out[i], r)
+		}
+	}
+	return out
+}
+
+// canaryReturns devolve, para cada marcador de abertura no corpo, o que voltou
+// no lugar do caractere. Sem o marcador de fechamento por perto, o texto seguinte
+// é devolvido com o tamanho máximo.
+func canaryReturns(body, start, end string) []string {
+	var out []string
+	for i := 0; ; {
+		k := strings.Index(body[i:], start)
+		if k < 0 {
+			return out
+		}
+		from := i + k + len(start)
+		limit := from + canaryMaxGap + len(end)
+		if limit > len(body) {
+			limit = len(body)
+		}
+		if e := strings.Index(body[from:limit], end); e >= 0 {
+			out = append(out, body[from:from+e])
+			i = from + e + len(end)
+			continue
+		}
+		out = append(out, body[from:limit])
+		i = from
+	}
+}
+
+func charState(ch, returned string) string {
+	switch returned {
+	case ch:
+		return CharRaw
+	case "":
+		return CharStripped
+	}
+	return CharEncoded
+}
+
+// charSet é uma alternativa de caracteres que, se todos sobreviverem, permite
+// sair do contexto e executar código. decoded indica que eles são lidos depois
+// da decodificação de entidades HTML (código de manipuladores de evento).
+type charSet struct {
+	chars   []string
+	decoded bool
+}
+
+// requiredChars lista as alternativas de caracteres de cada contexto.
+func requiredChars(c report.ReflectionContext) []charSet {
+	jsCode := []charSet{{chars: []string{"(", ")"}}, {chars: []string{"`"}}}
+	closeTag := charSet{chars: []string{"<", "/", ">"}}
+	breakout := []charSet{{chars: []string{c.Quote}}}
+	if c.Quote == "" {
+		breakout = []charSet{{chars: []string{">"}}, {chars: []string{"\n"}}}
+	}
+
+	switch c.Kind {
+	case ContextText, ContextComment:
+		return []charSet{{chars: []string{"<", ">"}}}
+	case ContextRawText, ContextScriptData:
+		return []charSet{closeTag}
+	case ContextTagName, ContextAttrName:
+		return jsCode
+	case ContextAttrValue:
+		return breakout
+	case ContextURL:
+		if c.URLStart {
+			return append(breakout, charSet{chars: []string{"(", ")"}, decoded: true})
+		}
+		return breakout
+	case ContextCSS:
+		if c.Attribute != "" {
+			return breakout
+		}
+		return []charSet{closeTag}
+	case ContextEventHandler:
+		var js []charSet
+		switch {
+		case c.JSQuote != "":
+			js = []charSet{{chars: []string{c.JSQuote}}}
+		case c.JSComment:
+			js = []charSet{{chars: []string{"\n"}}}
+		default:
+			js = jsCode
+		}
+		for _, set := range js {
+			set.decoded = true
+			breakout = append(breakout, set)
+		}
+		return breakout
+	case ContextScript:
+		switch {
+		case c.JSQuote != "":
+			return []charSet{{chars: []string{c.JSQuote}}, closeTag}
+		case c.JSComment:
+			return []charSet{{chars: []string{"\n"}}, closeTag}
+		}
+		return append(jsCode, closeTag)
+	}
+	return nil
+}
+
+// survives informa se o caractere chega ao interpretador sem codificação.
+// Com decoded, um caractere que voltou como entidade HTML também vale.
+func survives(r report.CharSurvival, decoded bool) bool {
+	if r.State == CharRaw {
+		return true
+	}
+	return decoded && r.State == CharEncoded && html.UnescapeString(r.Returned) == r.Char
+}
+
+// gradeExploitability classifica a reflexão pela matriz de caracteres:
+// likely se alguma alternativa de requiredChars sobrevive inteira, partial se
+// parte dela sobrevive e unlikely se nenhum caractere necessário sobrevive.
+func gradeExploitability(c report.ReflectionContext, chars []report.CharSurvival) string {
+	byChar := map[string]report.CharSurvival{}
+	for _, r := range chars {
+		byChar[r.Char] = r
+	}
+	grade := ExploitUnlikely
+	for _, set := range requiredChars(c) {
+		ok := 0
+		for _, ch := range set.chars {
+			if r, tested := byChar[ch]; tested && survives(r, set.decoded) {
+				ok++
+			}
+		}
+		switch {
+		case ok == len(set.chars):
+			return ExploitLikely
+		case ok > 0:
+			grade = ExploitPartial
+		}
+	}
+	return grade
+}
+
+// gradeSeverity ajusta a severidade e a confiança do contexto pela explorabilidade.
+func gradeSeverity(c report.ReflectionContext, grade string) (report.Severity, report.Confidence) {
+	switch grade {
+	case ExploitLikely:
+		return report.SeverityHigh, report.ConfidenceHigh
+	case ExploitUnlikely:
+		return report.SeverityLow, report.ConfidenceLow
+	}
+	return contextSeverity(c), report.ConfidenceMedium
+}
@@ -0,0 +1,380 @@
+package poc
+
+import (
+	"html"
+	"strings"
+
+	"github.com/ghostn3xus/reconsec/pkg/report"
+)
+
+// Contextos em que um token refletido pode aparecer no HTML.
+const (
+	ContextText         = "html_text"
+	ContextRawText      = "raw_text"
+	ContextComment      = "html_comment"
+	ContextTagName      = "tag_name"
+	ContextAttrName     = "attribute_name"
+	ContextAttrValue    = "attribute_value"
+	ContextEventHandler = "event_handler"
+	ContextURL          = "url"
+	ContextCSS          = "css"
+	ContextScript       = "script"
+	ContextScriptData   = "script_data"
+)
+
+// rawTextTags têm conteúdo que não é interpretado como marcação até a tag de fechamento.
+var rawTextTags = map[string]bool{
+	"script": true, "style": true, "textarea": true, "title": true,
+	"xmp": true, "iframe": true, "noembed": true, "noframes": true, "noscript": true, "plaintext": true,
+}
+
+// urlAttributes recebem URLs; um token no início do valor controla o esquema.
+var urlAttributes = map[string]bool{
+	"href": true, "src": true, "action": true, "formaction": true, "data": true, "poster": true,
+	"background": true, "cite": true, "codebase": true, "longdesc": true, "manifest": true,
+	"ping": true, "srcset": true, "xlink:href": true,
+}
+
+// jsScriptTypes são os valores de type em que o conteúdo de <script> é executado.
+var jsScriptTypes = map[string]bool{
+	"": true, "module": true, "text/javascript": true, "application/javascript": true,
+	"text/ecmascript": true, "application/ecmascript": true, "text/jscript": true,
+	"application/x-javascript": true, "text/x-javascript": true,
+}
+
+// analyzeReflectionContext percorre o HTML como um tokenizador e devolve o
+// contexto exato de cada ocorrência do token, na ordem em que aparecem.
+func analyzeReflectionContext(body, token string) []report.ReflectionContext {
+	if token == "" || !strings.Contains(body, token) {
+		return nil
+	}
+	a := &contextAnalyzer{body: body, token: token}
+	a.run()
+	return a.found
+}
+
+type contextAnalyzer struct {
+	body  string
+	token string
+	found []report.ReflectionContext
+}
+
+// mark registra as ocorrências do token em body[from:to] com o contexto de fn.
+func (a *contextAnalyzer) mark(from, to int, fn func(at int) report.ReflectionContext) {
+	for i := from; i < to; {
+		k := strings.Index(a.body[i:to], a.token)
+		if k < 0 {
+			return
+		}
+		c := fn(i + k)
+		c.Offset = i + k
+		a.found = append(a.found, c)
+		i += k + len(a.token)
+	}
+}
+
+func (a *contextAnalyzer) simple(kind string) func(int) report.ReflectionContext {
+	return func(int) report.ReflectionContext { return report.ReflectionContext{Kind: kind} }
+}
+
+func (a *contextAnalyzer) run() {
+	b := a.body
+	i := 0
+	for i < len(b) {
+		lt := strings.IndexByte(b[i:], '<')
+		if lt < 0 {
+			a.mark(i, len(b), a.simple(ContextText))
+			return
+		}
+		lt += i
+		a.mark(i, lt, a.simple(ContextText))
+		i = a.markup(lt)
+	}
+}
+
+// markup trata a marcação que começa em b[lt] ('<') e devolve onde o texto recomeça.
+func (a *contextAnalyzer) markup(lt int) int {
+	b := a.body
+	rest := b[lt:]
+	switch {
+	case strings.HasPrefix(rest, "<!--"):
+		end := strings.Index(b[lt+4:], "-->")
+		if end < 0 {
+			a.mark(lt, len(b), a.simple(ContextComment))
+			return len(b)
+		}
+		end += lt + 4
+		a.mark(lt, end, a.simple(ContextComment))
+		return end + 3
+	case strings.HasPrefix(rest, "<!") || strings.HasPrefix(rest, "<?"):
+		return a.bogusComment(lt)
+	case strings.HasPrefix(rest, "</"):
+		if len(rest) > 2 && isLetter(rest[2]) {
+			gt := closeOf(b, lt)
+			a.mark(lt, gt, func(int) report.ReflectionContext {
+				return report.ReflectionContext{Kind: ContextTagName}
+			})
+			return gt + 1
+		}
+		return a.bogusComment(lt)
+	case len(rest) > 1 && isLetter(rest[1]):
+		return a.startTag(lt)
+	}
+	// Um '<' solto é só texto.
+	return lt + 1
+}
+
+func (a *contextAnalyzer) bogusComment(lt int) int {
+	gt := closeOf(a.body, lt)
+	a.mark(lt, gt, a.simple(ContextComment))
+	return gt + 1
+}
+
+// closeOf devolve a posição do próximo '>' a partir de lt, ou o fim do corpo.
+func closeOf(b string, lt int) int {
+	if gt := strings.IndexByte(b[lt:], '>'); gt >= 0 {
+		return lt + gt
+	}
+	return len(b)
+}
+
+func (a *contextAnalyzer) startTag(lt int) int {
+	b := a.body
+	i := lt + 1
+	start := i
+	for i < len(b) && !isSpace(b[i]) && b[i] != '/' && b[i] != '>' {
+		i++
+	}
+	tag := strings.ToLower(b[start:i])
+	a.mark(start, i, func(int) report.ReflectionContext {
+		return report.ReflectionContext{Kind: ContextTagName, Tag: tag}
+	})
+
+	scriptType := ""
+	for i < len(b) && b[i] != '>' {
+		if isSpace(b[i]) || b[i] == '/' {
+			i++
+			continue
+		}
+		nameStart := i
+		for i < len(b) && !isSpace(b[i]) && b[i] != '/' && b[i] != '>' && (b[i] != '=' || i == nameStart) {
+			i++
+		}
+		name := strings.ToLower(b[nameStart:i])
+		a.mark(nameStart, i, func(int) report.ReflectionContext {
+			return report.ReflectionContext{Kind: ContextAttrName, Tag: tag}
+		})
+
+		j := i
+		for j < len(b) && isSpace(b[j]) {
+			j++
+		}
+		if j >= len(b) || b[j] != '=' {
+			continue
+		}
+		j++
+		for j < len(b) && isSpace(b[j]) {
+			j++
+		}
+		if j >= len(b) {
+			i = j
+			break
+		}
+
+		quote := ""
+		valStart, valEnd := j, j
+		if b[j] == '"' || b[j] == '\'' {
+			quote = b[j : j+1]
+			valStart = j + 1
+			end := strings.IndexByte(b[valStart:], b[j])
+			if end < 0 {
+				valEnd = len(b)
+			} else {
+				valEnd = valStart + end
+			}
+			i = valEnd + 1
+		} else {
+			for valEnd < len(b) && !isSpace(b[valEnd]) && b[valEnd] != '>' {
+				valEnd++
+			}
+			i = valEnd
+		}
+		value := b[valStart:valEnd]
+		if name == "type" && tag == "script" {
+			scriptType = strings.ToLower(strings.TrimSpace(html.UnescapeString(value)))
+		}
+		a.mark(valStart, valEnd, func(at int) report.ReflectionContext {
+			return attributeContext(tag, name, quote, value, at-valStart)
+		})
+	}
+	if i >= len(b) {
+		return len(b)
+	}
+	i++ // '>'
+
+	if !rawTextTags[tag] {
+		return i
+	}
+	end := indexFold(b[i:], "</"+tag)
+	if end < 0 {
+		end = len(b)
+	} else {
+		end += i
+	}
+	switch tag {
+	case "script":
+		kind := ContextScript
+		if !jsScriptTypes[scriptType] {
+			kind = ContextScriptData
+		}
+		content := b[i:end]
+		a.mark(i, end, func(at int) report.ReflectionContext {
+			c := report.ReflectionContext{Kind: kind, Tag: tag, ScriptType: scriptType}
+			c.JSQuote, c.JSComment = jsContext(content[:at-i])
+			return c
+		})
+	case "style":
+		a.mark(i, end, func(int) report.ReflectionContext {
+			return report.ReflectionContext{Kind: ContextCSS, Tag: tag}
+		})
+	default:
+		a.mark(i, end, func(int) report.ReflectionContext {
+			return report.ReflectionContext{Kind: ContextRawText, Tag: tag}
+		})
+	}
+	return end
+}
+
+// attributeContext classifica uma ocorrência no valor de um atributo; at é a
+// posição da ocorrência dentro do valor bruto.
+func attributeContext(tag, name, quote, value string, at int) report.ReflectionContext {
+	c := report.ReflectionContext{Kind: ContextAttrValue, Tag: tag, Attribute: name, Quote: quote}
+	switch {
+	case strings.HasPrefix(name, "on"):
+		c.Kind = ContextEventHandler
+		// O navegador decodifica as entidades antes de executar o código.
+		c.JSQuote, c.JSComment = jsContext(html.UnescapeString(value[:at]))
+	case name == "style":
+		c.Kind = ContextCSS
+	case urlAttributes[name]:
+		c.Kind = ContextURL
+		c.URLStart = strings.TrimSpace(html.UnescapeString(value[:at])) == ""
+	}
+	return c
+}
+
+// jsContext percorre o código JavaScript até o fim de prefix e informa se ele
+// termina dentro de uma string (e com qual delimitador) ou de um comentário.
+func jsContext(prefix string) (string, bool) {
+	var quote byte
+	lineComment, blockComment := false, false
+	for i := 0; i < len(prefix); i++ {
+		c := prefix[i]
+		switch {
+		case lineComment:
+			if c == '\n' {
+				lineComment = false
+			}
+		case blockComment:
+			if c == '*' && i+1 < len(prefix) && prefix[i+1] == '/' {
+				blockComment = false
+				i++
+			}
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote || (c == '\n' && quote != '`') {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '/' && i+1 < len(prefix) && prefix[i+1] == '/':
+			lineComment = true
+			i++
+		case c == '/' && i+1 < len(prefix) && prefix[i+1] == '*':
+			blockComment = true
+			i++
+		}
+	}
+	if quote != 0 {
+		return string(quote), false
+	}
+	return "", lineComment || blockComment
+}
+
+// contextSeverity atribui a severidade de uma reflexão conforme o contexto:
+// quanto menos caracteres são necessários para executar código, mais alta.
+func contextSeverity(c report.ReflectionContext) report.Severity {
+	switch c.Kind {
+	case ContextScript:
+		if c.JSComment {
+			return report.SeverityMedium
+		}
+		return report.SeverityHigh
+	case ContextEventHandler, ContextTagName, ContextAttrName:
+		return report.SeverityHigh
+	case ContextURL:
+		if c.URLStart {
+			return report.SeverityHigh
+		}
+		return report.SeverityMedium
+	case ContextAttrValue, ContextCSS, ContextScriptData:
+		return report.SeverityMedium
+	}
+	return report.SeverityLow
+}
+
+// describeContext resume o contexto em uma linha, para as notas do achado.
+func describeContext(c report.ReflectionContext) string {
+	var sb strings.Builder
+	sb.WriteString(c.Kind)
+	if c.Tag != "" {
+		sb.WriteString(" <" + c.Tag)
+		if c.Attribute != "" {
+			sb.WriteString(" " + c.Attribute)
+		}
+		sb.WriteString(">")
+	}
+	if c.Attribute != "" {
+		switch c.Quote {
+		case "":
+			sb.WriteString(" unquoted")
+		case `"`:
+			sb.WriteString(" double-quoted")
+		default:
+			sb.WriteString(" single-quoted")
+		}
+	}
+	if c.ScriptType != "" {
+		sb.WriteString(" type=" + c.ScriptType)
+	}
+	if c.JSQuote != "" {
+		sb.WriteString(" in js string " + c.JSQuote)
+	}
+	if c.JSComment {
+		sb.WriteString(" in js comment")
+	}
+	if c.URLStart {
+		sb.WriteString(" at url start")
+	}
+	return sb.String()
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// indexFold é strings.Index sem diferenciar maiúsculas de minúsculas (ASCII).
+func indexFold(s, substr string) int {
+	n := len(substr)
+	for i := 0; i+n <= len(s); i++ {
+		if strings.EqualFold(s[i:i+n], substr) {
+			return i
+		}
+	}
+	return -1
+}
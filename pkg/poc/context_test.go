@@ -0,0 +1,65 @@
+package poc
+
+import (
+	"testing"
+
+	"github.com/ghostn3xus/reconsec/pkg/report"
+)
+
+func TestAnalyzeReflectionContext(t *testing.T) {
+	const tok = "TKN1__"
+	cases := []struct {
+		body string
+		want report.ReflectionContext
+		sev  report.Severity
+	}{
+		{`<p>TKN1__</p>`, report.ReflectionContext{Kind: ContextText}, report.SeverityLow},
+		{`<!-- TKN1__ -->`, report.ReflectionContext{Kind: ContextComment}, report.SeverityLow},
+		{`<title>TKN1__</title>`, report.ReflectionContext{Kind: ContextRawText, Tag: "title"}, report.SeverityLow},
+		{`<TKN1__ a=1>`, report.ReflectionContext{Kind: ContextTagName, Tag: "tkn1__"}, report.SeverityHigh},
+		{`<div TKN1__=1>`, report.ReflectionContext{Kind: ContextAttrName, Tag: "div"}, report.SeverityHigh},
+		{`<input value="x TKN1__">`, report.ReflectionContext{Kind: ContextAttrValue, Tag: "input", Attribute: "value", Quote: `"`}, report.SeverityMedium},
+		{`<input value='TKN1__'>`, report.ReflectionContext{Kind: ContextAttrValue, Tag: "input", Attribute: "value", Quote: "'"}, report.SeverityMedium},
+		{`<input value=TKN1__>`, report.ReflectionContext{Kind: ContextAttrValue, Tag: "input", Attribute: "value"}, report.SeverityMedium},
+		{`<a href="TKN1__">`, report.ReflectionContext{Kind: ContextURL, Tag: "a", Attribute: "href", Quote: `"`, URLStart: true}, report.SeverityHigh},
+		{`<a href="/x?q=TKN1__">`, report.ReflectionContext{Kind: ContextURL, Tag: "a", Attribute: "href", Quote: `"`}, report.SeverityMedium},
+		{`<b onclick="go(&#39;TKN1__')">`, report.ReflectionContext{Kind: ContextEventHandler, Tag: "b", Attribute: "onclick", Quote: `"`, JSQuote: "'"}, report.SeverityHigh},
+		{`<b style="color:TKN1__">`, report.ReflectionContext{Kind: ContextCSS, Tag: "b", Attribute: "style", Quote: `"`}, report.SeverityMedium},
+		{`<style>a{color:TKN1__}</style>`, report.ReflectionContext{Kind: ContextCSS, Tag: "style"}, report.SeverityMedium},
+		{`<script>var a = 1;</script><script type="text/javascript">var q = "TKN1__";</script>`, report.ReflectionContext{Kind: ContextScript, Tag: "script", ScriptType: "text/javascript", JSQuote: `"`}, report.SeverityHigh},
+		{"<SCRIPT>var q = `a ${b} TKN1__`;</SCRIPT>", report.ReflectionContext{Kind: ContextScript, Tag: "script", JSQuote: "`"}, report.SeverityHigh},
+		{`<script>f(1); // TKN1__</script>`, report.ReflectionContext{Kind: ContextScript, Tag: "script", JSComment: true}, report.SeverityMedium},
+		{`<script>var s = 'it\'s'; f(TKN1__)</script>`, report.ReflectionContext{Kind: ContextScript, Tag: "script"}, report.SeverityHigh},
+		{`<script type="application/json">{"q":"TKN1__"}</script>`, report.ReflectionContext{Kind: ContextScriptData, Tag: "script", ScriptType: "application/json", JSQuote: `"`}, report.SeverityMedium},
+		{`<textarea><p title="TKN1__"></textarea>`, report.ReflectionContext{Kind: ContextRawText, Tag: "textarea"}, report.SeverityLow},
+	}
+	for _, c := range cases {
+		got := analyzeReflectionContext(c.body, tok)
+		if len(got) != 1 {
+			t.Errorf("%s: expected one occurrence, got %+v", c.body, got)
+			continue
+		}
+		g := got[0]
+		g.Offset = 0
+		if g != c.want {
+			t.Errorf("%s:\n got %+v\nwant %+v", c.body, g, c.want)
+		}
+		if sev := contextSeverity(got[0]); sev != c.sev {
+			t.Errorf("%s: severity %s, want %s", c.body, sev, c.sev)
+		}
+	}
+}
+
+func TestAnalyzeReflectionContextEveryOccurrence(t *testing.T) {
+	body := `<h1>TKN1__</h1><img alt='TKN1__' src=x><script>x="TKN1__"</script>`
+	got := analyzeReflectionContext(body, "TKN1__")
+	kinds := []string{ContextText, ContextAttrValue, ContextScript}
+	if len(got) != len(kinds) {
+		t.Fatalf("expected %d occurrences, got %+v", len(kinds), got)
+	}
+	for i, k := range kinds {
+		if got[i].Kind != k || body[got[i].Offset:got[i].Offset+6] != "TKN1__" {
+			t.Errorf("occurrence %d: got %+v, want %s", i, got[i], k)
+		}
+	}
+}
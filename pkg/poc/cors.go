@@ -0,0 +1,143 @@
+package poc
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ghostn3xus/reconsec/pkg/active"
+	"github.com/ghostn3xus/reconsec/pkg/report"
+)
+
+// Problemas de CORS reportados pela sonda.
+const (
+	CORSReflectedOrigin = "reflected-origin"
+	CORSNullOrigin      = "null-origin"
+	CORSAnySubdomain    = "trust-any-subdomain"
+	CORSInsecureOrigin  = "insecure-origin"
+)
+
+// corsOrigin é uma origem forjada e o problema que ela revela se for aceita.
+type corsOrigin struct {
+	variant string
+	origin  string
+	issue   string
+}
+
+// corsOrigins monta as origens testadas para o alvo: um domínio de atacante,
+// null, domínios que começam ou terminam com o do alvo, um subdomínio e a
+// mesma origem sem TLS.
+func corsOrigins(target *url.URL) []corsOrigin {
+	host, port := target.Hostname(), target.Port()
+	if port != "" {
+		port = ":" + port
+	}
+	scheme := target.Scheme
+	origins := []corsOrigin{
+		{"attacker", "https://" + canaryDomain, CORSReflectedOrigin},
+		{"null", "null", CORSNullOrigin},
+		{"prefix", scheme + "://" + host + "." + canaryDomain + port, CORSReflectedOrigin},
+		{"suffix", scheme + "://reconsec" + host + port, CORSReflectedOrigin},
+		{"subdomain", scheme + "://reconsec." + host + port, CORSAnySubdomain},
+	}
+	if scheme == "https" {
+		origins = append(origins, corsOrigin{"http", "http://" + target.Host, CORSInsecureOrigin})
+	}
+	return origins
+}
+
+// corsSeverity depende de o alvo permitir credenciais: sem elas, a origem
+// forjada só lê o que qualquer um já poderia ler.
+func corsSeverity(issue string, credentials bool) report.Severity {
+	switch {
+	case !credentials:
+		return report.SeverityLow
+	case issue == CORSReflectedOrigin || issue == CORSNullOrigin:
+		return report.SeverityHigh
+	}
+	return report.SeverityMedium
+}
+
+// CORSProbe envia a requisição base e um preflight OPTIONS com cada origem
+// forjada e analisa Access-Control-Allow-Origin e -Allow-Credentials. Se a
+// origem de atacante é aceita, os domínios com prefixo e sufixo do alvo não
+// são reportados à parte.
+func CORSProbe(opt PoCOptions) ([]report.Finding, error) {
+	p, err := newProber(opt)
+	if err != nil {
+		return nil, err
+	}
+	target, err := url.Parse(p.base.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	findings := []report.Finding{}
+	anyOrigin := false
+	for _, o := range corsOrigins(target) {
+		if anyOrigin && (o.variant == "prefix" || o.variant == "suffix") {
+			continue
+		}
+		req, ex, kind := p.corsAccepted(o.origin)
+		if ex == nil {
+			continue
+		}
+		if o.variant == "attacker" {
+			anyOrigin = true
+		}
+
+		credentials := strings.EqualFold(strings.TrimSpace(ex.Header.Get("Access-Control-Allow-Credentials")), "true")
+		notes := fmt.Sprintf("issue=%s; variant=%s; origin=%s; request=%s; status=%d; credentials=%t",
+			o.issue, o.variant, o.origin, kind, ex.Status, credentials)
+		if kind == "preflight" {
+			notes += fmt.Sprintf("; allow_methods=%s; allow_headers=%s",
+				ex.Header.Get("Access-Control-Allow-Methods"), ex.Header.Get("Access-Control-Allow-Headers"))
+		}
+		f := newFinding("CORSMisconfiguration", "CWE-942", corsSeverity(o.issue, credentials), report.ConfidenceHigh, req, ex, notes)
+		f.Evidence.Excerpt = corsHeaders(ex.Header)
+		findings = append(findings, f)
+	}
+	return p.done(findings)
+}
+
+// corsAccepted envia a requisição base com a origem e, se ela não for aceita,
+// um preflight. Devolve a troca que aceitou a origem e o tipo da requisição,
+// ou nil se nenhuma aceitou.
+func (p *prober) corsAccepted(origin string) (active.HTTPRequest, *active.Exchange, string) {
+	req, err := active.InjectionPoint{Kind: active.InjectHeader, Name: "Origin"}.Apply(p.base, origin)
+	if err != nil {
+		return req, nil, ""
+	}
+	if ex := p.send(req); ex != nil && allowsOrigin(ex.Header, origin) {
+		return req, ex, "simple"
+	}
+
+	method := p.base.Method
+	if method == "" || method == http.MethodGet || method == http.MethodHead {
+		method = http.MethodPut
+	}
+	preflight := active.HTTPRequest{Method: http.MethodOptions, URL: p.base.URL, Header: http.Header{}}
+	preflight.Header.Set("Origin", origin)
+	preflight.Header.Set("Access-Control-Request-Method", method)
+	preflight.Header.Set("Access-Control-Request-Headers", "content-type,authorization")
+	if ex := p.send(preflight); ex != nil && allowsOrigin(ex.Header, origin) {
+		return preflight, ex, "preflight"
+	}
+	return req, nil, ""
+}
+
+func allowsOrigin(h http.Header, origin string) bool {
+	return strings.EqualFold(strings.TrimSpace(h.Get("Access-Control-Allow-Origin")), origin)
+}
+
+// corsHeaders formata os cabeçalhos Access-Control-* da resposta.
+func corsHeaders(h http.Header) string {
+	var lines []string
+	for _, k := range []string{"Access-Control-Allow-Origin", "Access-Control-Allow-Credentials", "Access-Control-Allow-Methods", "Access-Control-Allow-Headers", "Vary"} {
+		if v := h.Get(k); v != "" {
+			lines = append(lines, k+": "+v)
+		}
+	}
+	return strings.Join(lines, "\r\n")
+}
@@ -0,0 +1,60 @@
+package poc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ghostn3xus/reconsec/pkg/report"
+)
+
+func TestCORSProbe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		switch {
+		case r.Method == http.MethodOptions && origin == "null":
+			// Só o preflight aceita null.
+			w.Header().Set("Access-Control-Allow-Origin", "null")
+			w.Header().Set("Access-Control-Allow-Methods", "PUT")
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		case strings.HasSuffix(origin, r.Host):
+			// Validação ingênua: qualquer origem que termine com o host.
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+	}))
+	defer srv.Close()
+
+	findings, err := CORSProbe(PoCOptions{URL: srv.URL + "/api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]report.Finding{}
+	for _, f := range findings {
+		got[noteField(f.Notes, "issue")+"/"+noteField(f.Notes, "variant")] = f
+	}
+
+	null, ok := got["null-origin/null"]
+	if !ok || null.Severity != report.SeverityHigh || !strings.Contains(null.Notes, "request=preflight") || !strings.HasPrefix(null.Evidence.Request, "OPTIONS ") {
+		t.Errorf("expected a preflight null-origin finding with credentials, got %+v", null)
+	}
+	if f, ok := got["reflected-origin/suffix"]; !ok || f.Severity != report.SeverityLow {
+		t.Errorf("expected a low severity suffix finding without credentials, got %+v", f)
+	}
+	if f, ok := got["trust-any-subdomain/subdomain"]; !ok || !strings.Contains(f.Evidence.Excerpt, "Access-Control-Allow-Origin: http://reconsec.127.0.0.1") {
+		t.Errorf("expected a subdomain finding, got %+v", f)
+	}
+	if _, ok := got["reflected-origin/attacker"]; ok || len(got) != 3 {
+		t.Errorf("unexpected findings %v", got)
+	}
+}
+
+// noteField lê um campo "chave=valor" das notas de um achado.
+func noteField(notes, key string) string {
+	for _, part := range strings.Split(notes, "; ") {
+		if v, ok := strings.CutPrefix(part, key+"="); ok {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,131 @@
+package poc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ghostn3xus/reconsec/pkg/active"
+	"github.com/ghostn3xus/reconsec/pkg/report"
+)
+
+// crlfHeader é o cabeçalho que a sonda de CRLF tenta criar na resposta.
+const crlfHeader = "X-Reconsec-Crlf"
+
+// crlfSequences são as quebras de linha testadas: CRLF, só LF, CRLF codificado
+// duas vezes e os caracteres Unicode U+560D/U+560A, que alguns servidores
+// truncam para os bytes CR e LF.
+var crlfSequences = []string{"\r\n", "\n", "%0d%0a", "\u560d\u560a"}
+
+// hostHeaders definem o host usado em links absolutos e redirecionamentos
+// em muitas aplicações e proxies.
+var hostHeaders = []string{"Host", "X-Forwarded-Host", "X-Host", "X-Forwarded-Server", "Forwarded"}
+
+// crlfLocations lista os parâmetros de query e formulário da requisição base,
+// além de Param na query.
+func crlfLocations(req active.HTTPRequest, param string) []active.InjectionPoint {
+	if active.HasMarkers(req) {
+		return active.EnumerateInjectionPoints(req)
+	}
+	var points []active.InjectionPoint
+	hasParam := false
+	for _, p := range active.EnumerateInjectionPoints(req) {
+		if p.Kind == active.InjectQuery || p.Kind == active.InjectForm {
+			points = append(points, p)
+			hasParam = hasParam || (p.Kind == active.InjectQuery && p.Name == param)
+		}
+	}
+	if !hasParam {
+		points = append(points, active.InjectionPoint{Kind: active.InjectQuery, Name: param})
+	}
+	return points
+}
+
+// CRLFProbe envia uma quebra de linha seguida de um cabeçalho marcador a cada
+// parâmetro e procura o marcador nos cabeçalhos da resposta.
+func CRLFProbe(opt PoCOptions) ([]report.Finding, error) {
+	p, err := newProber(opt)
+	if err != nil {
+		return nil, err
+	}
+
+	findings := []report.Finding{}
+	for i, loc := range crlfLocations(p.base, p.opt.Param) {
+		token := p.token(i + 1)
+		for _, seq := range crlfSequences {
+			payload := "reconsec" + seq + crlfHeader + ": " + token
+			req, err := loc.Apply(p.base, payload)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", loc, err)
+			}
+			ex := p.send(req)
+			if ex == nil || !strings.Contains(ex.Header.Get(crlfHeader), token) {
+				continue
+			}
+			f := newFinding("CRLFInjection", "CWE-113", report.SeverityHigh, report.ConfidenceHigh, req, ex,
+				fmt.Sprintf("location=%s; sequence=%q; status=%d; injected header %s", loc, seq, ex.Status, crlfHeader))
+			f.Evidence.Excerpt = crlfHeader + ": " + ex.Header.Get(crlfHeader)
+			findings = append(findings, f)
+			break
+		}
+	}
+	return p.done(findings)
+}
+
+// canaryHost deriva do token um host sob o domínio canário.
+func canaryHost(token string) string {
+	label := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '-'
+	}, token)
+	return strings.Trim(label, "-") + "." + canaryDomain
+}
+
+// HostHeaderProbe envia um host canário em cada cabeçalho de hostHeaders e
+// procura esse host em redirecionamentos e em links absolutos da resposta.
+func HostHeaderProbe(opt PoCOptions) ([]report.Finding, error) {
+	p, err := newProber(opt)
+	if err != nil {
+		return nil, err
+	}
+
+	findings := []report.Finding{}
+	for i, name := range hostHeaders {
+		host := canaryHost(p.token(i + 1))
+		value := host
+		if name == "Forwarded" {
+			value = "host=" + host
+		}
+		req, err := active.InjectionPoint{Kind: active.InjectHeader, Name: name}.Apply(p.base, value)
+		if err != nil {
+			return nil, err
+		}
+		ex := p.send(req)
+		if ex == nil {
+			continue
+		}
+
+		notes := fmt.Sprintf("header=%s; value=%s; status=%d", name, value, ex.Status)
+		if header, target := redirectTarget(ex); target != "" {
+			if u := resolveRedirect(req.URL, target); u != nil && strings.EqualFold(u.Hostname(), host) {
+				f := newFinding("HostHeaderInjection", "CWE-20", report.SeverityMedium, report.ConfidenceHigh, req, ex,
+					notes+"; injected host in "+header+" redirect")
+				f.Evidence.Excerpt = header + ": " + ex.Header.Get(header)
+				findings = append(findings, f)
+				continue
+			}
+		}
+		body := string(ex.Body)
+		if at := indexFold(body, "//"+host); at >= 0 {
+			f := newFinding("HostHeaderInjection", "CWE-20", report.SeverityMedium, report.ConfidenceHigh, req, ex,
+				notes+"; injected host in absolute links")
+			f.Evidence.Excerpt = excerpt(body, at, len(host)+2)
+			findings = append(findings, f)
+		}
+	}
+	return p.done(findings)
+}
@@ -0,0 +1,110 @@
+package poc
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ghostn3xus/reconsec/pkg/active"
+)
+
+func mustRequest(t *testing.T, raw string) active.HTTPRequest {
+	t.Helper()
+	req, err := active.RequestFromURL(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestCRLFProbe(t *testing.T) {
+	// O net/http não deixa escrever quebras de linha em cabeçalhos, então o
+	// servidor vulnerável escreve a resposta bruta. Ele remove CRLF, mas não LF.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lang := r.URL.Query().Get("lang")
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintf(buf, "HTTP/1.1 200 OK\r\nSet-Cookie: lang=%s\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok", strings.ReplaceAll(lang, "\r\n", ""))
+		buf.Flush()
+	}))
+	defer srv.Close()
+
+	findings, err := CRLFProbe(PoCOptions{URL: srv.URL + "/?lang=pt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 {
+		t.Fatalf("expected one CRLF injection, got %+v", findings)
+	}
+	f := findings[0]
+	if f.Type != "CRLFInjection" || f.CWE != "CWE-113" || !strings.Contains(f.Notes, "location=query:lang") || !strings.Contains(f.Notes, `sequence="\n"`) {
+		t.Fatalf("unexpected finding %+v", f)
+	}
+}
+
+func TestHostHeaderProbe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Header.Get("X-Forwarded-Host")
+		if host == "" {
+			host = r.Host
+		}
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "http://"+r.Host+"/new", http.StatusMovedPermanently)
+			return
+		}
+		fmt.Fprintf(w, `<a href="https://%s/reset?t=1">reset</a>`, host)
+	}))
+	defer srv.Close()
+
+	findings, err := HostHeaderProbe(PoCOptions{URL: srv.URL + "/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]bool{}
+	for _, f := range findings {
+		if f.Type != "HostHeaderInjection" || f.CWE == "" {
+			t.Errorf("unexpected finding %+v", f)
+		}
+		got[strings.SplitN(strings.TrimPrefix(f.Notes, "header="), ";", 2)[0]] = true
+	}
+	if !got["Host"] || !got["X-Forwarded-Host"] || len(got) != 2 {
+		t.Fatalf("expected Host and X-Forwarded-Host, got %v", got)
+	}
+
+	findings, err = HostHeaderProbe(PoCOptions{URL: srv.URL + "/old"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 || !strings.Contains(findings[0].Notes, "Location redirect") {
+		t.Fatalf("expected the Host redirect, got %+v", findings)
+	}
+	if u, _ := url.Parse(strings.TrimPrefix(findings[0].Evidence.Excerpt, "Location: ")); !strings.HasSuffix(u.Host, canaryDomain) {
+		t.Fatalf("unexpected redirect %s", findings[0].Evidence.Excerpt)
+	}
+}
+
+func TestHostHeaderProbeNonASCIIBody(t *testing.T) {
+	// "İ" cresce de 2 para 3 bytes em minúsculas; o trecho deve continuar
+	// alinhado com o corpo original.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<p>%s</p><a href="https://%s/reset">reset</a>`, strings.Repeat("İ", 200), r.Header.Get("X-Forwarded-Host"))
+	}))
+	defer srv.Close()
+
+	findings, err := HostHeaderProbe(PoCOptions{URL: srv.URL + "/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 {
+		t.Fatalf("expected the X-Forwarded-Host link, got %+v", findings)
+	}
+	if ex := findings[0].Evidence.Excerpt; !strings.Contains(ex, canaryDomain+"/reset") {
+		t.Fatalf("excerpt is not aligned with the link: %q", ex)
+	}
+}
@@ -1,12 +1,14 @@
 package poc
 
 import (
+	"context"
 	"fmt"
-	"io"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/ghostn3xus/reconsec/pkg/active"
 	"github.com/ghostn3xus/reconsec/pkg/ml"
 	"github.com/ghostn3xus/reconsec/pkg/report"
 	"github.com/ghostn3xus/reconsec/pkg/utils"
@@ -19,11 +21,67 @@ type PoCOptions struct {
 	Timeout  int
 	Only     string
 	MaxReads int64
+
+	// Session, se definida, autentica a sonda.
+	Session *utils.Session
+
+	// Request, se definida, é a requisição base (ex.: lida de um arquivo bruto),
+	// enviada com método, cabeçalhos, cookies e corpo originais e caminho sem
+	// normalização. Sem ela, a base é um GET para URL.
+	Request *active.HTTPRequest
+
+	// Limiter, se definido, limita as requisições por host e no total; é
+	// compartilhado entre as sondas de um lote.
+	Limiter *utils.HostLimiter
+
+	// ctx interrompe a espera pelo Limiter e os envios (usado por Batch).
+	ctx context.Context
+}
+
+// Probe é uma sonda segura: envia só valores inofensivos e devolve os achados.
+type Probe func(PoCOptions) ([]report.Finding, error)
+
+// ProbeNames lista as sondas na ordem em que Run as executa.
+var ProbeNames = []string{"reflection", "redirect", "crlf", "host-header", "cors", "ssti", "traversal"}
+
+// Probes são as sondas disponíveis, pelo nome.
+var Probes = map[string]Probe{
+	"reflection":  SafeProbe,
+	"redirect":    OpenRedirectProbe,
+	"crlf":        CRLFProbe,
+	"host-header": HostHeaderProbe,
+	"cors":        CORSProbe,
+	"ssti":        SSTIProbe,
+	"traversal":   TraversalProbe,
+}
+
+// Run executa as sondas pedidas, na ordem de ProbeNames, e junta os achados.
+// Em caso de erro, devolve os achados das sondas anteriores com ele.
+func Run(opt PoCOptions, names ...string) ([]report.Finding, error) {
+	want := map[string]bool{}
+	for _, n := range names {
+		if Probes[n] == nil {
+			return nil, fmt.Errorf("unknown probe %q", n)
+		}
+		want[n] = true
+	}
+	findings := []report.Finding{}
+	for _, n := range ProbeNames {
+		if !want[n] {
+			continue
+		}
+		f, err := Probes[n](opt)
+		findings = append(findings, f...)
+		if err != nil {
+			return findings, fmt.Errorf("%s probe: %w", n, err)
+		}
+	}
+	return findings, nil
 }
 
 // isCommonVulnParam verifica se um nome de parâmetro é comumente associado a vulnerabilidades.
 func isCommonVulnParam(param string) bool {
-	commonParams := []string{"page", "file", "redirect", "url", "debug", "id", "user", "name", "cmd"}
+	commonParams := []string{"page", "file", "redirect", "url", "next", "debug", "id", "user", "name", "cmd"}
 	for _, p := range commonParams {
 		if strings.Contains(strings.ToLower(param), p) {
 			return true
@@ -32,32 +90,131 @@ func isCommonVulnParam(param string) bool {
 	return false
 }
 
-// analyzeReflectionContext analisa onde o token foi refletido e ajusta a severidade.
-func analyzeReflectionContext(body, token string, currentSeverity report.Severity) (string, report.Severity) {
-	if !strings.Contains(body, token) {
-		return "not reflected", currentSeverity
+// probeHeaders são cabeçalhos testados mesmo quando ausentes da requisição base,
+// por serem refletidos com frequência (logs, links absolutos, páginas de erro).
+var probeHeaders = []string{"Referer", "User-Agent", "X-Forwarded-Host"}
+
+// probeLocations lista os locais da requisição base que recebem um token:
+// parâmetros de query, campos de formulário e JSON, cookies e os cabeçalhos de
+// probeHeaders, além do parâmetro param na query. Com posições §marcadas§, só elas.
+func probeLocations(req active.HTTPRequest, param string) []active.InjectionPoint {
+	if active.HasMarkers(req) {
+		return active.EnumerateInjectionPoints(req)
 	}
 
-	// Verifica a reflexão em um contexto de script (XSS de alto impacto)
-	if strings.Contains(body, "<script>") && strings.Contains(body, "</script>") {
-		scriptContent := body[strings.Index(body, "<script>")+8 : strings.Index(body, "</script>")]
-		if strings.Contains(scriptContent, token) {
-			return "reflected in script tag", report.SeverityHigh
+	var points []active.InjectionPoint
+	hasParam := false
+	for _, p := range active.EnumerateInjectionPoints(req) {
+		switch p.Kind {
+		case active.InjectQuery, active.InjectForm, active.InjectMultipart, active.InjectJSON, active.InjectCookie:
+			points = append(points, p)
+			if p.Kind == active.InjectQuery && p.Name == param {
+				hasParam = true
+			}
 		}
 	}
+	if !hasParam {
+		points = append(points, active.InjectionPoint{Kind: active.InjectQuery, Name: param})
+	}
+	for _, h := range probeHeaders {
+		points = append(points, active.InjectionPoint{Kind: active.InjectHeader, Name: h, Original: req.Header.Get(h)})
+	}
+	return points
+}
 
-	// Verifica a reflexão em um atributo HTML
-	if strings.Contains(body, fmt.Sprintf(`="%s"`, token)) || strings.Contains(body, fmt.Sprintf(`='%s'`, token)) {
-		return "reflected in HTML attribute", report.SeverityMedium
+// SafeProbe envia um token único (Token seguido de um número) para cada local da
+// requisição base e devolve um achado para cada contexto distinto em que o token
+// de um local volta no corpo da resposta. Cada contexto recebe canários de
+// caracteres especiais, e a severidade vem do contexto e de quais caracteres
+// sobrevivem sem codificação. Param é testado na query além dos parâmetros já
+// existentes.
+func SafeProbe(opt PoCOptions) ([]report.Finding, error) {
+	p, err := newProber(opt)
+	if err != nil {
+		return nil, err
 	}
+	opt = p.opt
+	model, _ := ml.LoadModel("") // Carrega o modelo padrão
 
-	return "reflected in body", report.SeverityLow
+	findings := []report.Finding{}
+	for i, loc := range probeLocations(p.base, opt.Param) {
+		token := p.token(i + 1)
+		req, err := loc.Apply(p.base, token)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", loc, err)
+		}
+		ex := p.send(req)
+		if ex == nil {
+			continue
+		}
+
+		body := string(ex.Body)
+		occurrences := analyzeReflectionContext(body, token)
+		distinct := distinctContexts(occurrences)
+		if len(distinct) == 0 {
+			continue
+		}
+		matrices := p.probeChars(loc, token, distinct)
+
+		// Integração com ML
+		features := map[string]float64{
+			"param_name_entropy": ml.CalculateEntropy(loc.Name),
+			"param_name_len":     float64(len(loc.Name)),
+			"is_common_name":     0,
+		}
+		if isCommonVulnParam(loc.Name) {
+			features["is_common_name"] = 1
+		}
+		interestScore := model.Score(features)
+
+		for k, n := range distinct {
+			c := occurrences[n]
+			grade := gradeExploitability(c, matrices[k])
+			sev, conf := gradeSeverity(c, grade)
+			ev := ex.Evidence()
+			ev.Excerpt = excerpt(body, c.Offset, len(token))
+			ev.Reflection = &report.ReflectionEvidence{
+				Location:          loc.String(),
+				Token:             token,
+				ReflectionContext: c,
+				Chars:             matrices[k],
+				Exploitability:    grade,
+			}
+			findings = append(findings, report.Finding{
+				Type:       "ReflectedInput",
+				CWE:        "CWE-79",
+				Severity:   sev,
+				Confidence: conf,
+				URL:        req.URL,
+				Notes: fmt.Sprintf("location=%s; status=%d; len=%d; reflected=%s; exploitability=%s; raw_chars=%s; interest_score=%.2f",
+					loc, ex.Status, len(ex.Body), describeContext(c), grade, rawChars(matrices[k]), interestScore),
+				Time:     time.Now(),
+				Evidence: ev,
+			})
+		}
+	}
+	return p.done(findings)
+}
+
+// prober reúne o que todas as sondas compartilham: as opções com os valores
+// padrão, a requisição base e o envio, que não segue redirecionamentos (uma
+// requisição bruta vai sem normalizar o caminho). Falhas de envio são guardadas
+// para que a sonda só falhe se nenhuma requisição chegar ao alvo.
+type prober struct {
+	opt    PoCOptions
+	base   active.HTTPRequest
+	sender *active.NativeSender
+
+	sent    int
+	sendErr error
 }
 
-func SafeProbe(opt PoCOptions) (report.Finding, error) {
-	var finding report.Finding
+func newProber(opt PoCOptions) (*prober, error) {
+	if opt.Request != nil {
+		opt.URL = opt.Request.URL
+	}
 	if strings.TrimSpace(opt.URL) == "" {
-		return finding, fmt.Errorf("url required")
+		return nil, fmt.Errorf("url required")
 	}
 
 	if opt.MaxReads <= 0 {
@@ -71,68 +228,105 @@ func SafeProbe(opt PoCOptions) (report.Finding, error) {
 	if opt.Token == "" {
 		opt.Token = "__RECONSEC_PROBE__"
 	}
-	u, err := url.Parse(opt.URL)
-	if err != nil {
-		return finding, err
-	}
-	q := u.Query()
 	if opt.Param == "" {
 		opt.Param = "reconsec_probe"
 	}
-	q.Set(opt.Param, opt.Token)
-	u.RawQuery = q.Encode()
-	client := utils.HTTPClient(opt.Timeout)
-	resp, err := client.Get(u.String())
-	if err != nil {
-		return finding, err
-	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(io.LimitReader(resp.Body, opt.MaxReads))
-	if err != nil {
-		return finding, err
-	}
-	bodyStr := string(body)
-	respLen := len(body)
 
-	// Determina a severidade inicial com base no código de status
-	sev := report.SeverityLow
-	if resp.StatusCode >= 500 {
-		sev = report.SeverityHigh
-	} else if resp.StatusCode >= 400 {
-		sev = report.SeverityMedium
+	p := &prober{opt: opt}
+	if opt.Request != nil {
+		p.base = *opt.Request
+	} else {
+		base, err := active.RequestFromURL(opt.URL)
+		if err != nil {
+			return nil, err
+		}
+		p.base = base
 	}
+	p.sender = active.NewNativeSender(opt.Session.Client(opt.Timeout))
+	p.sender.MaxBody = opt.MaxReads
+	p.sender.PathAsIs = opt.Request != nil
+	p.sender.Session = opt.Session
+	return p, nil
+}
 
-	// Analisa o contexto da reflexão para ajustar a severidade
-	reflectionContext, sev := analyzeReflectionContext(bodyStr, opt.Token, sev)
-	reflected := reflectionContext != "not reflected"
+// token devolve o token único do n-ésimo local testado.
+func (p *prober) token(n int) string {
+	return fmt.Sprintf("%s%d__", p.opt.Token, n)
+}
 
-	// Integração com ML
-	model, _ := ml.LoadModel("") // Carrega o modelo padrão
-	features := map[string]float64{
-		"param_name_entropy": ml.CalculateEntropy(opt.Param),
-		"param_name_len":     float64(len(opt.Param)),
-		"is_common_name":     0,
+// send envia a requisição e devolve nil se o envio falhar.
+func (p *prober) send(req active.HTTPRequest) *active.Exchange {
+	parent := p.opt.ctx
+	if parent == nil {
+		parent = context.Background()
 	}
-	if isCommonVulnParam(opt.Param) {
-		features["is_common_name"] = 1
+	if p.opt.Limiter != nil {
+		host := ""
+		if u, err := url.Parse(req.URL); err == nil {
+			host = u.Host
+		}
+		if err := p.opt.Limiter.Wait(parent, host); err != nil {
+			p.sendErr = err
+			return nil
+		}
+	}
+	ctx, cancel := context.WithTimeout(parent, time.Duration(p.opt.Timeout)*time.Second)
+	defer cancel()
+	ex, err := p.sender.Send(ctx, req)
+	if err != nil {
+		p.sendErr = err
+		return nil
 	}
-	interestScore := model.Score(features)
+	p.sent++
+	return ex
+}
 
-	notes := fmt.Sprintf("Status=%d; len=%d; reflected=%s; interest_score=%.2f",
-		resp.StatusCode, respLen, reflectionContext, interestScore)
+// done devolve os achados, ou o erro de envio se nada chegou ao alvo.
+func (p *prober) done(findings []report.Finding) ([]report.Finding, error) {
+	if p.sent == 0 && p.sendErr != nil {
+		return nil, p.sendErr
+	}
+	return findings, nil
+}
 
-	finding = report.Finding{
-		Type:       "SafeProbe",
-		Severity:   sev,
-		Confidence: report.ConfidenceMedium,
-		URL:        u.String(),
-		Notes:      notes,
-		Time:       time.Now(),
+// distinctContexts devolve os índices da primeira ocorrência de cada contexto distinto.
+func distinctContexts(contexts []report.ReflectionContext) []int {
+	var out []int
+	seen := map[report.ReflectionContext]bool{}
+	for i, c := range contexts {
+		key := c
+		key.Offset = 0
+		if !seen[key] {
+			seen[key] = true
+			out = append(out, i)
+		}
 	}
+	return out
+}
 
-	if reflected {
-		finding.Confidence = report.ConfidenceHigh
+// rawChars lista os caracteres que voltaram sem codificação, para as notas.
+func rawChars(chars []report.CharSurvival) string {
+	var sb strings.Builder
+	for _, r := range chars {
+		if r.State == CharRaw {
+			q := strconv.Quote(r.Char)
+			sb.WriteString(q[1 : len(q)-1])
+		}
 	}
+	return sb.String()
+}
 
-	return finding, nil
+// excerpt devolve o trecho do corpo em volta de body[at:at+n].
+func excerpt(body string, at, n int) string {
+	from, to := at-60, at+n+60
+	if from < 0 {
+		from = 0
+	}
+	if to > len(body) {
+		to = len(body)
+	}
+	if from > to {
+		from = to
+	}
+	return strings.ToValidUTF8(body[from:to], "")
 }
@@ -0,0 +1,132 @@
+package poc
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ghostn3xus/reconsec/pkg/active"
+	"github.com/ghostn3xus/reconsec/pkg/report"
+)
+
+func TestSafeProbeEveryLocation(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Name string }
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &body)
+		c, _ := r.Cookie("theme")
+		fmt.Fprintf(w, "<p>%s</p><p>%s</p><p>%s</p>", r.URL.Query().Get("q"), body.Name, r.UserAgent())
+		if c != nil {
+			fmt.Fprintf(w, `<body class="%s">`, c.Value)
+		}
+	}))
+	defer srv.Close()
+
+	req := active.HTTPRequest{
+		Method: http.MethodPost,
+		URL:    srv.URL + "/search?q=a&page=1",
+		Header: http.Header{"Content-Type": {"application/json"}, "Cookie": {"theme=dark"}},
+		Body:   []byte(`{"name":"bob","age":3}`),
+	}
+	findings, err := SafeProbe(PoCOptions{Request: &req, Token: "TKN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]string{}
+	tokens := map[string]bool{}
+	for _, f := range findings {
+		r := f.Evidence.Reflection
+		got[r.Location] = r.Kind
+		if tokens[r.Token] || !strings.Contains(f.Evidence.Response, r.Token) {
+			t.Errorf("token %s must be unique and present in the response", r.Token)
+		}
+		tokens[r.Token] = true
+	}
+	for _, want := range []string{"query:q", "json:name", "header:User-Agent", "cookie:theme"} {
+		if got[want] == "" {
+			t.Errorf("missing reflection at %s (got %v)", want, got)
+		}
+	}
+	if len(got) != 4 {
+		t.Errorf("unexpected reflections %v", got)
+	}
+}
+
+func TestSafeProbeCharacterSurvival(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		// "safe" é codificado corretamente; "raw" só perde os parênteses.
+		safe := html.EscapeString(q.Get("safe"))
+		raw := strings.NewReplacer("(", "", ")", "").Replace(q.Get("raw"))
+		fmt.Fprintf(w, `<input value="%s"><p>%s</p>`, safe, raw)
+	}))
+	defer srv.Close()
+
+	findings, err := SafeProbe(PoCOptions{URL: srv.URL + "/?safe=1&raw=2", Token: "TKN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byLoc := map[string]*report.ReflectionEvidence{}
+	for _, f := range findings {
+		byLoc[f.Evidence.Reflection.Location] = f.Evidence.Reflection
+	}
+
+	safe, raw := byLoc["query:safe"], byLoc["query:raw"]
+	if safe == nil || raw == nil {
+		t.Fatalf("expected reflections for both parameters, got %v", byLoc)
+	}
+	if safe.Kind != ContextAttrValue || safe.Exploitability != ExploitUnlikely {
+		t.Errorf("encoded attribute must be unlikely, got %+v", safe)
+	}
+	if raw.Kind != ContextText || raw.Exploitability != ExploitLikely {
+		t.Errorf("raw text reflection must be likely, got %+v", raw)
+	}
+
+	states := func(r *report.ReflectionEvidence) map[string]report.CharSurvival {
+		m := map[string]report.CharSurvival{}
+		for _, c := range r.Chars {
+			m[c.Char] = c
+		}
+		return m
+	}
+	if c := states(safe)[`"`]; c.State != CharEncoded || c.Returned != "&#34;" {
+		t.Errorf(`unexpected result for " in the encoded attribute: %+v`, c)
+	}
+	rs := states(raw)
+	if rs["<"].State != CharRaw || rs["("].State != CharStripped || rs["\n"].State != CharRaw {
+		t.Errorf("unexpected matrix for the raw reflection: %+v", raw.Chars)
+	}
+	if len(raw.Chars) != len(survivalChars) {
+		t.Errorf("every character must be probed, got %d", len(raw.Chars))
+	}
+}
+
+func TestGradeExploitabilityEventHandler(t *testing.T) {
+	c := report.ReflectionContext{Kind: ContextEventHandler, Attribute: "onclick", Quote: `"`, JSQuote: "'"}
+	chars := []report.CharSurvival{
+		{Char: `"`, State: CharEncoded, Returned: "&quot;"},
+		{Char: "'", State: CharEncoded, Returned: "&#39;"},
+	}
+	if g := gradeExploitability(c, chars); g != ExploitLikely {
+		t.Fatalf("entity-encoded quote still closes the JS string, got %s", g)
+	}
+	chars[1].Returned = `\'`
+	if g := gradeExploitability(c, chars); g != ExploitUnlikely {
+		t.Fatalf("escaped JS quote and entity-encoded attribute quote must not break out, got %s", g)
+	}
+}
+
+func TestExcerptBounds(t *testing.T) {
+	if got := excerpt("short", 80, 4); got != "" {
+		t.Fatalf("an offset past the body must give an empty excerpt, got %q", got)
+	}
+	if got := excerpt("abc", 1, 1); got != "abc" {
+		t.Fatalf("unexpected excerpt %q", got)
+	}
+}
@@ -0,0 +1,134 @@
+package poc
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ghostn3xus/reconsec/pkg/active"
+	"github.com/ghostn3xus/reconsec/pkg/report"
+)
+
+// canaryDomain é um domínio reservado (RFC 2606) que nunca resolve: um
+// redirecionamento ou link para ele não leva o usuário a lugar nenhum.
+const canaryDomain = "reconsec-canary.example"
+
+// redirectParams são trechos de nomes de parâmetros que costumam receber o
+// destino de um redirecionamento.
+var redirectParams = []string{"redirect", "redir", "url", "uri", "next", "return", "goto", "dest", "continue", "target"}
+
+// redirectPayloads são as formas de URL externa testadas: absoluta, relativa
+// ao esquema e com barra invertida (que os navegadores tratam como "//").
+var redirectPayloads = []string{"https://%s/%s", "//%s/%s", `/\%s/%s`}
+
+func isRedirectParam(name string) bool {
+	name = strings.ToLower(name)
+	for _, p := range redirectParams {
+		if strings.Contains(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// redirectLocations lista os parâmetros de query e formulário com nome de
+// redirecionamento. Sem nenhum, testa redirect, url e next na query.
+func redirectLocations(req active.HTTPRequest) []active.InjectionPoint {
+	if active.HasMarkers(req) {
+		return active.EnumerateInjectionPoints(req)
+	}
+	var points []active.InjectionPoint
+	for _, p := range active.EnumerateInjectionPoints(req) {
+		if (p.Kind == active.InjectQuery || p.Kind == active.InjectForm) && isRedirectParam(p.Name) {
+			points = append(points, p)
+		}
+	}
+	if len(points) == 0 {
+		for _, name := range []string{"redirect", "url", "next"} {
+			points = append(points, active.InjectionPoint{Kind: active.InjectQuery, Name: name})
+		}
+	}
+	return points
+}
+
+// OpenRedirectProbe envia uma URL externa inofensiva aos parâmetros de
+// redirecionamento e confere, sem seguir o redirecionamento, se os cabeçalhos
+// Location ou Refresh apontam para ela.
+func OpenRedirectProbe(opt PoCOptions) ([]report.Finding, error) {
+	p, err := newProber(opt)
+	if err != nil {
+		return nil, err
+	}
+
+	findings := []report.Finding{}
+	for i, loc := range redirectLocations(p.base) {
+		token := p.token(i + 1)
+		for _, format := range redirectPayloads {
+			payload := fmt.Sprintf(format, canaryDomain, token)
+			req, err := loc.Apply(p.base, payload)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", loc, err)
+			}
+			ex := p.send(req)
+			if ex == nil {
+				continue
+			}
+			header, target := redirectTarget(ex)
+			if u := resolveRedirect(req.URL, target); u == nil || !strings.EqualFold(u.Hostname(), canaryDomain) {
+				continue
+			}
+			f := newFinding("OpenRedirect", "CWE-601", report.SeverityMedium, report.ConfidenceHigh, req, ex,
+				fmt.Sprintf("location=%s; payload=%s; status=%d; %s=%s", loc, payload, ex.Status, header, target))
+			f.Evidence.Excerpt = header + ": " + ex.Header.Get(header)
+			findings = append(findings, f)
+			break
+		}
+	}
+	return p.done(findings)
+}
+
+// redirectTarget devolve o cabeçalho de redirecionamento da resposta e o destino.
+func redirectTarget(ex *active.Exchange) (string, string) {
+	if loc := ex.Header.Get("Location"); loc != "" {
+		return "Location", loc
+	}
+	// Refresh: 0; url=https://destino
+	if refresh := ex.Header.Get("Refresh"); refresh != "" {
+		if i := strings.Index(strings.ToLower(refresh), "url="); i >= 0 {
+			return "Refresh", strings.Trim(strings.TrimSpace(refresh[i+4:]), `'"`)
+		}
+	}
+	return "", ""
+}
+
+// resolveRedirect resolve o destino como um navegador: relativo à URL da
+// requisição e com barras invertidas tratadas como barras.
+func resolveRedirect(from, target string) *url.URL {
+	if target == "" {
+		return nil
+	}
+	base, err := url.Parse(from)
+	if err != nil {
+		return nil
+	}
+	u, err := base.Parse(strings.ReplaceAll(target, `\`, "/"))
+	if err != nil {
+		return nil
+	}
+	return u
+}
+
+// newFinding monta um achado de sonda com a requisição e a resposta como evidência.
+func newFinding(typ, cwe string, sev report.Severity, conf report.Confidence, req active.HTTPRequest, ex *active.Exchange, notes string) report.Finding {
+	return report.Finding{
+		Type:       typ,
+		CWE:        cwe,
+		Severity:   sev,
+		Confidence: conf,
+		URL:        req.URL,
+		Notes:      notes,
+		Time:       time.Now(),
+		Evidence:   ex.Evidence(),
+	}
+}
@@ -0,0 +1,48 @@
+package poc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOpenRedirectProbe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Só aceita destinos "relativos", mas não percebe "/\host".
+		if next := r.URL.Query().Get("next"); strings.HasPrefix(next, "/") && !strings.HasPrefix(next, "//") {
+			w.Header().Set("Location", next)
+			w.WriteHeader(http.StatusFound)
+			return
+		}
+		w.Header().Set("Location", "/home")
+		w.WriteHeader(http.StatusFound)
+	}))
+	defer srv.Close()
+
+	findings, err := OpenRedirectProbe(PoCOptions{URL: srv.URL + "/login?next=/home&q=1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 {
+		t.Fatalf("expected one open redirect, got %+v", findings)
+	}
+	f := findings[0]
+	if f.Type != "OpenRedirect" || f.CWE != "CWE-601" || !strings.Contains(f.Evidence.Excerpt, `/\`+canaryDomain) {
+		t.Fatalf("unexpected finding %+v", f)
+	}
+	if !strings.Contains(f.Notes, "location=query:next") {
+		t.Errorf("finding must name the parameter: %s", f.Notes)
+	}
+}
+
+func TestRedirectLocationsDefaults(t *testing.T) {
+	req := mustRequest(t, "http://t/?id=1&returnTo=/x")
+	got := redirectLocations(req)
+	if len(got) != 1 || got[0].Name != "returnTo" {
+		t.Fatalf("expected only the redirect-like parameter, got %v", got)
+	}
+	if got := redirectLocations(mustRequest(t, "http://t/?id=1")); len(got) != 3 {
+		t.Fatalf("expected the default redirect parameters, got %v", got)
+	}
+}
@@ -0,0 +1,104 @@
+package poc
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ghostn3xus/reconsec/pkg/active"
+	"github.com/ghostn3xus/reconsec/pkg/report"
+)
+
+// templateSyntax é uma expressão aritmética na sintaxe de uma família de
+// engines de template; %d recebe os dois fatores.
+type templateSyntax struct {
+	engine string
+	format string
+}
+
+// templateSyntaxes cobre as engines mais comuns. As expressões só multiplicam
+// dois números: nada é lido, escrito ou executado além disso.
+var templateSyntaxes = []templateSyntax{
+	{"Jinja2/Twig/Nunjucks/Tornado", "{{%d*%d}}"},
+	{"Freemarker/Mako/JSP EL", "${%d*%d}"},
+	{"Thymeleaf", "[[${%d*%d}]]"},
+	{"ERB/EJS", "<%%= %d*%d %%>"},
+	{"Pug/Slim/Ruby", "#{%d*%d}"},
+	{"Smarty", "{%d*%d}"},
+	{"Velocity", "#set($r=%d*%d)${r}"},
+	{"Razor", "@(%d*%d)"},
+}
+
+// jinjaOrTwig distingue as engines de "{{ }}": o Jinja2 repete a string
+// (7*'7' = "7777777") e o Twig/Nunjucks converte para número (49).
+const jinjaOrTwig = "{{7*'7'}}"
+
+func randomFactor() int {
+	v, _ := rand.Int(rand.Reader, big.NewInt(900))
+	return int(v.Int64()) + 100
+}
+
+// SSTIProbe envia a cada local refletido (os mesmos da sonda de reflexão: uma
+// expressão só volta avaliada onde a entrada volta) expressões aritméticas entre
+// dois tokens, uma por sintaxe de engine, e confirma a injeção quando o produto
+// volta entre os tokens e a expressão literal não.
+func SSTIProbe(opt PoCOptions) ([]report.Finding, error) {
+	p, err := newProber(opt)
+	if err != nil {
+		return nil, err
+	}
+
+	findings := []report.Finding{}
+	for i, loc := range probeLocations(p.base, p.opt.Param) {
+		token := p.token(i + 1)
+		req, err := loc.Apply(p.base, token)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", loc, err)
+		}
+		ex := p.send(req)
+		if ex == nil || !strings.Contains(string(ex.Body), token) {
+			continue
+		}
+
+		for _, syn := range templateSyntaxes {
+			a, b := randomFactor(), randomFactor()
+			expr := fmt.Sprintf(syn.format, a, b)
+			result := fmt.Sprint(a * b)
+			req, ex, ok := p.evaluates(loc, token, expr, result)
+			if !ok {
+				continue
+			}
+			engine := syn.engine
+			if strings.HasPrefix(syn.format, "{{") {
+				if _, _, ok := p.evaluates(loc, token, jinjaOrTwig, "7777777"); ok {
+					engine = "Jinja2"
+				} else if _, _, ok := p.evaluates(loc, token, jinjaOrTwig, "49"); ok {
+					engine = "Twig/Nunjucks"
+				}
+			}
+			f := newFinding("ServerSideTemplateInjection", "CWE-1336", report.SeverityHigh, report.ConfidenceHigh, req, ex,
+				fmt.Sprintf("location=%s; engine=%s; expression=%s; result=%s; status=%d", loc, engine, expr, result, ex.Status))
+			body := string(ex.Body)
+			f.Evidence.Excerpt = excerpt(body, strings.Index(body, token+result+token), len(token)*2+len(result))
+			findings = append(findings, f)
+			break
+		}
+	}
+	return p.done(findings)
+}
+
+// evaluates envia token+expr+token ao local e informa se a resposta traz o
+// resultado esperado entre os tokens sem trazer a expressão literal.
+func (p *prober) evaluates(loc active.InjectionPoint, token, expr, result string) (active.HTTPRequest, *active.Exchange, bool) {
+	req, err := loc.Apply(p.base, token+expr+token)
+	if err != nil {
+		return req, nil, false
+	}
+	ex := p.send(req)
+	if ex == nil {
+		return req, nil, false
+	}
+	body := string(ex.Body)
+	return req, ex, strings.Contains(body, token+result+token) && !strings.Contains(body, token+expr+token)
+}
@@ -0,0 +1,49 @@
+package poc
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// renderJinja imita uma engine "{{ }}" que avalia multiplicações, repetindo
+// strings como o Jinja2.
+func renderJinja(s string) string {
+	re := regexp.MustCompile(`\{\{(\d+)\*('?)(\d+)'?\}\}`)
+	return re.ReplaceAllStringFunc(s, func(m string) string {
+		g := re.FindStringSubmatch(m)
+		a, _ := strconv.Atoi(g[1])
+		if g[2] == "'" {
+			return strings.Repeat(g[3], a)
+		}
+		b, _ := strconv.Atoi(g[3])
+		return strconv.Itoa(a * b)
+	})
+}
+
+func TestSSTIProbe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		fmt.Fprintf(w, "<p>Hello %s</p><p>%s</p>", renderJinja(q.Get("name")), q.Get("plain"))
+	}))
+	defer srv.Close()
+
+	findings, err := SSTIProbe(PoCOptions{URL: srv.URL + "/?name=a&plain=b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 {
+		t.Fatalf("expected one SSTI finding, got %+v", findings)
+	}
+	f := findings[0]
+	if f.Type != "ServerSideTemplateInjection" || noteField(f.Notes, "location") != "query:name" || noteField(f.Notes, "engine") != "Jinja2" {
+		t.Fatalf("unexpected finding %+v", f)
+	}
+	if !strings.Contains(f.Evidence.Excerpt, noteField(f.Notes, "result")) {
+		t.Errorf("excerpt must show the computed result: %q", f.Evidence.Excerpt)
+	}
+}
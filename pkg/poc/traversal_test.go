@@ -0,0 +1,53 @@
+package poc
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestTraversalProbe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Remove "../" uma vez, o que "....//" contorna.
+		doc := strings.ReplaceAll(r.URL.Query().Get("doc"), "../", "")
+		if path.Clean("/var/www/docs/"+doc) == "/etc/passwd" {
+			fmt.Fprint(w, "root:x:0:0:root:/root:/bin/bash\n")
+			return
+		}
+		fmt.Fprint(w, "not found")
+	}))
+	defer srv.Close()
+
+	findings, err := TraversalProbe(PoCOptions{URL: srv.URL + "/view?id=1&doc=intro.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 {
+		t.Fatalf("expected one traversal finding, got %+v", findings)
+	}
+	f := findings[0]
+	if f.Type != "PathTraversal" || f.CWE != "CWE-22" || noteField(f.Notes, "os") != "unix" || !strings.HasPrefix(noteField(f.Notes, "payload"), "....//") {
+		t.Fatalf("unexpected finding %+v", f)
+	}
+	if !strings.HasPrefix(f.Evidence.Excerpt, "root:x:0:0:") {
+		t.Errorf("unexpected excerpt %q", f.Evidence.Excerpt)
+	}
+}
+
+func TestTraversalProbeSkipsSignatureInBaseline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<pre>root:x:0:0:root:/root:/bin/sh</pre>")
+	}))
+	defer srv.Close()
+
+	findings, err := TraversalProbe(PoCOptions{URL: srv.URL + "/?file=a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 0 {
+		t.Fatalf("a signature already in the base response must not be reported, got %+v", findings)
+	}
+}
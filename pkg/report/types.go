@@ -26,4 +26,135 @@ type Finding struct {
 	Notes      string     `json:"notes,omitempty"`
 	Snippet    string     `json:"snippet,omitempty"`
 	Time       time.Time  `json:"time,omitempty"`
+	Evidence   *Evidence  `json:"evidence,omitempty"`
+}
+
+// Evidence guarda a requisição e a resposta que sustentam um achado.
+type Evidence struct {
+	Request    string `json:"request,omitempty"`
+	Response   string `json:"response,omitempty"`
+	Status     int    `json:"status,omitempty"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
+
+	Matcher   string              `json:"matcher,omitempty"`
+	Excerpt   string              `json:"excerpt,omitempty"`
+	Extracted map[string][]string `json:"extracted,omitempty"`
+
+	Baseline *BaselineEvidence `json:"baseline,omitempty"`
+	CSRF     *CSRFEvidence     `json:"csrf,omitempty"`
+	Steps    []MacroStep       `json:"steps,omitempty"`
+
+	Timing       *TimingEvidence       `json:"timing,omitempty"`
+	Differential *DifferentialEvidence `json:"differential,omitempty"`
+	OOB          []OOBInteraction      `json:"oob,omitempty"`
+
+	Reflection *ReflectionEvidence `json:"reflection,omitempty"`
+}
+
+// ReflectionEvidence descreve onde o token de uma sonda segura foi enviado e
+// em que contexto voltou na resposta.
+type ReflectionEvidence struct {
+	Location string `json:"location"`
+	Token    string `json:"token"`
+	ReflectionContext
+
+	// Chars registra como cada caractere especial voltou nesse contexto e
+	// Exploitability o grau resultante (likely, partial ou unlikely).
+	Chars          []CharSurvival `json:"chars,omitempty"`
+	Exploitability string         `json:"exploitability,omitempty"`
+}
+
+// CharSurvival é o resultado de um canário de caractere: raw, encoded (com a
+// forma devolvida em Returned), stripped ou blocked (a reflexão sumiu).
+type CharSurvival struct {
+	Char     string `json:"char"`
+	State    string `json:"state"`
+	Returned string `json:"returned,omitempty"`
+}
+
+// ReflectionContext é o contexto HTML/JS exato de uma ocorrência refletida.
+// Quote é o delimitador do atributo (vazio se sem aspas) e JSQuote o da string
+// JavaScript em que o token está, se houver.
+type ReflectionContext struct {
+	Kind       string `json:"context"`
+	Tag        string `json:"tag,omitempty"`
+	Attribute  string `json:"attribute,omitempty"`
+	Quote      string `json:"quote,omitempty"`
+	JSQuote    string `json:"js_quote,omitempty"`
+	JSComment  bool   `json:"js_comment,omitempty"`
+	ScriptType string `json:"script_type,omitempty"`
+	URLStart   bool   `json:"url_start,omitempty"`
+	Offset     int    `json:"offset"`
+}
+
+// BaselineEvidence descreve a resposta limpa do ponto de injeção usada como
+// comparação.
+type BaselineEvidence struct {
+	Request    string  `json:"request"`
+	Status     int     `json:"status"`
+	Length     int     `json:"length"`
+	Stability  float64 `json:"stability"`
+	Similarity float64 `json:"similarity"`
+}
+
+// MacroStep é uma etapa enviada em uma sequência de várias requisições.
+type MacroStep struct {
+	Name      string            `json:"name"`
+	Request   string            `json:"request"`
+	Status    int               `json:"status"`
+	Injected  bool              `json:"injected,omitempty"`
+	Extracted map[string]string `json:"extracted,omitempty"`
+}
+
+// CSRFEvidence registra a renovação de tokens anti-CSRF feita antes do envio.
+type CSRFEvidence struct {
+	Source string      `json:"source"`
+	Status int         `json:"status"`
+	Tokens []CSRFToken `json:"tokens,omitempty"`
+}
+
+// CSRFToken é um token lido da página de origem e os locais da requisição que o receberam.
+type CSRFToken struct {
+	Name   string   `json:"name"`
+	From   string   `json:"from"`
+	Value  string   `json:"value"`
+	Placed []string `json:"placed,omitempty"`
+}
+
+// OOBInteraction é um contato fora de banda (DNS ou HTTP) provocado pelo payload.
+type OOBInteraction struct {
+	ID         string    `json:"id"`
+	Protocol   string    `json:"protocol"`
+	RemoteAddr string    `json:"remote_addr"`
+	Time       time.Time `json:"time"`
+	QName      string    `json:"qname,omitempty"`
+	QType      string    `json:"qtype,omitempty"`
+	Request    string    `json:"request,omitempty"`
+}
+
+// DifferentialEvidence registra as comparações de uma análise verdadeiro/falso.
+type DifferentialEvidence struct {
+	Trials            int       `json:"trials"`
+	BaselineStability float64   `json:"baseline_stability"`
+	TrueBaseline      []float64 `json:"true_vs_baseline"`
+	TrueFalse         []float64 `json:"true_vs_false"`
+	FalseRequest      string    `json:"false_request"`
+	FalseResponse     string    `json:"false_response,omitempty"`
+	FalseStatus       int       `json:"false_status,omitempty"`
+}
+
+// TimingEvidence registra as medições de uma detecção baseada em tempo.
+type TimingEvidence struct {
+	BaselineMs       []int64        `json:"baseline_ms"`
+	BaselineMedianMs int64          `json:"baseline_median_ms"`
+	Samples          []TimingSample `json:"samples"`
+	Slope            float64        `json:"slope"`
+	Intercept        float64        `json:"intercept_seconds"`
+	R2               float64        `json:"r2"`
+}
+
+// TimingSample é uma medição: o atraso pedido no payload e a latência observada.
+type TimingSample struct {
+	DelaySeconds float64 `json:"delay_seconds"`
+	ObservedMs   int64   `json:"observed_ms"`
 }
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket. A rate of zero or less disables limiting.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns a limiter allowing rate requests per second with the given
+// burst. The bucket starts full.
+func NewLimiter(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Rate returns the current refill rate in requests per second.
+func (l *Limiter) Rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// SetRate changes the refill rate. Tokens already in the bucket are kept.
+func (l *Limiter) SetRate(rate float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(time.Now())
+	l.rate = rate
+}
+
+func (l *Limiter) refill(now time.Time) {
+	if l.rate > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+}
+
+// Wait blocks until a token is available or ctx is done.
+func (l *Limiter) Wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.rate <= 0 {
+			l.mu.Unlock()
+			return ctx.Err()
+		}
+		now := time.Now()
+		l.refill(now)
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		l.mu.Unlock()
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// HostLimiter combines one token bucket per host with an optional global bucket
+// shared by every host.
+type HostLimiter struct {
+	mu      sync.Mutex
+	perHost float64
+	burst   int
+	hosts   map[string]*Limiter
+	global  *Limiter
+}
+
+// NewHostLimiter limits each host to perHost requests per second and all hosts
+// together to global requests per second. Zero disables the respective limit.
+func NewHostLimiter(perHost, global float64, burst int) *HostLimiter {
+	h := &HostLimiter{perHost: perHost, burst: burst, hosts: map[string]*Limiter{}}
+	if global > 0 {
+		h.global = NewLimiter(global, burst)
+	}
+	return h
+}
+
+// Host returns the bucket for host, creating it on first use.
+func (h *HostLimiter) Host(host string) *Limiter {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	l, ok := h.hosts[host]
+	if !ok {
+		l = NewLimiter(h.perHost, h.burst)
+		h.hosts[host] = l
+	}
+	return l
+}
+
+// Wait takes a token from the host bucket and then from the global bucket.
+func (h *HostLimiter) Wait(ctx context.Context, host string) error {
+	if err := h.Host(host).Wait(ctx); err != nil {
+		return err
+	}
+	if h.global != nil {
+		return h.global.Wait(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiterSpacing(t *testing.T) {
+	l := NewLimiter(50, 1)
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The first token is already in the bucket; the other three take ~20ms each.
+	if d := time.Since(start); d < 55*time.Millisecond {
+		t.Fatalf("limiter allowed 4 requests in %s", d)
+	}
+}
+
+func TestHostLimiterCancel(t *testing.T) {
+	h := NewHostLimiter(0.1, 0, 1)
+	if err := h.Wait(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	// Another host has its own bucket.
+	if err := h.Wait(context.Background(), "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := h.Wait(ctx, "a"); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+}
@@ -0,0 +1,600 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SessionConfig is a session profile file. Values may reference environment
+// variables as ${NAME} so that secrets stay out of the file.
+type SessionConfig struct {
+	Profiles map[string]SessionProfile `yaml:"profiles" json:"profiles"`
+}
+
+// SessionProfile describes how to authenticate against a target. Static
+// headers, cookies and the bearer token are sent with every request to the
+// profile's hosts; a form login or an OAuth2 client-credentials grant
+// establishes a session that is renewed whenever a logged-out indicator is seen.
+//
+// Hosts lists the hosts that receive the credentials ("app.example.com", or
+// "*.example.com" for its subdomains). Without it, the scope is the host of the
+// first request plus, for a form login, the login host.
+type SessionProfile struct {
+	Hosts     []string          `yaml:"hosts,omitempty" json:"hosts,omitempty"`
+	Headers   map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	Cookies   map[string]string `yaml:"cookies,omitempty" json:"cookies,omitempty"`
+	Bearer    string            `yaml:"bearer,omitempty" json:"bearer,omitempty"`
+	Login     *FormLogin        `yaml:"login,omitempty" json:"login,omitempty"`
+	OAuth2    *OAuth2Client     `yaml:"oauth2,omitempty" json:"oauth2,omitempty"`
+	LoggedOut *LoggedOutCheck   `yaml:"logged_out,omitempty" json:"logged_out,omitempty"`
+}
+
+// FormLogin is a login recipe: the fields are posted to URL (as a form, or as
+// JSON when JSON is set) and the cookies set by the response become the
+// session. TokenJSON optionally names a field of a JSON response (dotted path)
+// whose value is then sent as a bearer token.
+type FormLogin struct {
+	URL       string            `yaml:"url" json:"url"`
+	Method    string            `yaml:"method,omitempty" json:"method,omitempty"`
+	Fields    map[string]string `yaml:"fields,omitempty" json:"fields,omitempty"`
+	JSON      bool              `yaml:"json,omitempty" json:"json,omitempty"`
+	Headers   map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	TokenJSON string            `yaml:"token_json,omitempty" json:"token_json,omitempty"`
+	Success   *SuccessCheck     `yaml:"success,omitempty" json:"success,omitempty"`
+}
+
+// SuccessCheck decides whether a login response is a successful login. Every
+// configured condition must hold; without any, a status below 400 is enough.
+type SuccessCheck struct {
+	Status   []int  `yaml:"status,omitempty" json:"status,omitempty"`
+	Contains string `yaml:"contains,omitempty" json:"contains,omitempty"`
+	Cookie   string `yaml:"cookie,omitempty" json:"cookie,omitempty"`
+}
+
+// OAuth2Client fetches a bearer token with the client-credentials grant.
+// AuthStyle "body" sends the client credentials as form fields instead of
+// HTTP basic authentication.
+type OAuth2Client struct {
+	TokenURL     string            `yaml:"token_url" json:"token_url"`
+	ClientID     string            `yaml:"client_id" json:"client_id"`
+	ClientSecret string            `yaml:"client_secret" json:"client_secret"`
+	Scopes       []string          `yaml:"scopes,omitempty" json:"scopes,omitempty"`
+	Params       map[string]string `yaml:"params,omitempty" json:"params,omitempty"`
+	AuthStyle    string            `yaml:"auth_style,omitempty" json:"auth_style,omitempty"`
+}
+
+// LoggedOutCheck recognises a response that means the session is gone: any
+// listed status, any listed string in the body, or a redirect whose Location
+// contains Location. Profiles with a login or OAuth2 grant default to 401.
+type LoggedOutCheck struct {
+	Status   []int    `yaml:"status,omitempty" json:"status,omitempty"`
+	Contains []string `yaml:"contains,omitempty" json:"contains,omitempty"`
+	Location string   `yaml:"location,omitempty" json:"location,omitempty"`
+}
+
+const (
+	// maxIndicatorRead bounds how much of a body is buffered to look for a
+	// logged-out string.
+	maxIndicatorRead = 1 << 20
+	// tokenRefreshMargin renews OAuth2 tokens slightly before they expire.
+	tokenRefreshMargin = 30 * time.Second
+)
+
+// envRefRe matches a ${NAME} environment reference. A bare $NAME is left alone
+// so that values such as "pa$$w0rd" survive.
+var envRefRe = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnvRefs replaces the ${NAME} references in s with the environment.
+func expandEnvRefs(s string) string {
+	return envRefRe.ReplaceAllStringFunc(s, func(m string) string {
+		return os.Getenv(envRefRe.FindStringSubmatch(m)[1])
+	})
+}
+
+// LoadSessionConfig reads a YAML or JSON session profile file, expanding
+// ${NAME} environment references.
+func LoadSessionConfig(path string) (*SessionConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg SessionConfig
+	if err := yaml.Unmarshal([]byte(expandEnvRefs(string(data))), &cfg); err != nil {
+		return nil, fmt.Errorf("invalid session file %s: %w", path, err)
+	}
+	if len(cfg.Profiles) == 0 {
+		return nil, fmt.Errorf("session file %s defines no profiles", path)
+	}
+	return &cfg, nil
+}
+
+// Profile returns the named profile. An empty name selects the only profile
+// of a single-profile file.
+func (c *SessionConfig) Profile(name string) (SessionProfile, error) {
+	if name == "" && len(c.Profiles) == 1 {
+		for _, p := range c.Profiles {
+			return p, nil
+		}
+	}
+	if p, ok := c.Profiles[name]; ok {
+		return p, nil
+	}
+	names := make([]string, 0, len(c.Profiles))
+	for n := range c.Profiles {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	if name == "" {
+		return SessionProfile{}, fmt.Errorf("choose a session profile: %s", strings.Join(names, ", "))
+	}
+	return SessionProfile{}, fmt.Errorf("unknown session profile %q (known: %s)", name, strings.Join(names, ", "))
+}
+
+// Session is an authenticated session shared by every HTTP client it creates.
+// The zero value is not usable; a nil *Session is valid and means "no session".
+type Session struct {
+	profile SessionProfile
+	jar     http.CookieJar
+	base    http.RoundTripper
+
+	mu      sync.Mutex
+	hosts   []string
+	pinned  bool
+	token   string
+	expires time.Time
+	ready   bool
+	gen     int
+	logins  int
+}
+
+// NewSession validates the profile and returns a session. The login, if any,
+// happens on first use.
+func NewSession(p SessionProfile) (*Session, error) {
+	if p.Login != nil && p.OAuth2 != nil {
+		return nil, errors.New("a session profile can use either a form login or oauth2, not both")
+	}
+	if p.Login != nil {
+		if _, err := url.ParseRequestURI(p.Login.URL); err != nil {
+			return nil, fmt.Errorf("invalid login url: %w", err)
+		}
+	}
+	if p.OAuth2 != nil {
+		if _, err := url.ParseRequestURI(p.OAuth2.TokenURL); err != nil {
+			return nil, fmt.Errorf("invalid oauth2 token_url: %w", err)
+		}
+		if p.OAuth2.ClientID == "" {
+			return nil, errors.New("oauth2 client_id is required")
+		}
+	}
+	if p.LoggedOut == nil && (p.Login != nil || p.OAuth2 != nil) {
+		p.LoggedOut = &LoggedOutCheck{Status: []int{http.StatusUnauthorized}}
+	}
+
+	var hosts []string
+	for _, h := range p.Hosts {
+		hosts = append(hosts, strings.ToLower(strings.TrimSpace(h)))
+	}
+	if len(hosts) == 0 && p.Login != nil {
+		u, _ := url.Parse(p.Login.URL)
+		hosts = []string{strings.ToLower(u.Hostname())}
+	}
+
+	jar, _ := cookiejar.New(nil)
+	return &Session{profile: p, jar: jar, base: http.DefaultTransport, hosts: hosts, pinned: len(p.Hosts) > 0}, nil
+}
+
+// inScope reports whether the credentials may be sent to u. Without configured
+// hosts, the host of the first request joins the scope.
+func (s *Session) inScope(u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.pinned {
+		s.pinned = true
+		s.hosts = append(s.hosts, host)
+	}
+	for _, h := range s.hosts {
+		if h == host || (strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadSession loads profile name from a session file.
+func LoadSession(path, name string) (*Session, error) {
+	cfg, err := LoadSessionConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := cfg.Profile(name)
+	if err != nil {
+		return nil, err
+	}
+	return NewSession(p)
+}
+
+// Client returns an HTTPClient whose requests carry the session. On a nil
+// session it is a plain HTTPClient.
+func (s *Session) Client(timeoutSec int) *http.Client {
+	c := HTTPClient(timeoutSec)
+	if s != nil {
+		c.Transport = &sessionTransport{s: s}
+	}
+	return c
+}
+
+// Logins returns how many times the session has been established.
+func (s *Session) Logins() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logins
+}
+
+// Headers returns the headers the session adds to a request for target, for
+// tools that cannot use the shared client (e.g. external scanners).
+func (s *Session) Headers(ctx context.Context, target string) (http.Header, error) {
+	h := http.Header{}
+	if s == nil {
+		return h, nil
+	}
+	if _, err := s.ensure(ctx); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.apply(req)
+	return req.Header, nil
+}
+
+// ensure establishes the session if it is not ready, or renews an expired
+// OAuth2 token, and returns the current generation.
+func (s *Session) ensure(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expired := !s.expires.IsZero() && time.Now().After(s.expires.Add(-tokenRefreshMargin))
+	if s.ready && !expired {
+		return s.gen, nil
+	}
+	if err := s.loginLocked(ctx); err != nil {
+		return s.gen, err
+	}
+	return s.gen, nil
+}
+
+// relogin renews the session unless another request already did so since
+// generation gen.
+func (s *Session) relogin(ctx context.Context, gen int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.gen != gen {
+		return nil
+	}
+	return s.loginLocked(ctx)
+}
+
+func (s *Session) loginLocked(ctx context.Context) error {
+	var err error
+	switch {
+	case s.profile.Login != nil:
+		err = s.formLogin(ctx)
+	case s.profile.OAuth2 != nil:
+		err = s.oauth2Token(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	s.ready = true
+	s.gen++
+	if s.profile.Login != nil || s.profile.OAuth2 != nil {
+		s.logins++
+	}
+	return nil
+}
+
+// apply adds the static headers, the cookies and the bearer token to req when
+// its host is in scope. Headers already present on the request are kept.
+func (s *Session) apply(req *http.Request) {
+	if !s.inScope(req.URL) {
+		return
+	}
+	for k, v := range s.profile.Headers {
+		if req.Header.Get(k) == "" {
+			req.Header.Set(k, v)
+		}
+	}
+
+	var cookies []string
+	names := make([]string, 0, len(s.profile.Cookies))
+	for name := range s.profile.Cookies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cookies = append(cookies, name+"="+s.profile.Cookies[name])
+	}
+	for _, c := range s.jar.Cookies(req.URL) {
+		cookies = append(cookies, c.Name+"="+c.Value)
+	}
+	if len(cookies) > 0 {
+		if existing := req.Header.Get("Cookie"); existing != "" {
+			cookies = append([]string{existing}, cookies...)
+		}
+		req.Header.Set("Cookie", strings.Join(cookies, "; "))
+	}
+
+	s.mu.Lock()
+	token := s.token
+	s.mu.Unlock()
+	if token == "" {
+		token = s.profile.Bearer
+	}
+	if token != "" && req.Header.Get("Authorization") == "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// loggedOut reports whether resp shows that the session is gone. The body is
+// buffered (up to maxIndicatorRead bytes) only when a string must be found.
+func (s *Session) loggedOut(resp *http.Response) bool {
+	check := s.profile.LoggedOut
+	if check == nil {
+		return false
+	}
+	for _, st := range check.Status {
+		if resp.StatusCode == st {
+			return true
+		}
+	}
+	if check.Location != "" && strings.Contains(resp.Header.Get("Location"), check.Location) {
+		return true
+	}
+	if len(check.Contains) == 0 {
+		return false
+	}
+	head, _ := io.ReadAll(io.LimitReader(resp.Body, maxIndicatorRead))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+	for _, needle := range check.Contains {
+		if bytes.Contains(head, []byte(needle)) {
+			return true
+		}
+	}
+	return false
+}
+
+// loginClient sends login and token requests without the session and without
+// following redirects, so that the login response itself is checked.
+func (s *Session) loginClient() *http.Client {
+	return &http.Client{
+		Transport:     s.base,
+		Timeout:       30 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+}
+
+func (s *Session) formLogin(ctx context.Context) error {
+	l := s.profile.Login
+	method := strings.ToUpper(l.Method)
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	var body []byte
+	contentType := "application/x-www-form-urlencoded"
+	if l.JSON {
+		body, _ = json.Marshal(l.Fields)
+		contentType = "application/json"
+	} else {
+		form := url.Values{}
+		for k, v := range l.Fields {
+			form.Set(k, v)
+		}
+		body = []byte(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, l.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range l.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.loginClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("login request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxIndicatorRead))
+	if err != nil {
+		return fmt.Errorf("login request failed: %w", err)
+	}
+	s.jar.SetCookies(req.URL, resp.Cookies())
+
+	if err := checkLoginSuccess(l.Success, resp, data); err != nil {
+		return err
+	}
+	if l.TokenJSON != "" {
+		token, err := jsonField(data, l.TokenJSON)
+		if err != nil {
+			return fmt.Errorf("login response: %w", err)
+		}
+		s.token = token
+	}
+	return nil
+}
+
+func checkLoginSuccess(c *SuccessCheck, resp *http.Response, body []byte) error {
+	if c == nil {
+		if resp.StatusCode >= 400 {
+			return fmt.Errorf("login failed with status %d", resp.StatusCode)
+		}
+		return nil
+	}
+	if len(c.Status) > 0 {
+		ok := false
+		for _, st := range c.Status {
+			ok = ok || resp.StatusCode == st
+		}
+		if !ok {
+			return fmt.Errorf("login failed: unexpected status %d", resp.StatusCode)
+		}
+	}
+	if c.Contains != "" && !bytes.Contains(body, []byte(c.Contains)) {
+		return fmt.Errorf("login failed: response does not contain %q", c.Contains)
+	}
+	if c.Cookie != "" {
+		found := false
+		for _, ck := range resp.Cookies() {
+			found = found || ck.Name == c.Cookie
+		}
+		if !found {
+			return fmt.Errorf("login failed: cookie %q was not set", c.Cookie)
+		}
+	}
+	return nil
+}
+
+func (s *Session) oauth2Token(ctx context.Context) error {
+	o := s.profile.OAuth2
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(o.Scopes) > 0 {
+		form.Set("scope", strings.Join(o.Scopes, " "))
+	}
+	for k, v := range o.Params {
+		form.Set(k, v)
+	}
+	if strings.EqualFold(o.AuthStyle, "body") {
+		form.Set("client_id", o.ClientID)
+		form.Set("client_secret", o.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if !strings.EqualFold(o.AuthStyle, "body") {
+		req.SetBasicAuth(url.QueryEscape(o.ClientID), url.QueryEscape(o.ClientSecret))
+	}
+
+	resp, err := s.loginClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("oauth2 token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	var tok struct {
+		AccessToken string      `json:"access_token"`
+		ExpiresIn   json.Number `json:"expires_in"`
+		Error       string      `json:"error"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxIndicatorRead)).Decode(&tok); err != nil {
+		return fmt.Errorf("oauth2 token response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || tok.AccessToken == "" {
+		return fmt.Errorf("oauth2 token request failed with status %d %s", resp.StatusCode, tok.Error)
+	}
+
+	s.token = tok.AccessToken
+	s.expires = time.Time{}
+	if secs, err := strconv.Atoi(tok.ExpiresIn.String()); err == nil && secs > 0 {
+		s.expires = time.Now().Add(time.Duration(secs) * time.Second)
+	}
+	return nil
+}
+
+// jsonField returns the string form of a dotted path ("data.token") in a JSON document.
+func jsonField(data []byte, path string) (string, error) {
+	var cur interface{}
+	if err := json.Unmarshal(data, &cur); err != nil {
+		return "", err
+	}
+	for _, key := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("field %q not found", path)
+		}
+		if cur, ok = m[key]; !ok {
+			return "", fmt.Errorf("field %q not found", path)
+		}
+	}
+	switch v := cur.(type) {
+	case string:
+		return v, nil
+	case nil:
+		return "", fmt.Errorf("field %q is null", path)
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+// sessionTransport applies the session to every request and, when a response
+// shows the session is gone, logs in again and retries the request once.
+type sessionTransport struct {
+	s *Session
+}
+
+func (t *sessionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	s := t.s
+	if !s.inScope(req.URL) {
+		return s.base.RoundTrip(req)
+	}
+	gen, err := s.ensure(req.Context())
+	if err != nil {
+		return nil, fmt.Errorf("session: %w", err)
+	}
+
+	resp, err := t.send(req)
+	if err != nil || !s.loggedOut(resp) {
+		return resp, err
+	}
+	// Only requests whose body can be replayed are retried.
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+	if err := s.relogin(req.Context(), gen); err != nil {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return t.send(retry)
+}
+
+func (t *sessionTransport) send(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	t.s.apply(r)
+	resp, err := t.s.base.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	t.s.jar.SetCookies(r.URL, resp.Cookies())
+	return resp, nil
+}
@@ -0,0 +1,210 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSessionStaticCredentials(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s|%s|%s", r.Header.Get("X-Api-Key"), r.Header.Get("Cookie"), r.Header.Get("Authorization"))
+	}))
+	defer srv.Close()
+
+	s, err := NewSession(SessionProfile{
+		Headers: map[string]string{"X-Api-Key": "k1"},
+		Cookies: map[string]string{"b": "2", "a": "1"},
+		Bearer:  "tok",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Cookie", "own=x")
+	resp, err := s.Client(5).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if got := string(body); got != "k1|own=x; a=1; b=2|Bearer tok" {
+		t.Fatalf("unexpected credentials %q", got)
+	}
+
+	h, err := s.Headers(context.Background(), srv.URL)
+	if err != nil || h.Get("Authorization") != "Bearer tok" || h.Get("Cookie") != "a=1; b=2" {
+		t.Fatalf("unexpected headers %v (%v)", h, err)
+	}
+	if s.Logins() != 0 {
+		t.Fatalf("static profiles never log in, got %d logins", s.Logins())
+	}
+}
+
+func TestSessionHostScope(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s|%s", r.Header.Get("Cookie"), r.Header.Get("Authorization"))
+	}))
+	defer srv.Close()
+	other := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+
+	get := func(s *Session, target string) string {
+		resp, err := s.Client(5).Get(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	s, _ := NewSession(SessionProfile{Cookies: map[string]string{"a": "1"}, Bearer: "tok"})
+	if got := get(s, srv.URL); got != "a=1|Bearer tok" {
+		t.Fatalf("the first host must receive the credentials, got %q", got)
+	}
+	if got := get(s, other); got != "|" {
+		t.Fatalf("credentials leaked to another host: %q", got)
+	}
+	if h, _ := s.Headers(context.Background(), other); len(h) != 0 {
+		t.Fatalf("credentials leaked through Headers: %v", h)
+	}
+
+	s, _ = NewSession(SessionProfile{Hosts: []string{"localhost"}, Bearer: "tok"})
+	if got := get(s, srv.URL); got != "|" {
+		t.Fatalf("hosts must restrict the credentials, got %q", got)
+	}
+	if got := get(s, other); got != "|Bearer tok" {
+		t.Fatalf("listed host must receive the credentials, got %q", got)
+	}
+}
+
+func TestSessionFormLoginAndRelogin(t *testing.T) {
+	// Each session cookie is good for two requests; afterwards the app redirects to /login.
+	var issued, uses int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			r.ParseForm()
+			if r.PostForm.Get("user") != "admin" || r.PostForm.Get("pass") != "s3cret" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			n := atomic.AddInt32(&issued, 1)
+			atomic.StoreInt32(&uses, 0)
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: fmt.Sprint(n), Path: "/"})
+			fmt.Fprint(w, "Welcome")
+			return
+		}
+		c, err := r.Cookie("sid")
+		if err != nil || c.Value != fmt.Sprint(atomic.LoadInt32(&issued)) || atomic.AddInt32(&uses, 1) > 2 {
+			http.Redirect(w, r, "/login?next=app", http.StatusFound)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "hello %s %s", c.Value, body)
+	}))
+	defer srv.Close()
+
+	s, err := NewSession(SessionProfile{
+		Login: &FormLogin{
+			URL:     srv.URL + "/login",
+			Fields:  map[string]string{"user": "admin", "pass": "s3cret"},
+			Success: &SuccessCheck{Status: []int{200}, Contains: "Welcome", Cookie: "sid"},
+		},
+		LoggedOut: &LoggedOutCheck{Location: "/login"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := s.Client(5)
+	for i, want := range []string{"hello 1 a", "hello 1 b", "hello 2 c"} {
+		resp, err := client.Post(srv.URL+"/app", "text/plain", strings.NewReader(want[len(want)-1:]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != want {
+			t.Fatalf("request %d: got %q, want %q", i, body, want)
+		}
+	}
+	if s.Logins() != 2 {
+		t.Fatalf("expected a second login after the session expired, got %d", s.Logins())
+	}
+
+	bad, _ := NewSession(SessionProfile{Login: &FormLogin{URL: srv.URL + "/login", Fields: map[string]string{"user": "x"}}})
+	if _, err := bad.Client(5).Get(srv.URL + "/app"); err == nil || !strings.Contains(err.Error(), "login failed with status 403") {
+		t.Fatalf("expected a login failure, got %v", err)
+	}
+}
+
+func TestSessionOAuth2ClientCredentials(t *testing.T) {
+	var tokens int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			id, secret, _ := r.BasicAuth()
+			r.ParseForm()
+			if id != "cli" || secret != "sec" || r.PostForm.Get("grant_type") != "client_credentials" || r.PostForm.Get("scope") != "read write" {
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"error":"invalid_client"}`)
+				return
+			}
+			fmt.Fprintf(w, `{"access_token":"t%d","expires_in":3600}`, atomic.AddInt32(&tokens, 1))
+			return
+		}
+		// Only the newest token is accepted: the first one is revoked right away.
+		if r.Header.Get("Authorization") != "Bearer t2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer srv.Close()
+
+	s, err := NewSession(SessionProfile{OAuth2: &OAuth2Client{
+		TokenURL: srv.URL + "/token", ClientID: "cli", ClientSecret: "sec", Scopes: []string{"read", "write"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s.Client(5).Get(srv.URL + "/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 || tokens != 2 || s.Logins() != 2 {
+		t.Fatalf("expected a token refresh after 401, got status %d with %d tokens", resp.StatusCode, tokens)
+	}
+}
+
+func TestLoadSessionConfig(t *testing.T) {
+	t.Setenv("RECONSEC_TEST_TOKEN", "from-env")
+	path := filepath.Join(t.TempDir(), "session.yaml")
+	content := "profiles:\n  api:\n    bearer: ${RECONSEC_TEST_TOKEN}\n  admin:\n    headers:\n      X-Role: admin\n    login:\n      url: https://t/login\n      fields: { password: pa$$w0rd$HOME }\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadSessionConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, err := cfg.Profile("api"); err != nil || p.Bearer != "from-env" {
+		t.Fatalf("unexpected profile %+v (%v)", p, err)
+	}
+	if p, err := cfg.Profile("admin"); err != nil || p.Login.Fields["password"] != "pa$$w0rd$HOME" {
+		t.Fatalf("only ${NAME} references may be expanded, got %+v (%v)", p.Login, err)
+	}
+	if _, err := cfg.Profile(""); err == nil || !strings.Contains(err.Error(), "admin, api") {
+		t.Fatalf("an ambiguous profile choice must fail, got %v", err)
+	}
+	if _, err := LoadSession(path, "nope"); err == nil {
+		t.Fatal("expected an unknown profile error")
+	}
+}